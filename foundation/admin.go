@@ -0,0 +1,171 @@
+package foundation
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Paths served by the admin server, next to MetricsPath and the health paths.
+const (
+	PprofPath      = "/debug/pprof/"
+	BuildInfoPath  = "/buildinfo"
+	ProcessorsPath = "/processors"
+	LogLevelPath   = "/loglevel"
+)
+
+// DefaultAdminHost keeps the admin server off the network unless an AdminToken protects it.
+const DefaultAdminHost = "127.0.0.1"
+
+// Version is reported by BuildInfoPath, set at build time with
+// -ldflags "-X github.com/OptechLabs/monorepo/foundation.Version=v1.2.3".
+// Optional. Default value the main module version.
+var Version string
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version     string    `json:"version"`
+	Revision    string    `json:"revision,omitempty"`
+	RevisionAt  string    `json:"revisionTime,omitempty"`
+	Modified    bool      `json:"modified,omitempty"`
+	GoVersion   string    `json:"goVersion"`
+	Path        string    `json:"path"`
+	Environment string    `json:"environment"`
+	StartedAt   time.Time `json:"startedAt"`
+}
+
+func readBuildInfo(environment string, startedAt time.Time) BuildInfo {
+	info := BuildInfo{Version: Version, Environment: environment, StartedAt: startedAt}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = build.GoVersion
+	info.Path = build.Main.Path
+	if info.Version == "" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.RevisionAt = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+// processorView is the JSON form of a ProcessorStatus.
+type processorView struct {
+	Name      string         `json:"name"`
+	State     ProcessorState `json:"state"`
+	DependsOn []string       `json:"dependsOn,omitempty"`
+	Restarts  int            `json:"restarts"`
+	LastError string         `json:"lastError,omitempty"`
+}
+
+// registerAdminHandlers mounts the admin endpoints on mux: metrics, health, pprof, the build info, the processors
+// and, with a LogLevel, a GET and PUT {"level":"debug"} toggle of the log level.
+func (f *Foundation) registerAdminHandlers(mux *http.ServeMux, level *zap.AtomicLevel) {
+	mux.Handle(MetricsPath, f.Metrics.Handler())
+	f.Health.RegisterHandlers(mux)
+
+	mux.HandleFunc(PprofPath, pprof.Index)
+	mux.HandleFunc(PprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(PprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(PprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(PprofPath+"trace", pprof.Trace)
+
+	startedAt := time.Now().UTC()
+	mux.HandleFunc(BuildInfoPath, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, readBuildInfo(f.Environment, startedAt))
+	})
+	mux.HandleFunc(ProcessorsPath, func(w http.ResponseWriter, r *http.Request) {
+		statuses := f.ProcessorStatuses()
+		views := make([]processorView, len(statuses))
+		for i, status := range statuses {
+			views[i] = processorView{Name: status.Name, State: status.State, DependsOn: status.DependsOn, Restarts: status.Restarts}
+			if status.LastError != nil {
+				views[i].LastError = status.LastError.Error()
+			}
+		}
+		writeJSON(w, http.StatusOK, views)
+	})
+	if level != nil {
+		// changes last until the next config reload sets the configured level
+		mux.Handle(LogLevelPath, level)
+	}
+}
+
+// newAdminServer returns the server for the admin endpoints, kept off the public router so profiling and the log
+// level are not exposed with it, or nil without an AdminPort. Without an AdminToken it only listens on a loopback
+// address.
+func newAdminServer(opts Options, mux *http.ServeMux) *http.Server {
+	if opts.AdminPort == "" {
+		return nil
+	}
+	host := opts.AdminHost
+	if opts.AdminToken == "" && !isLoopback(host) {
+		opts.Logger.Warn("admin server has no token, listening on localhost only", zap.String("adminHost", host))
+		host = DefaultAdminHost
+	}
+	var handler http.Handler = mux
+	if opts.AdminToken != "" {
+		handler = requireBearerToken(opts.AdminToken, mux)
+	}
+	return &http.Server{
+		Addr:           net.JoinHostPort(host, opts.AdminPort),
+		WriteTimeout:   max(opts.WriteTimeout, adminWriteTimeout),
+		ReadTimeout:    opts.ReadTimeout,
+		IdleTimeout:    opts.IdleTimeout,
+		Handler:        handler,
+		MaxHeaderBytes: 1 << 20,
+	}
+}
+
+// adminWriteTimeout leaves room for the default 30 second CPU profile.
+const adminWriteTimeout = time.Minute
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireBearerToken rejects requests without "Authorization: Bearer <token>".
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *Foundation) serveAdmin(stop context.CancelFunc) {
+	go func() {
+		f.Logger.Info("admin server starting", zap.String("tcpAddress", f.AdminServer.Addr))
+		if err := f.AdminServer.ListenAndServe(); err != nil {
+			if errors.Is(err, http.ErrServerClosed) {
+				return
+			}
+			stop()
+			f.Logger.Fatal("admin server failed to start", zap.Error(err), zap.String("tcpAddress", f.AdminServer.Addr))
+		}
+	}()
+}
@@ -0,0 +1,138 @@
+package foundation_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_AdminHandlers(t *testing.T) {
+	t.Parallel()
+
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	f := foundation.New(foundation.Options{
+		Environment: foundation.Staging,
+		Logger:      foundation.NewNopLogger(),
+		LogLevel:    &level,
+	})
+	f.AddNamedProcessor("relay", &testProcessor{name: "relay", log: &eventLog{}})
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "build info",
+			path:     foundation.BuildInfoPath,
+			wantCode: http.StatusOK,
+			wantBody: `"environment":"staging"`,
+		},
+		{
+			name:     "processors",
+			path:     foundation.ProcessorsPath,
+			wantCode: http.StatusOK,
+			wantBody: `[{"name":"relay","state":"pending","restarts":0}]`,
+		},
+		{
+			name:     "readiness",
+			path:     foundation.ReadinessPath,
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: `"processor:relay":"pending"`,
+		},
+		{
+			name:     "pprof",
+			path:     foundation.PprofPath,
+			wantCode: http.StatusOK,
+			wantBody: "goroutine",
+		},
+		{
+			name:     "log level",
+			path:     foundation.LogLevelPath,
+			wantCode: http.StatusOK,
+			wantBody: `{"level":"info"}`,
+		},
+	}
+
+	// the admin endpoints are read only but for the log level, changed below
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			f.AdminMux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, rr.Code)
+			assert.Contains(t, rr.Body.String(), tc.wantBody)
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	f.AdminMux.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, foundation.LogLevelPath, strings.NewReader(`{"level":"debug"}`)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, zapcore.DebugLevel, level.Level())
+}
+
+func Test_AdminServerRequiresTokenOffLocalhost(t *testing.T) {
+	t.Parallel()
+
+	f := foundation.New(foundation.Options{Environment: foundation.Test, Logger: foundation.NewNopLogger(), AdminPort: "9090", AdminHost: "0.0.0.0"})
+	assert.Equal(t, "127.0.0.1:9090", f.AdminServer.Addr, "falls back to localhost without a token")
+
+	port := freePort(t)
+	f = foundation.New(foundation.Options{
+		Environment: foundation.Test,
+		Logger:      foundation.NewNopLogger(),
+		AdminPort:   port,
+		AdminHost:   "0.0.0.0",
+		AdminToken:  "s3cret",
+	})
+	assert.Equal(t, "0.0.0.0:"+port, f.AdminServer.Addr)
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- f.RunWithContext(ctx, stop) }()
+	defer func() {
+		stop()
+		<-done
+	}()
+
+	get := func(token string) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:"+port+foundation.BuildInfoPath, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return http.DefaultClient.Do(req)
+	}
+	require.Eventually(t, func() bool {
+		resp, err := get("")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusUnauthorized
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp, err := get("wrong")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = get("s3cret")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var info foundation.BuildInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, foundation.Test, info.Environment)
+	assert.NotEmpty(t, info.GoVersion)
+}
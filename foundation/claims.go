@@ -0,0 +1,30 @@
+package foundation
+
+import (
+	"slices"
+	"time"
+)
+
+// Claims are the validated claims of the bearer token that authenticated a request.
+type Claims struct {
+	Subject     string
+	Issuer      string
+	Audience    []string
+	ExpiresAt   time.Time
+	Scopes      []string
+	Permissions []string
+	Roles       []string
+	// Raw holds every claim in the token, including custom ones.
+	Raw map[string]interface{}
+}
+
+// HasScope reports whether the token was granted scope, either through the space separated "scope" claim or the
+// Auth0 RBAC "permissions" claim.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope) || slices.Contains(c.Permissions, scope)
+}
+
+// HasRole reports whether the token carries role.
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
@@ -0,0 +1,201 @@
+package foundation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Special fields of the Cloud Logging structured log format, see
+// https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+const (
+	CloudTraceKey          = "logging.googleapis.com/trace"
+	CloudSpanIDKey         = "logging.googleapis.com/spanId"
+	CloudTraceSampledKey   = "logging.googleapis.com/trace_sampled"
+	CloudSourceLocationKey = "logging.googleapis.com/sourceLocation"
+	CloudHTTPRequestKey    = "httpRequest"
+)
+
+// CloudLoggingEncoderConfig encodes entries in the Cloud Logging structured format: severity, message and time
+// are read by Cloud Logging, and the caller is written as sourceLocation by WrapCloudLoggingCore.
+func CloudLoggingEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "severity",
+		NameKey:        "logger",
+		MessageKey:     "message",
+		StacktraceKey:  "stack_trace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    cloudSeverity,
+		EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+}
+
+func cloudSeverity(level zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	switch level {
+	case zapcore.DebugLevel:
+		enc.AppendString("DEBUG")
+	case zapcore.InfoLevel:
+		enc.AppendString("INFO")
+	case zapcore.WarnLevel:
+		enc.AppendString("WARNING")
+	case zapcore.ErrorLevel:
+		enc.AppendString("ERROR")
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		enc.AppendString("CRITICAL")
+	case zapcore.FatalLevel:
+		enc.AppendString("ALERT")
+	default:
+		enc.AppendString("DEFAULT")
+	}
+}
+
+// WrapCloudLoggingCore adds the entry's caller to every entry as the Cloud Logging sourceLocation object.
+func WrapCloudLoggingCore(core zapcore.Core) zapcore.Core {
+	return cloudLoggingCore{Core: core}
+}
+
+type cloudLoggingCore struct {
+	zapcore.Core
+}
+
+func (c cloudLoggingCore) With(fields []zapcore.Field) zapcore.Core {
+	return cloudLoggingCore{Core: c.Core.With(fields)}
+}
+
+func (c cloudLoggingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c cloudLoggingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if entry.Caller.Defined {
+		fields = append(fields, zapcore.Field{
+			Key:       CloudSourceLocationKey,
+			Type:      zapcore.ObjectMarshalerType,
+			Interface: sourceLocation(entry.Caller),
+		})
+	}
+	return c.Core.Write(entry, fields)
+}
+
+type sourceLocation zapcore.EntryCaller
+
+func (l sourceLocation) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("file", l.File)
+	enc.AddString("line", strconv.Itoa(l.Line))
+	enc.AddString("function", l.Function)
+	return nil
+}
+
+// TraceContext identifies the trace and span a request belongs to.
+type TraceContext struct {
+	TraceID string // 32 hex characters
+	SpanID  string // 16 hex characters
+	Sampled bool
+}
+
+// TraceContextFromHeaders reads the W3C traceparent header, falling back to X-Cloud-Trace-Context as set by Google
+// load balancers and Cloud Run.
+func TraceContextFromHeaders(header http.Header) (TraceContext, bool) {
+	if tc, ok := parseTraceparent(header.Get("traceparent")); ok {
+		return tc, true
+	}
+	return parseCloudTraceContext(header.Get("X-Cloud-Trace-Context"))
+}
+
+// parseTraceparent parses "00-<trace id>-<span id>-<flags>".
+func parseTraceparent(value string) (TraceContext, bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return TraceContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || !isHex(parts[1]) || !isHex(parts[2]) {
+		return TraceContext{}, false
+	}
+	return TraceContext{TraceID: parts[1], SpanID: parts[2], Sampled: flags&1 == 1}, true
+}
+
+// parseCloudTraceContext parses "<trace id>/<decimal span id>;o=<0|1>".
+func parseCloudTraceContext(value string) (TraceContext, bool) {
+	traceID, rest, _ := strings.Cut(value, "/")
+	if len(traceID) != 32 || !isHex(traceID) {
+		return TraceContext{}, false
+	}
+	tc := TraceContext{TraceID: traceID}
+	spanID, options, _ := strings.Cut(rest, ";")
+	if span, err := strconv.ParseUint(spanID, 10, 64); err == nil {
+		tc.SpanID = fmt.Sprintf("%016x", span)
+	}
+	tc.Sampled = options == "o=1"
+	return tc, true
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// LogAttrs returns the Cloud Logging trace fields for tc. Cloud Logging only groups entries under a trace named
+// projects/<project>/traces/<trace id>, so projectID should be set outside local development.
+func (tc TraceContext) LogAttrs(projectID string) []slog.Attr {
+	trace := tc.TraceID
+	if projectID != "" {
+		trace = "projects/" + projectID + "/traces/" + tc.TraceID
+	}
+	attrs := []slog.Attr{slog.String(CloudTraceKey, trace), slog.Bool(CloudTraceSampledKey, tc.Sampled)}
+	if tc.SpanID != "" {
+		attrs = append(attrs, slog.String(CloudSpanIDKey, tc.SpanID))
+	}
+	return attrs
+}
+
+// ContextWithTrace returns a copy of ctx whose log records carry the Cloud Logging trace fields of tc.
+func ContextWithTrace(ctx context.Context, projectID string, tc TraceContext) context.Context {
+	return ContextWithLogAttrs(ctx, tc.LogAttrs(projectID)...)
+}
+
+// HTTPRequestLog describes a served request as the Cloud Logging httpRequest object.
+type HTTPRequestLog struct {
+	Method       string
+	URL          string
+	RequestSize  int64
+	Status       int
+	ResponseSize int64
+	UserAgent    string
+	RemoteIP     string
+	Referer      string
+	Protocol     string
+	Latency      time.Duration
+}
+
+// LogAttr returns the request as the httpRequest attribute.
+func (r HTTPRequestLog) LogAttr() slog.Attr {
+	return slog.Group(CloudHTTPRequestKey,
+		slog.String("requestMethod", r.Method),
+		slog.String("requestUrl", r.URL),
+		slog.String("requestSize", strconv.FormatInt(r.RequestSize, 10)),
+		slog.Int("status", r.Status),
+		slog.String("responseSize", strconv.FormatInt(r.ResponseSize, 10)),
+		slog.String("userAgent", r.UserAgent),
+		slog.String("remoteIp", r.RemoteIP),
+		slog.String("referer", r.Referer),
+		slog.String("protocol", r.Protocol),
+		// Cloud Logging reads the latency as a protobuf Duration, seconds with a trailing s
+		slog.String("latency", strconv.FormatFloat(r.Latency.Seconds(), 'f', 9, 64)+"s"),
+	)
+}
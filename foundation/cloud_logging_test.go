@@ -0,0 +1,95 @@
+package foundation_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func Test_CloudLoggingFormat(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(foundation.CloudLoggingEncoderConfig()), zapcore.AddSync(&buf), zapcore.DebugLevel)
+	logger := foundation.NewZapLogger(zap.New(foundation.WrapCloudLoggingCore(core), zap.AddCaller()))
+
+	ctx := foundation.ContextWithTrace(context.Background(), "monorepo", foundation.TraceContext{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+		Sampled: true,
+	})
+	logger.WarnContext(ctx, "slow request")
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "WARNING", got["severity"])
+	assert.Equal(t, "slow request", got["message"])
+	assert.Equal(t, "projects/monorepo/traces/4bf92f3577b34da6a3ce929d0e0e4736", got[foundation.CloudTraceKey])
+	assert.Equal(t, "00f067aa0ba902b7", got[foundation.CloudSpanIDKey])
+	assert.Equal(t, true, got[foundation.CloudTraceSampledKey])
+	require.IsType(t, map[string]interface{}{}, got[foundation.CloudSourceLocationKey])
+	location := got[foundation.CloudSourceLocationKey].(map[string]interface{})
+	assert.Equal(t, "cloud_logging_test.go", filepath.Base(location["file"].(string)))
+	assert.Contains(t, location["function"], "Test_CloudLoggingFormat")
+	assert.NotContains(t, got, "caller")
+}
+
+func Test_TraceContextFromHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		givenKey  string
+		givenVal  string
+		wantTrace foundation.TraceContext
+		wantOK    bool
+	}{
+		{
+			name:      "traceparent",
+			givenKey:  "traceparent",
+			givenVal:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantTrace: foundation.TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true},
+			wantOK:    true,
+		},
+		{
+			name:      "cloud trace context",
+			givenKey:  "X-Cloud-Trace-Context",
+			givenVal:  "105445aa7843bc8bf206b12000100000/1;o=1",
+			wantTrace: foundation.TraceContext{TraceID: "105445aa7843bc8bf206b12000100000", SpanID: "0000000000000001", Sampled: true},
+			wantOK:    true,
+		},
+		{
+			name:      "cloud trace context without span",
+			givenKey:  "X-Cloud-Trace-Context",
+			givenVal:  "105445aa7843bc8bf206b12000100000",
+			wantTrace: foundation.TraceContext{TraceID: "105445aa7843bc8bf206b12000100000"},
+			wantOK:    true,
+		},
+		{
+			name:     "invalid",
+			givenKey: "traceparent",
+			givenVal: "00-not-a-trace-01",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			header := http.Header{}
+			header.Set(tc.givenKey, tc.givenVal)
+			got, ok := foundation.TraceContextFromHeaders(header)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.wantTrace, got)
+		})
+	}
+}
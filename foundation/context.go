@@ -1,17 +1,28 @@
 package foundation
 
 import (
+	"context"
+
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
 const (
+	ClaimsKey    = "claims"
 	I18nKey      = "i18n"
 	LoggerKey    = "foundationLogger"
 	RequestIDKey = "requestID"
+	TenantKey    = "tenant"
 	TxKey        = "tx"
 )
 
+// RequestIDLogField is the log field the HTTP and gRPC loggers put the request ID in.
+const RequestIDLogField = "request_id"
+
+// contextKey namespaces the values foundation stores in a context.Context, where there is no gin.Context to
+// hold them, such as gRPC handlers.
+type contextKey string
+
 type BuffaloValidateError interface {
 	Error() string
 	String() string
@@ -20,7 +31,7 @@ type BuffaloValidateError interface {
 
 func AbortWithError(c *gin.Context, code int, err error) *gin.Error {
 	hashmap := gin.H{
-		"request_id": RequestIDFrom(c),
+		RequestIDLogField: RequestIDFrom(c),
 	}
 	if _, ok := err.(BuffaloValidateError); ok {
 		hashmap["validate"] = err
@@ -41,6 +52,22 @@ func LoggerFrom(c *gin.Context) Logger {
 	return defaultLogger
 }
 
+// ClaimsFrom returns the claims of the validated bearer token, if the request was authenticated with one.
+func ClaimsFrom(c *gin.Context) (claims *Claims, ok bool) {
+	if maybeClaims, exists := c.Get(ClaimsKey); exists {
+		claims, ok = maybeClaims.(*Claims)
+	}
+	return
+}
+
+// TenantFrom returns the tenant resolved by the Tenant middleware from the request's subdomain.
+func TenantFrom(c *gin.Context) (tenant *Tenant, ok bool) {
+	if maybeTenant, exists := c.Get(TenantKey); exists {
+		tenant, ok = maybeTenant.(*Tenant)
+	}
+	return
+}
+
 func RequestIDFrom(c *gin.Context) string {
 	return c.GetString(RequestIDKey)
 }
@@ -58,3 +85,50 @@ func TxMustFrom(c *gin.Context) *sqlx.Tx {
 	}
 	panic(`"` + TxKey + `" does not exist in context`)
 }
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey(RequestIDKey), requestID)
+}
+
+// RequestIDFromContext returns the request ID stored by ContextWithRequestID, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKey(RequestIDKey)).(string)
+	return requestID
+}
+
+// ContextWithLogger returns a copy of ctx carrying the request scoped logger.
+func ContextWithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, contextKey(LoggerKey), logger)
+}
+
+// LoggerFromContext returns the logger stored by ContextWithLogger, or a default logger.
+func LoggerFromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(contextKey(LoggerKey)).(Logger); ok {
+		return logger
+	}
+	defaultLogger, _ := NewDefaultLogger("")
+	return defaultLogger
+}
+
+// ContextWithClaims returns a copy of ctx carrying the validated token claims.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey(ClaimsKey), claims)
+}
+
+// ClaimsFromContext returns the claims stored by ContextWithClaims.
+func ClaimsFromContext(ctx context.Context) (claims *Claims, ok bool) {
+	claims, ok = ctx.Value(contextKey(ClaimsKey)).(*Claims)
+	return
+}
+
+// ContextWithTenant returns a copy of ctx carrying the tenant the request is served for.
+func ContextWithTenant(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey(TenantKey), tenant)
+}
+
+// TenantFromContext returns the tenant stored by ContextWithTenant.
+func TenantFromContext(ctx context.Context) (tenant *Tenant, ok bool) {
+	tenant, ok = ctx.Value(contextKey(TenantKey)).(*Tenant)
+	return
+}
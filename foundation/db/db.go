@@ -0,0 +1,153 @@
+// Package db opens the connection pools described by config.Config.DBConfigs, ties their lifecycle to a
+// foundation.Foundation and provides a middleware that runs each request in a transaction.
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.uber.org/zap"
+)
+
+// Pool is a named connection pool. It is a foundation.NamedProcessor: Start checks the database is reachable and
+// Stop closes the pool.
+type Pool struct {
+	name string
+	DB   *sqlx.DB
+}
+
+// NewPool wraps an already opened database.
+func NewPool(name string, db *sqlx.DB) *Pool {
+	return &Pool{name: name, DB: db}
+}
+
+// OpenPool opens a pool for conf. The driver is picked from the ConnectionURL scheme, see DriverName, and must be
+// registered by the application, ex. with a blank import of github.com/lib/pq. No connection is made until Start.
+func OpenPool(name string, conf config.DBConfig) (*Pool, error) {
+	driver, err := DriverName(conf.ConnectionURL)
+	if err != nil {
+		return nil, fmt.Errorf("[db] %s: %w", name, err)
+	}
+	db, err := sqlx.Open(driver, conf.ConnectionURL)
+	if err != nil {
+		return nil, fmt.Errorf("[db] %s: %w", name, err)
+	}
+	db.SetMaxIdleConns(conf.MaxIdleConns)
+	db.SetMaxOpenConns(conf.MaxOpenConns)
+	return NewPool(name, db), nil
+}
+
+// DriverName returns the database/sql driver for a connection URL. postgres:// and postgresql:// map to "postgres",
+// any other scheme is used as the driver name.
+func DriverName(connectionURL string) (string, error) {
+	// only the scheme is needed, and driver specific urls are not always valid url.URLs
+	scheme, _, found := strings.Cut(connectionURL, "://")
+	if !found || scheme == "" {
+		return "", errors.New("connection url has no scheme")
+	}
+	switch scheme {
+	case "postgres", "postgresql":
+		return "postgres", nil
+	}
+	return scheme, nil
+}
+
+func (p *Pool) Name() string {
+	return "db:" + p.name
+}
+
+func (p *Pool) Start(ctx context.Context) error {
+	return p.DB.PingContext(ctx)
+}
+
+func (p *Pool) Stop(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	return p.DB.Close()
+}
+
+// Getter returns the database of a use. *Pools implements it; packages that read a pool named in their own config,
+// ex. ratelimit and tenancy, accept a Getter so they can be tested without opening any.
+type Getter interface {
+	Get(name string) (*sqlx.DB, bool)
+}
+
+// Lookup returns the database of name in dbs, or an error when dbs is nil or has no such pool.
+func Lookup(dbs Getter, name string) (*sqlx.DB, error) {
+	if dbs == nil {
+		return nil, fmt.Errorf("[db] pool %q is not configured", name)
+	}
+	db, found := dbs.Get(name)
+	if !found {
+		return nil, fmt.Errorf("[db] pool %q is not configured", name)
+	}
+	return db, nil
+}
+
+// Pools holds the pools opened from config.Config.DBConfigs by use, ex. "main" and "readOnly".
+type Pools struct {
+	pools map[string]*Pool
+}
+
+// Open opens a pool for every config. Nothing is closed if one of them fails, as none of them has connected yet.
+func Open(configs map[string]config.DBConfig) (*Pools, error) {
+	pools := &Pools{pools: make(map[string]*Pool, len(configs))}
+	for name, conf := range configs {
+		pool, err := OpenPool(name, conf)
+		if err != nil {
+			return nil, err
+		}
+		pools.pools[name] = pool
+	}
+	return pools, nil
+}
+
+// Get returns the database for name.
+func (p *Pools) Get(name string) (*sqlx.DB, bool) {
+	pool, found := p.pools[name]
+	if !found {
+		return nil, false
+	}
+	return pool.DB, true
+}
+
+// MustGet returns the database for name and panics if it is not configured.
+func (p *Pools) MustGet(name string) *sqlx.DB {
+	db, found := p.Get(name)
+	if !found {
+		panic(`[db] pool "` + name + `" is not configured`)
+	}
+	return db
+}
+
+// Names returns the pool names, sorted.
+func (p *Pools) Names() []string {
+	names := make([]string, 0, len(p.pools))
+	for name := range p.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Register adds every pool to f as a processor named "db:<name>", so processors that need the database can
+// depend on it. Readiness reports each pool through the processor's own "processor:db:<name>" check. The pools'
+// connection stats are added to f.Metrics, labelled with db_name="<name>".
+func (p *Pools) Register(f *foundation.Foundation) {
+	for _, name := range p.Names() {
+		pool := p.pools[name]
+		f.AddProcessor(pool)
+		if f.Metrics != nil {
+			if err := f.Metrics.Register(collectors.NewDBStatsCollector(pool.DB.DB, name)); err != nil {
+				f.Logger.Warn("unable to register pool metrics", zap.String("pool", name), zap.Error(err))
+			}
+		}
+	}
+}
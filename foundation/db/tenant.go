@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// DefaultTenantDB is the pool used for tenants without their own database.
+const DefaultTenantDB = "main"
+
+// TenantTransactionConfig defines the config for TenantTransaction middleware.
+type TenantTransactionConfig struct {
+	// Pools the tenants' databases are picked from, by foundation.Tenant.DB.
+	Pools *Pools
+
+	// DefaultDB is the pool of tenants without a DB, ex. tenants split by schema in a shared database.
+	// Optional. Default value "main".
+	DefaultDB string
+
+	// TxOptions sets the isolation level and read only flag.
+	// Optional.
+	TxOptions *sql.TxOptions
+
+	// AllowMissingTenant runs requests without a tenant, ex. on middleware.TenantConfig.SkipPaths, in a transaction
+	// on DefaultDB with its own search_path. They are refused with a 500 otherwise.
+	// Optional.
+	AllowMissingTenant bool
+}
+
+// TenantTransaction returns a Transaction middleware whose transaction runs against the tenant of the request, set by
+// middleware.Tenant: on the pool named by foundation.Tenant.DB, with search_path set to foundation.Tenant.Schema
+// when it has one, so handlers query the tenant's tables through foundation.TxMustFrom without qualifying them.
+func TenantTransaction(pools *Pools) gin.HandlerFunc {
+	return TenantTransactionWithConfig(TenantTransactionConfig{Pools: pools})
+}
+
+// TenantTransactionWithConfig returns a TenantTransaction middleware with config. It must come after the Tenant
+// middleware. Requests of a tenant whose pool is not configured fail with a 500.
+func TenantTransactionWithConfig(conf TenantTransactionConfig) gin.HandlerFunc {
+	if conf.DefaultDB == "" {
+		conf.DefaultDB = DefaultTenantDB
+	}
+	return transaction(func(c *gin.Context) (*sqlx.DB, string, bool) {
+		tenant, found := foundation.TenantFrom(c)
+		if !found && !conf.AllowMissingTenant {
+			foundation.LoggerFrom(c).Error("tenant transaction without a tenant, is the Tenant middleware missing?")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Unable to begin transaction"})
+			return nil, "", false
+		}
+		name, schema := conf.DefaultDB, ""
+		if found {
+			if tenant.DB != "" {
+				name = tenant.DB
+			}
+			schema = tenant.Schema
+		}
+		db, ok := conf.Pools.Get(name)
+		if !ok {
+			foundation.LoggerFrom(c).Error("tenant pool is not configured", zap.String("pool", name))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Unable to begin transaction"})
+			return nil, "", false
+		}
+		return db, schema, true
+	}, conf.TxOptions)
+}
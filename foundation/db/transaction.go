@@ -0,0 +1,193 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// TransactionConfig defines the config for Transaction middleware.
+type TransactionConfig struct {
+	// DB the transaction is started on.
+	DB *sqlx.DB
+
+	// TxOptions sets the isolation level and read only flag.
+	// Optional.
+	TxOptions *sql.TxOptions
+}
+
+// Transaction returns a middleware that begins a transaction per request, available to handlers through
+// foundation.TxFrom and foundation.TxMustFrom.
+func Transaction(db *sqlx.DB) gin.HandlerFunc {
+	return TransactionWithConfig(TransactionConfig{DB: db})
+}
+
+// TransactionWithConfig returns a Transaction middleware with config. The transaction is committed when the
+// handlers respond with a 2xx status and recorded no errors, and rolled back otherwise, including when a handler
+// panics, in which case the panic carries on to the Recovery middleware.
+//
+// The response is held back until the transaction ends, so a failed commit replaces whatever the handlers wrote with
+// a 500 instead of reporting a write that was lost. Handlers that stream their response should not run in one.
+//
+// The transaction is recorded as a db.transaction span, with commit and rollback events, under the request span.
+func TransactionWithConfig(conf TransactionConfig) gin.HandlerFunc {
+	return transaction(func(*gin.Context) (*sqlx.DB, string, bool) {
+		return conf.DB, "", true
+	}, conf.TxOptions)
+}
+
+// pickFunc returns the database of a request and the schema its transaction runs in, empty for the database's own
+// search_path. It aborts the request and reports false when there is none.
+type pickFunc func(c *gin.Context) (db *sqlx.DB, schema string, ok bool)
+
+func transaction(pick pickFunc, txOptions *sql.TxOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db, schema, ok := pick(c)
+		if !ok {
+			return
+		}
+		logger := foundation.LoggerFrom(c)
+		// a child of the request span, when the request is traced
+		ctx, span := foundation.TracerFromContext(c.Request.Context()).Start(c.Request.Context(), "db.transaction",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemKey.String(dbSystem(db))),
+		)
+		defer span.End()
+		tx, err := db.BeginTxx(ctx, txOptions)
+		if err != nil {
+			logger.Error("failed to begin transaction", zap.Error(err))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "begin")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Unable to begin transaction"})
+			return
+		}
+		if schema != "" {
+			span.SetAttributes(attribute.String("db.schema", schema))
+			// SET LOCAL only lasts until the end of the transaction, the pooled connection keeps its own search_path
+			if _, err := tx.ExecContext(ctx, "SET LOCAL search_path TO "+QuoteIdentifier(schema)+", public"); err != nil {
+				logger.Error("failed to set search_path", zap.Error(err), zap.String("schema", schema))
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "search_path")
+				_ = tx.Rollback()
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Unable to begin transaction"})
+				return
+			}
+		}
+		c.Set(foundation.TxKey, tx)
+
+		buffer := &bufferedWriter{ResponseWriter: c.Writer, status: c.Writer.Status(), size: -1}
+		c.Writer = buffer
+		committed := false
+		defer func() {
+			// a panic skips the flush, so the Recovery middleware writes its own response
+			c.Writer = buffer.ResponseWriter
+			if committed {
+				return
+			}
+			span.AddEvent("rollback")
+			if err := tx.Rollback(); err != nil {
+				logger.Error("failed to roll back transaction", zap.Error(err))
+				span.RecordError(err)
+			}
+		}()
+
+		c.Next()
+
+		c.Writer = buffer.ResponseWriter
+		status := buffer.status
+		if status < http.StatusOK || status >= http.StatusMultipleChoices || len(c.Errors) > 0 {
+			buffer.flush()
+			return
+		}
+		committed = true
+		span.AddEvent("commit")
+		if err := tx.Commit(); err != nil {
+			logger.Error("failed to commit transaction", zap.Error(err), zap.Int("status_code", status))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "commit")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Unable to commit transaction"})
+			return
+		}
+		buffer.flush()
+	}
+}
+
+// bufferedWriter holds the response of the handlers back until the transaction has ended. Headers are set on the
+// underlying writer straight away, they are only sent with the status on flush.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	size   int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.Written() {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+	}
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	n, err := w.body.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.size
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.size != -1
+}
+
+// Flush does nothing, the response is flushed once the transaction has ended.
+func (w *bufferedWriter) Flush() {}
+
+// flush sends the held back status and body to the underlying writer.
+func (w *bufferedWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.Written() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
+
+func dbSystem(db *sqlx.DB) string {
+	if system := db.DriverName(); system != "postgres" {
+		return system
+	}
+	return semconv.DBSystemPostgreSQL.Value.AsString()
+}
+
+// QuoteIdentifier quotes a schema, table or column name for Postgres, doubling any double quote it contains.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -46,3 +46,23 @@ func (c *ContextErrors) Is(target error) bool {
 	}
 	return false
 }
+
+// PermanentError marks a failure that retrying cannot fix. A processor whose Start returns one, or whose Done channel
+// receives one, is marked failed straight away, ex. a migration that left the database dirty, and a pubsub message
+// whose handler returns one is dead-lettered instead of redelivered.
+type PermanentError struct {
+	Err error
+}
+
+// Permanent wraps err in a PermanentError.
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
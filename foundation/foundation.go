@@ -14,8 +14,13 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/soheilhy/cmux"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 )
 
 type Foundation struct {
@@ -23,12 +28,19 @@ type Foundation struct {
 	ShutdownWaitTime            time.Duration
 	HTTPRouter                  *gin.Engine
 	HTTPServer                  *http.Server
+	AdminMux                    *http.ServeMux
+	AdminServer                 *http.Server
 	GRPCServer                  *grpc.Server
 	StopOnProcessorStartFailure bool
 	ShutdownWait                time.Duration
 	Logger                      Logger
+	Health                      *Health
+	GRPCClients                 *GRPCClients
+	Tracing                     *Tracing
+	Metrics                     *Metrics
 	ctx                         context.Context
-	processors                  []Processor
+	supervisor                  *supervisor
+	gateway                     *gateway
 	startopOpts                 Options
 }
 
@@ -38,38 +50,85 @@ type Foundation struct {
 // - Environment: development
 // - Port: 3000
 // - ShutdownWait: 30 seconds
+// - ReadinessDrainWait: 5 seconds, none in development and test
 // - WriteTimeout: 15 seconds
 // - ReadTimeout: 15 seconds
 // - IdleTimeout: 60 seconds
+//
+// The HTTP router always serves /healthz, /readyz and /livez, and the gRPC server, when started, registers the
+// standard grpc.health.v1.Health service. Both are driven by the checks registered on Foundation.Health.
+//
+// Downstream connections configured in GRPCClients are available from Foundation.GRPCClients and closed on
+// shutdown. Each has a "grpc:<name>" readiness check that fails while its connection is in TRANSIENT_FAILURE.
+//
+// With GRPCGateway set, methods annotated with google.api.http are also served as JSON on the HTTP router, see
+// MountGRPCGateway.
+//
+// With an exporter in Tracing, HTTP requests, gRPC calls served and calls made through GRPCClients are traced with
+// OpenTelemetry and the trace context is propagated as W3C traceparent. The provider also becomes the otel global
+// and is flushed on shutdown.
+//
+// Requests to the router and gRPC server are recorded in Foundation.Metrics, along with the state of the
+// processors. With an AdminPort, an admin server serves them on /metrics, along with the health checks, pprof, the
+// build info, the processors' state and a log level toggle, see Foundation.AdminMux. It listens on localhost unless
+// an AdminToken is set.
 func New(opts Options) *Foundation {
 	opts = opts.ValuesOrDefaults()
 	gin.SetMode(opts.Mode())
 
+	tracing, err := NewTracing(context.Background(), opts.Tracing)
+	if err != nil {
+		// a broken exporter costs the traces, not the service
+		opts.Logger.Error("[foundation] tracing disabled", zap.Error(err))
+		tracing, _ = NewTracing(context.Background(), TracingOptions{})
+	}
 	router := gin.New()
-	return &Foundation{
-		Environment: opts.Environment,
-		HTTPRouter:  router,
+	health := NewHealth()
+	health.RegisterRoutes(router)
+	// registered after the probes, which would only add noise to the traces and metrics
+	if tracing.Enabled() {
+		tracing.SetGlobal()
+		router.Use(HTTPTracing(tracing))
+	}
+	metrics := NewMetrics()
+	router.Use(HTTPMetrics(metrics))
+	adminMux := http.NewServeMux()
+
+	f := &Foundation{
+		Environment:                 opts.Environment,
+		StopOnProcessorStartFailure: opts.StopOnProcessorStartFailure,
+		HTTPRouter:                  router,
 		HTTPServer: func(runHTTP bool, router *gin.Engine, opts Options) *http.Server {
 			if !runHTTP {
 				return nil
 			}
+			var handler http.Handler = router
+			if opts.Multiplex {
+				// accept HTTP/2 without TLS for clients that share the port with gRPC
+				handler = h2c.NewHandler(router, &http2.Server{})
+			}
 			return &http.Server{
 				Addr:           fmt.Sprintf("0.0.0.0:%s", opts.HTTPPort),
 				WriteTimeout:   opts.WriteTimeout,
 				ReadTimeout:    opts.ReadTimeout,
 				IdleTimeout:    opts.IdleTimeout,
-				Handler:        router,
+				Handler:        handler,
 				MaxHeaderBytes: 1 << 20,
 			}
 		}(opts.StartHTTPServer, router, opts),
+		AdminMux:    adminMux,
+		AdminServer: newAdminServer(opts, adminMux),
 		GRPCServer: func(runGRPC bool) *grpc.Server {
 			if !runGRPC {
 				return nil
 			}
-			if opts.GRPCUnaryInterceptor != nil {
-				return grpc.NewServer(withServerUnaryInterceptors(opts.GRPCUnaryInterceptor))
+			serverOpts := serverInterceptors(opts, tracing, metrics)
+			if opts.GRPCIdleTimeout > 0 {
+				serverOpts = append(serverOpts, grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionIdle: opts.GRPCIdleTimeout}))
 			}
-			return grpc.NewServer()
+			server := grpc.NewServer(serverOpts...)
+			healthpb.RegisterHealthServer(server, health.GRPCServer())
+			return server
 		}(opts.StartGRPCServer),
 		Logger: func(optLog Logger) Logger {
 			if optLog == nil {
@@ -81,24 +140,73 @@ func New(opts Options) *Foundation {
 			}
 			return optLog
 		}(opts.Logger),
-		startopOpts: opts,
+		ShutdownWait:     opts.ShutdownWait,
+		ShutdownWaitTime: opts.ShutdownWait,
+		Health:           health,
+		Tracing:          tracing,
+		Metrics:          metrics,
+		startopOpts:      opts,
 	}
+	f.supervisor = newSupervisor(f.Logger, opts)
+	f.GRPCClients = NewGRPCClients(f.Logger, opts.GRPCClients)
+	f.GRPCClients.tracing = tracing
+	f.GRPCClients.registerHealthChecks(health)
+	metrics.Registry.MustRegister(newProcessorCollector(f.ProcessorStatuses))
+	f.registerAdminHandlers(adminMux, opts.LogLevel)
+	return f
 }
 
-func withServerUnaryInterceptors(interceptor grpc.UnaryServerInterceptor) grpc.ServerOption {
-	return grpc.UnaryInterceptor(interceptor)
+// serverInterceptors chains the configured interceptors. The single GRPCUnaryInterceptor runs first so existing
+// callers keep their behaviour, after tracing and metrics so they cover every interceptor.
+func serverInterceptors(opts Options, tracing *Tracing, metrics *Metrics) []grpc.ServerOption {
+	unary := opts.GRPCUnaryInterceptors
+	if opts.GRPCUnaryInterceptor != nil {
+		unary = append([]grpc.UnaryServerInterceptor{opts.GRPCUnaryInterceptor}, unary...)
+	}
+	stream := opts.GRPCStreamInterceptors
+	unary = append([]grpc.UnaryServerInterceptor{UnaryServerMetrics(metrics)}, unary...)
+	stream = append([]grpc.StreamServerInterceptor{StreamServerMetrics(metrics)}, stream...)
+	if tracing.Enabled() {
+		unary = append([]grpc.UnaryServerInterceptor{UnaryServerTracing(tracing)}, unary...)
+		stream = append([]grpc.StreamServerInterceptor{StreamServerTracing(tracing)}, stream...)
+	}
+	var serverOpts []grpc.ServerOption
+	if len(unary) > 0 {
+		serverOpts = append(serverOpts, grpc.ChainUnaryInterceptor(unary...))
+	}
+	if len(stream) > 0 {
+		serverOpts = append(serverOpts, grpc.ChainStreamInterceptor(stream...))
+	}
+	return serverOpts
 }
 
 // Serve starts the foundation server and your app.
 // func (f *Foundation) Serve(quit <-chan os.Signal) error {
 func (f *Foundation) RunWithContext(ctx context.Context, stop context.CancelFunc) error {
-	if errs := f.StartProcessors(); len(errs) > 0 {
+	if f.startopOpts.GRPCGateway {
+		if err := f.MountGRPCGateway(); err != nil {
+			return err
+		}
+	}
+
+	if errs := f.StartProcessors(ctx); len(errs) > 0 {
 		if f.StopOnProcessorStartFailure {
+			var wg sync.WaitGroup
+			f.StopProcessors(&wg)
+			wg.Wait()
 			return errors.New("[foundation] ERROR: foundation failed to start one or more attached processors. StopOnProcessorStartFailure setting is true")
 		}
 	}
 
-	if f.GRPCServer != nil {
+	var mux cmux.CMux
+	if f.multiplexed() {
+		var err error
+		if mux, err = f.serveMultiplexed(stop); err != nil {
+			return err
+		}
+	}
+
+	if f.GRPCServer != nil && !f.multiplexed() {
 		go func(port string) {
 			f.Logger.Info("grpc server starting", zap.String("port", port))
 			listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", port))
@@ -113,13 +221,18 @@ func (f *Foundation) RunWithContext(ctx context.Context, stop context.CancelFunc
 		}(f.startopOpts.GRPCPort)
 	}
 
-	if f.HTTPServer != nil {
+	if f.AdminServer != nil {
+		f.serveAdmin(stop)
+	}
+
+	if f.HTTPServer != nil && !f.multiplexed() {
 		go func() {
 			f.Logger.Info("http server starting", zap.String("tcpAddress", f.HTTPServer.Addr))
 			if err := f.HTTPServer.ListenAndServe(); err != nil {
-				if !errors.Is(err, http.ErrServerClosed) {
-					stop()
+				if errors.Is(err, http.ErrServerClosed) {
+					return
 				}
+				stop()
 				f.Logger.Fatal("http server failed to start", zap.Error(err), zap.String("tcpAddress", f.HTTPServer.Addr))
 			}
 			f.Logger.Info("http server started", zap.String("tcpAddress", f.HTTPServer.Addr))
@@ -130,6 +243,13 @@ func (f *Foundation) RunWithContext(ctx context.Context, stop context.CancelFunc
 	<-ctx.Done()
 	f.Logger.Info("shutting down server")
 
+	// Fail readiness first so load balancers drain this instance before the servers stop accepting requests.
+	f.Health.SetShuttingDown()
+	if f.startopOpts.ReadinessDrainWait > 0 {
+		f.Logger.Info("waiting for load balancers to drain", zap.Duration("readinessDrainWait", f.startopOpts.ReadinessDrainWait))
+		time.Sleep(f.startopOpts.ReadinessDrainWait)
+	}
+
 	var wg sync.WaitGroup
 	if errs := f.StopProcessors(&wg); len(errs) > 0 {
 		f.Logger.Info("foundation failed to gracefully shutdown one or more attached processors", zap.Errors("errors", errs))
@@ -137,12 +257,28 @@ func (f *Foundation) RunWithContext(ctx context.Context, stop context.CancelFunc
 	wg.Wait()
 
 	// Create a deadline to wait for.
-	ctx, cancel := context.WithTimeout(context.Background(), f.ShutdownWait)
+	shutdownWait := f.ShutdownWait
+	if shutdownWait <= 0 {
+		shutdownWait = f.startopOpts.ValuesOrDefaults().ShutdownWait
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownWait)
 	defer cancel()
 
 	if f.GRPCServer != nil {
-		f.Logger.Info("shutting down grpc server")
-		f.GRPCServer.GracefulStop()
+		f.Logger.Info("shutting down grpc server", zap.Duration("shutdownWait", shutdownWait))
+		stopped := make(chan struct{})
+		go func() {
+			f.GRPCServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			f.Logger.Warn("grpc server did not stop within the shutdown wait, closing its connections")
+			f.GRPCServer.Stop()
+			<-stopped
+		}
+		f.closeGateway()
 	}
 	if f.HTTPServer != nil {
 		f.Logger.Info("shutting down http server")
@@ -150,6 +286,21 @@ func (f *Foundation) RunWithContext(ctx context.Context, stop context.CancelFunc
 			return err
 		}
 	}
+	if mux != nil {
+		mux.Close()
+	}
+	if f.AdminServer != nil {
+		// after the public servers, so metrics can be scraped while they drain
+		if err := f.AdminServer.Shutdown(ctx); err != nil {
+			f.Logger.Info("foundation failed to shut down the admin server", zap.Error(err))
+		}
+	}
+	if err := f.GRPCClients.Close(); err != nil {
+		f.Logger.Info("foundation failed to close one or more grpc clients", zap.Error(err))
+	}
+	if err := f.Tracing.Shutdown(ctx); err != nil {
+		f.Logger.Info("foundation failed to flush traces", zap.Error(err))
+	}
 
 	f.Logger.Info("foundation stopped")
 	return nil
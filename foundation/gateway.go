@@ -0,0 +1,625 @@
+package foundation
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DefaultGRPCGatewayMaxBodyBytes caps the gateway's request bodies when Options.GRPCGatewayMaxBodyBytes is not set,
+// the size gRPC servers accept by default.
+const DefaultGRPCGatewayMaxBodyBytes = 4 << 20
+
+// gatewayHeaders are always forwarded to gRPC handlers, on top of Options.GRPCGatewayHeaders.
+var gatewayHeaders = []string{"Authorization", "X-Request-ID"}
+
+// gateway transcodes JSON requests on HTTPRouter into calls on GRPCServer over an in-process connection, so
+// requests run through the same interceptors and handlers as native gRPC calls.
+type gateway struct {
+	conn         *grpc.ClientConn
+	headers      []string
+	maxBodyBytes int64
+	marshal      protojson.MarshalOptions
+	unmarshal    protojson.UnmarshalOptions
+}
+
+// gatewayRoute is a single google.api.http binding.
+type gatewayRoute struct {
+	fullMethod   string
+	method       protoreflect.MethodDescriptor
+	httpMethod   string
+	path         string
+	vars         []gatewayVar
+	body         string
+	responseBody protoreflect.FieldDescriptor
+}
+
+// gatewayVar binds the path segments captured by a template variable to a request field.
+type gatewayVar struct {
+	field []string
+	parts []gatewayPart
+}
+
+// gatewayPart is either a literal path segment or the name of the gin param that captured it.
+type gatewayPart struct {
+	literal  string
+	param    string
+	catchAll bool
+}
+
+// MountGRPCGateway adds a route to HTTPRouter for every google.api.http binding of the unary methods registered on
+// GRPCServer. Requests are decoded from the path, query and JSON body, forwarded with their Authorization and
+// X-Request-ID headers as metadata, and the response is written back as JSON.
+//
+// It must be called after every service has been registered on GRPCServer, as gRPC does not allow registering
+// services once the server is serving. RunWithContext calls it when Options.GRPCGateway is set.
+func (f *Foundation) MountGRPCGateway() error {
+	if f.gateway != nil {
+		return nil
+	}
+	if f.GRPCServer == nil {
+		return errors.New("[foundation] grpc gateway requires the grpc server, set StartGRPCServer")
+	}
+
+	routes, err := gatewayRoutes(f.GRPCServer, f.Logger)
+	if err != nil {
+		return err
+	}
+
+	listener := newInProcessListener()
+	go func() {
+		if err := f.GRPCServer.Serve(listener); err != nil {
+			f.Logger.Error("grpc gateway listener failed", zap.Error(err))
+		}
+	}()
+	dialOpts := []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if f.Tracing != nil && f.Tracing.Enabled() {
+		// continues the HTTP request's trace in the gRPC server span
+		dialOpts = append(dialOpts,
+			grpc.WithChainUnaryInterceptor(UnaryClientTracing(f.Tracing)),
+			grpc.WithChainStreamInterceptor(StreamClientTracing(f.Tracing)))
+	}
+	conn, err := grpc.DialContext(context.Background(), "passthrough:///inprocess", dialOpts...)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	maxBodyBytes := f.startopOpts.GRPCGatewayMaxBodyBytes
+	if maxBodyBytes == 0 {
+		maxBodyBytes = DefaultGRPCGatewayMaxBodyBytes
+	}
+	g := &gateway{
+		conn:         conn,
+		headers:      append(append([]string{}, gatewayHeaders...), f.startopOpts.GRPCGatewayHeaders...),
+		maxBodyBytes: maxBodyBytes,
+		marshal:      protojson.MarshalOptions{EmitUnpopulated: true},
+		unmarshal:    protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+	for _, route := range routes {
+		if err := g.register(f.HTTPRouter, route); err != nil {
+			conn.Close()
+			return err
+		}
+		f.Logger.Info("grpc gateway route mounted",
+			zap.String("method", route.httpMethod), zap.String("path", route.path), zap.String("grpc_method", route.fullMethod))
+	}
+	f.gateway = g
+	return nil
+}
+
+// closeGateway releases the in-process connection once GRPCServer has stopped.
+func (f *Foundation) closeGateway() {
+	if f.gateway != nil {
+		f.gateway.conn.Close()
+	}
+}
+
+// gatewayRoutes reads the google.api.http bindings of every service on server from the global proto registry.
+func gatewayRoutes(server *grpc.Server, logger Logger) ([]gatewayRoute, error) {
+	info := server.GetServiceInfo()
+	names := make([]string, 0, len(info))
+	for name := range info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var routes []gatewayRoute
+	for _, name := range names {
+		desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			logger.Warn("grpc gateway skipped service without a registered descriptor", zap.String("service", name))
+			continue
+		}
+		service, ok := desc.(protoreflect.ServiceDescriptor)
+		if !ok {
+			continue
+		}
+		methods := service.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			method := methods.Get(i)
+			rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+			if !ok || rule == nil {
+				continue
+			}
+			if method.IsStreamingClient() || method.IsStreamingServer() {
+				logger.Warn("grpc gateway skipped streaming method", zap.String("grpc_method", string(method.FullName())))
+				continue
+			}
+			for _, binding := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+				route, err := newGatewayRoute(method, binding)
+				if err != nil {
+					return nil, fmt.Errorf("[foundation] grpc gateway %s: %w", method.FullName(), err)
+				}
+				routes = append(routes, route)
+			}
+		}
+	}
+	return routes, nil
+}
+
+func newGatewayRoute(method protoreflect.MethodDescriptor, rule *annotations.HttpRule) (gatewayRoute, error) {
+	route := gatewayRoute{
+		fullMethod: fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name()),
+		method:     method,
+		body:       rule.GetBody(),
+	}
+
+	var template string
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		route.httpMethod, template = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		route.httpMethod, template = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		route.httpMethod, template = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		route.httpMethod, template = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		route.httpMethod, template = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		route.httpMethod, template = strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return route, errors.New("http rule has no pattern")
+	}
+
+	var err error
+	if route.path, route.vars, err = parsePathTemplate(template); err != nil {
+		return route, err
+	}
+	for _, v := range route.vars {
+		fd, err := lookupField(method.Input(), v.field)
+		if err != nil {
+			return route, err
+		}
+		if fd.IsList() || fd.IsMap() || fd.Kind() == protoreflect.MessageKind {
+			return route, fmt.Errorf("path variable %q must be a scalar field", strings.Join(v.field, "."))
+		}
+	}
+	if route.body != "" && route.body != "*" {
+		if method.Input().Fields().ByName(protoreflect.Name(route.body)) == nil {
+			return route, fmt.Errorf("unknown body field %q", route.body)
+		}
+	}
+	if name := rule.GetResponseBody(); name != "" {
+		fd := method.Output().Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return route, fmt.Errorf("response body %q must be a message field", name)
+		}
+		route.responseBody = fd
+	}
+	return route, nil
+}
+
+// parsePathTemplate converts a google.api.http path template into a gin path. Wildcards are named after their
+// segment position so that routes sharing a prefix use the same param names, which gin requires. Custom verbs
+// (/v1/things:verb) are not supported as gin treats the colon as a param.
+func parsePathTemplate(template string) (string, []gatewayVar, error) {
+	if !strings.HasPrefix(template, "/") {
+		return "", nil, fmt.Errorf("path template %q must start with /", template)
+	}
+
+	var segments []string
+	var vars []gatewayVar
+	position := 0
+	capture := func(pattern string) (gatewayPart, error) {
+		defer func() { position++ }()
+		name := "p" + strconv.Itoa(position)
+		switch {
+		case pattern == "*":
+			segments = append(segments, ":"+name)
+			return gatewayPart{param: name}, nil
+		case pattern == "**":
+			segments = append(segments, "*"+name)
+			return gatewayPart{param: name, catchAll: true}, nil
+		case pattern == "" || strings.ContainsAny(pattern, ":{}*"):
+			return gatewayPart{}, fmt.Errorf("path template %q: unsupported segment %q", template, pattern)
+		}
+		segments = append(segments, pattern)
+		return gatewayPart{literal: pattern}, nil
+	}
+
+	for _, segment := range splitTemplate(template[1:]) {
+		if !strings.HasPrefix(segment, "{") {
+			if _, err := capture(segment); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+		if !strings.HasSuffix(segment, "}") {
+			return "", nil, fmt.Errorf("path template %q: unsupported segment %q", template, segment)
+		}
+		field, pattern, found := strings.Cut(segment[1:len(segment)-1], "=")
+		if !found {
+			pattern = "*"
+		}
+		v := gatewayVar{field: strings.Split(field, ".")}
+		for _, sub := range strings.Split(pattern, "/") {
+			part, err := capture(sub)
+			if err != nil {
+				return "", nil, err
+			}
+			v.parts = append(v.parts, part)
+		}
+		vars = append(vars, v)
+	}
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "*") && i != len(segments)-1 {
+			return "", nil, fmt.Errorf("path template %q: ** must be the last segment", template)
+		}
+	}
+	return "/" + strings.Join(segments, "/"), vars, nil
+}
+
+// splitTemplate splits on the slashes outside of {variables}.
+func splitTemplate(template string) []string {
+	var segments []string
+	depth, start := 0, 0
+	for i, r := range template {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				segments = append(segments, template[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, template[start:])
+}
+
+// register adds the route to router, turning gin's conflicting route panics into an error.
+func (g *gateway) register(router gin.IRoutes, route gatewayRoute) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("[foundation] grpc gateway %s %s: %v", route.httpMethod, route.path, r)
+		}
+	}()
+	router.Handle(route.httpMethod, route.path, g.handle(route))
+	return nil
+}
+
+func (g *gateway) handle(route gatewayRoute) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := dynamicpb.NewMessage(route.method.Input())
+		if err := g.decode(c, route, req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				g.writeErrorWithStatus(c, http.StatusRequestEntityTooLarge,
+					status.Errorf(codes.ResourceExhausted, "request body larger than %d bytes", tooLarge.Limit))
+				return
+			}
+			g.writeError(c, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+
+		ctx := metadata.NewOutgoingContext(c.Request.Context(), g.metadata(c))
+		resp := dynamicpb.NewMessage(route.method.Output())
+		if err := g.conn.Invoke(ctx, route.fullMethod, req, resp); err != nil {
+			g.writeError(c, err)
+			return
+		}
+
+		var out proto.Message = resp
+		if route.responseBody != nil {
+			out = resp.Get(route.responseBody).Message().Interface()
+		}
+		body, err := g.marshal.Marshal(out)
+		if err != nil {
+			g.writeError(c, status.Error(codes.Internal, err.Error()))
+			return
+		}
+		c.Data(http.StatusOK, "application/json", body)
+	}
+}
+
+// metadata forwards the configured headers. The request ID set by the RequestID middleware wins over the header,
+// and the tenant resolved by the Tenant middleware is forwarded too.
+func (g *gateway) metadata(c *gin.Context) metadata.MD {
+	md := metadata.MD{}
+	for _, header := range g.headers {
+		if values := c.Request.Header.Values(header); len(values) > 0 {
+			md.Set(header, values...)
+		}
+	}
+	if requestID := RequestIDFrom(c); requestID != "" {
+		md.Set("x-request-id", requestID)
+	}
+	// only the tenant resolved from the host is trusted, never one the client sent
+	md.Delete(TenantMetadataKey)
+	if tenant, ok := TenantFrom(c); ok && tenant.ID != "" {
+		md.Set(TenantMetadataKey, tenant.ID)
+	}
+	return md
+}
+
+// decode fills req from the body, then the path variables and finally, when the body is not bound to the whole
+// request, the query string.
+func (g *gateway) decode(c *gin.Context, route gatewayRoute, req *dynamicpb.Message) error {
+	if route.body != "" {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, g.maxBodyBytes))
+		if err != nil {
+			return err
+		}
+		if len(body) > 0 {
+			if route.body == "*" {
+				if err := g.unmarshal.Unmarshal(body, req); err != nil {
+					return err
+				}
+			} else {
+				// wrap the body in its field so protojson handles messages, lists and scalars alike
+				fd := req.Descriptor().Fields().ByName(protoreflect.Name(route.body))
+				wrapped := append([]byte(`{"`+fd.JSONName()+`":`), body...)
+				wrapped = append(wrapped, '}')
+				partial := dynamicpb.NewMessage(route.method.Input())
+				if err := g.unmarshal.Unmarshal(wrapped, partial); err != nil {
+					return err
+				}
+				proto.Merge(req, partial)
+			}
+		}
+	}
+
+	bound := map[string]bool{route.body: true}
+	for _, v := range route.vars {
+		values := make([]string, len(v.parts))
+		for i, part := range v.parts {
+			switch {
+			case part.literal != "":
+				values[i] = part.literal
+			case part.catchAll:
+				values[i] = strings.TrimPrefix(c.Param(part.param), "/")
+			default:
+				values[i] = c.Param(part.param)
+			}
+		}
+		if err := setField(req, v.field, []string{strings.Join(values, "/")}); err != nil {
+			return err
+		}
+		bound[strings.Join(v.field, ".")] = true
+	}
+
+	if route.body == "*" {
+		return nil
+	}
+	for key, values := range c.Request.URL.Query() {
+		if bound[key] {
+			continue
+		}
+		if _, err := lookupField(route.method.Input(), strings.Split(key, ".")); err != nil {
+			// unknown parameters are ignored, as grpc-gateway does, so cache busters and the like still work
+			continue
+		}
+		if err := setField(req, strings.Split(key, "."), values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gateway) writeError(c *gin.Context, err error) {
+	g.writeErrorWithStatus(c, HTTPStatusFromCode(status.Code(err)), err)
+}
+
+func (g *gateway) writeErrorWithStatus(c *gin.Context, httpStatus int, err error) {
+	s := status.Convert(err)
+	body, marshalErr := g.marshal.Marshal(s.Proto())
+	if marshalErr != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": codes.Internal, "message": marshalErr.Error()})
+		return
+	}
+	c.Abort()
+	c.Data(httpStatus, "application/json", body)
+}
+
+// HTTPStatusFromCode maps a gRPC status code to the HTTP status the gateway responds with.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// lookupField resolves a dotted field path, accepting proto or JSON field names.
+func lookupField(desc protoreflect.MessageDescriptor, path []string) (protoreflect.FieldDescriptor, error) {
+	var fd protoreflect.FieldDescriptor
+	for i, name := range path {
+		if i > 0 {
+			if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+				return nil, fmt.Errorf("field %q is not a message", strings.Join(path[:i], "."))
+			}
+			desc = fd.Message()
+		}
+		if fd = desc.Fields().ByName(protoreflect.Name(name)); fd == nil {
+			fd = desc.Fields().ByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field %q", strings.Join(path[:i+1], "."))
+		}
+	}
+	return fd, nil
+}
+
+// setField parses values into the field at path, appending them all to repeated fields.
+func setField(msg protoreflect.Message, path []string, values []string) error {
+	fd, err := lookupField(msg.Descriptor(), path)
+	if err != nil {
+		return err
+	}
+	for _, name := range path[:len(path)-1] {
+		parent := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if parent == nil {
+			parent = msg.Descriptor().Fields().ByJSONName(name)
+		}
+		msg = msg.Mutable(parent).Message()
+	}
+	if fd.IsMap() {
+		return fmt.Errorf("field %q is a map and cannot be set from the url", strings.Join(path, "."))
+	}
+	if fd.IsList() {
+		list := msg.Mutable(fd).List()
+		for _, raw := range values {
+			value, err := parseValue(fd, raw)
+			if err != nil {
+				return err
+			}
+			list.Append(value)
+		}
+		return nil
+	}
+	value, err := parseValue(fd, values[len(values)-1])
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, value)
+	return nil
+}
+
+func parseValue(fd protoreflect.FieldDescriptor, raw string) (protoreflect.Value, error) {
+	invalid := func(err error) (protoreflect.Value, error) {
+		return protoreflect.Value{}, fmt.Errorf("invalid value %q for field %q: %w", raw, fd.Name(), err)
+	}
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(raw), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			if b, err = base64.URLEncoding.DecodeString(raw); err != nil {
+				return invalid(err)
+			}
+		}
+		return protoreflect.ValueOfBytes(b), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfBool(b), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfInt32(int32(n)), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfInt64(n), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfUint32(uint32(n)), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfUint64(n), nil
+	case protoreflect.FloatKind:
+		n, err := strconv.ParseFloat(raw, 32)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfFloat32(float32(n)), nil
+	case protoreflect.DoubleKind:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfFloat64(n), nil
+	case protoreflect.EnumKind:
+		if value := fd.Enum().Values().ByName(protoreflect.Name(raw)); value != nil {
+			return protoreflect.ValueOfEnum(value.Number()), nil
+		}
+		n, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		// well known types such as Timestamp, Duration and the wrappers have a JSON string or scalar form
+		msg := dynamicpb.NewMessage(fd.Message())
+		if err := protojson.Unmarshal([]byte(strconv.Quote(raw)), msg); err != nil {
+			if err := protojson.Unmarshal([]byte(raw), msg); err != nil {
+				return invalid(err)
+			}
+		}
+		return protoreflect.ValueOfMessage(msg), nil
+	}
+	return invalid(fmt.Errorf("unsupported kind %s", fd.Kind()))
+}
@@ -0,0 +1,307 @@
+package foundation_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var (
+	libraryOnce sync.Once
+	library     protoreflect.ServiceDescriptor
+)
+
+// libraryService registers, once per test binary, the equivalent of:
+//
+//	message Book { string name = 1; string title = 2; int32 pages = 3; }
+//	message GetBookRequest { string name = 1; bool full = 2; }
+//	message CreateBookRequest { string shelf = 1; Book book = 2; }
+//	service Library {
+//	  rpc GetBook(GetBookRequest) returns (Book) { option (google.api.http) = { get: "/v1/{name=shelves/*/books/*}" }; }
+//	  rpc CreateBook(CreateBookRequest) returns (Book) { option (google.api.http) = { post: "/v1/shelves/{shelf}/books" body: "book" }; }
+//	}
+func libraryService(t *testing.T) protoreflect.ServiceDescriptor {
+	libraryOnce.Do(func() {
+		field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+			f := &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String(name),
+				JsonName: proto.String(name),
+				Number:   proto.Int32(number),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     kind.Enum(),
+			}
+			if typeName != "" {
+				f.TypeName = proto.String(typeName)
+			}
+			return f
+		}
+		method := func(name, input string, rule *annotations.HttpRule) *descriptorpb.MethodDescriptorProto {
+			opts := &descriptorpb.MethodOptions{}
+			proto.SetExtension(opts, annotations.E_Http, rule)
+			return &descriptorpb.MethodDescriptorProto{
+				Name:       proto.String(name),
+				InputType:  proto.String(".foundation.test.v1." + input),
+				OutputType: proto.String(".foundation.test.v1.Book"),
+				Options:    opts,
+			}
+		}
+
+		file := &descriptorpb.FileDescriptorProto{
+			Name:       proto.String("foundation/test/v1/library.proto"),
+			Package:    proto.String("foundation.test.v1"),
+			Syntax:     proto.String("proto3"),
+			Dependency: []string{"google/api/annotations.proto"},
+			MessageType: []*descriptorpb.DescriptorProto{
+				{Name: proto.String("Book"), Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("title", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("pages", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				}},
+				{Name: proto.String("GetBookRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("full", 2, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+				}},
+				{Name: proto.String("CreateBookRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+					field("shelf", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("book", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".foundation.test.v1.Book"),
+				}},
+			},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Library"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					method("GetBook", "GetBookRequest", &annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=shelves/*/books/*}"},
+					}),
+					method("CreateBook", "CreateBookRequest", &annotations.HttpRule{
+						Pattern: &annotations.HttpRule_Post{Post: "/v1/shelves/{shelf}/books"},
+						Body:    "book",
+					}),
+				},
+			}},
+		}
+		fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+		if err != nil {
+			panic(err)
+		}
+		if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+			panic(err)
+		}
+		library = fd.Services().Get(0)
+	})
+	require.NotNil(t, library)
+	return library
+}
+
+// registerLibrary serves the Library service with dynamic messages: GetBook echoes the request and its metadata,
+// CreateBook returns the posted book on the requested shelf.
+func registerLibrary(t *testing.T, server *grpc.Server) {
+	service := libraryService(t)
+	unary := func(method protoreflect.MethodDescriptor, handle func(ctx context.Context, req *dynamicpb.Message) (*dynamicpb.Message, error)) grpc.MethodDesc {
+		return grpc.MethodDesc{
+			MethodName: string(method.Name()),
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := dynamicpb.NewMessage(method.Input())
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return handle(ctx, req.(*dynamicpb.Message))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{FullMethod: "/" + string(service.FullName()) + "/" + string(method.Name())}
+				return interceptor(ctx, req, info, handler)
+			},
+		}
+	}
+
+	getBook := service.Methods().ByName("GetBook")
+	createBook := service.Methods().ByName("CreateBook")
+	book := getBook.Output()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: string(service.FullName()),
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			unary(getBook, func(ctx context.Context, req *dynamicpb.Message) (*dynamicpb.Message, error) {
+				name := req.Get(getBook.Input().Fields().ByName("name")).String()
+				if strings.HasSuffix(name, "/missing") {
+					return nil, status.Error(codes.NotFound, "book not found")
+				}
+				md, _ := metadata.FromIncomingContext(ctx)
+				resp := dynamicpb.NewMessage(book)
+				resp.Set(book.Fields().ByName("name"), protoreflect.ValueOfString(name))
+				resp.Set(book.Fields().ByName("title"), protoreflect.ValueOfString(strings.Join(append(append(md.Get("authorization"), md.Get("x-request-id")...), md.Get(foundation.TenantMetadataKey)...), " ")))
+				if req.Get(getBook.Input().Fields().ByName("full")).Bool() {
+					resp.Set(book.Fields().ByName("pages"), protoreflect.ValueOfInt32(100))
+				}
+				return resp, nil
+			}),
+			unary(createBook, func(ctx context.Context, req *dynamicpb.Message) (*dynamicpb.Message, error) {
+				fields := createBook.Input().Fields()
+				resp := dynamicpb.NewMessage(book)
+				proto.Merge(resp, req.Get(fields.ByName("book")).Message().Interface())
+				resp.Set(book.Fields().ByName("name"), protoreflect.ValueOfString("shelves/"+req.Get(fields.ByName("shelf")).String()+"/books/1"))
+				return resp, nil
+			}),
+		},
+	}, struct{}{})
+}
+
+func Test_GRPCGateway(t *testing.T) {
+	t.Parallel()
+
+	var notInProcess atomic.Int32
+	f := foundation.New(foundation.Options{
+		Environment:             foundation.Test,
+		Logger:                  foundation.NewNopLogger(),
+		StartGRPCServer:         true,
+		GRPCGatewayMaxBodyBytes: 64,
+		GRPCGatewayHeaders:      []string{foundation.TenantMetadataKey},
+		GRPCUnaryInterceptors: []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if !foundation.IsInProcessCall(ctx) {
+					notInProcess.Add(1)
+				}
+				return handler(ctx, req)
+			},
+		},
+	})
+	registerLibrary(t, f.GRPCServer)
+	require.NoError(t, f.MountGRPCGateway())
+	t.Cleanup(func() {
+		f.GRPCServer.Stop()
+		assert.Zero(t, notInProcess.Load(), "gateway calls are in-process")
+	})
+
+	tests := []struct {
+		name       string
+		givenReq   *http.Request
+		wantStatus int
+		wantBody   map[string]interface{}
+	}{
+		{
+			name: "path variables and metadata",
+			givenReq: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/v1/shelves/7/books/42", nil)
+				req.Header.Set("Authorization", "Bearer token")
+				req.Header.Set("X-Request-ID", "abc-123")
+				return req
+			}(),
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]interface{}{"name": "shelves/7/books/42", "title": "Bearer token abc-123", "pages": float64(0)},
+		},
+		{
+			name: "tenant header from the client",
+			givenReq: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/v1/shelves/7/books/42", nil)
+				req.Header.Set(foundation.TenantMetadataKey, "t-9")
+				return req
+			}(),
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]interface{}{"name": "shelves/7/books/42", "title": "", "pages": float64(0)},
+		},
+		{
+			name:       "query parameters",
+			givenReq:   httptest.NewRequest(http.MethodGet, "/v1/shelves/7/books/42?full=true&utm_source=email", nil),
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]interface{}{"name": "shelves/7/books/42", "title": "", "pages": float64(100)},
+		},
+		{
+			name:       "invalid query parameter",
+			givenReq:   httptest.NewRequest(http.MethodGet, "/v1/shelves/7/books/42?full=maybe", nil),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "grpc error",
+			givenReq:   httptest.NewRequest(http.MethodGet, "/v1/shelves/7/books/missing", nil),
+			wantStatus: http.StatusNotFound,
+			wantBody:   map[string]interface{}{"code": float64(codes.NotFound), "message": "book not found", "details": []interface{}{}},
+		},
+		{
+			name:       "body field",
+			givenReq:   httptest.NewRequest(http.MethodPost, "/v1/shelves/7/books", strings.NewReader(`{"title":"Enter the Wu-Tang","pages":36}`)),
+			wantStatus: http.StatusOK,
+			wantBody:   map[string]interface{}{"name": "shelves/7/books/1", "title": "Enter the Wu-Tang", "pages": float64(36)},
+		},
+		{
+			name:       "body too large",
+			givenReq:   httptest.NewRequest(http.MethodPost, "/v1/shelves/7/books", strings.NewReader(`{"title":"`+strings.Repeat("C.R.E.A.M. ", 10)+`"}`)),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantBody:   map[string]interface{}{"code": float64(codes.ResourceExhausted), "message": "request body larger than 64 bytes", "details": []interface{}{}},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rr := httptest.NewRecorder()
+			f.HTTPRouter.ServeHTTP(rr, tc.givenReq)
+
+			assert.Equal(t, tc.wantStatus, rr.Code)
+			if tc.wantBody != nil {
+				var got map[string]interface{}
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+				assert.Equal(t, tc.wantBody, got)
+			}
+		})
+	}
+}
+
+func Test_GRPCGatewayContinuesTrace(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	f := foundation.New(foundation.Options{
+		Environment:     foundation.Test,
+		Logger:          foundation.NewNopLogger(),
+		StartGRPCServer: true,
+		Tracing:         foundation.TracingOptions{SpanExporter: exporter, Synchronous: true},
+	})
+	registerLibrary(t, f.GRPCServer)
+	require.NoError(t, f.MountGRPCGateway())
+	t.Cleanup(f.GRPCServer.Stop)
+
+	rr := httptest.NewRecorder()
+	f.HTTPRouter.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/shelves/7/books/42", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var httpSpan, grpcSpan tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		switch {
+		case span.SpanKind != trace.SpanKindServer:
+		case strings.HasPrefix(span.Name, http.MethodGet+" "):
+			httpSpan = span
+		default:
+			grpcSpan = span
+		}
+	}
+	require.True(t, httpSpan.SpanContext.IsValid())
+	require.True(t, grpcSpan.SpanContext.IsValid())
+	assert.Equal(t, httpSpan.SpanContext.TraceID(), grpcSpan.SpanContext.TraceID(), "the gRPC call continues the HTTP request's trace")
+	assert.True(t, grpcSpan.Parent.IsRemote())
+}
@@ -0,0 +1,448 @@
+package foundation
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrGRPCClientsClosed is returned by GRPCClients.Conn once the registry has been closed during shutdown.
+var ErrGRPCClientsClosed = errors.New("[foundation] grpc clients are closed")
+
+// GRPCClientOptions configures a downstream gRPC connection.
+type GRPCClientOptions struct {
+	// Target is the address dialed, ex. "orders.internal:443".
+	Target string
+
+	// TLS dials with the system root certificates instead of plain text.
+	TLS bool
+
+	// Credentials are attached to every call, see IDTokenCredentials and StaticTokenCredentials.
+	// Optional.
+	Credentials credentials.PerRPCCredentials
+
+	// Timeout is the deadline applied to calls whose context has none.
+	// Optional. Default value 10 seconds.
+	Timeout time.Duration
+
+	// MaxAttempts is the number of times a call failing with UNAVAILABLE is tried, including the first attempt.
+	// Optional. Default value 3.
+	MaxAttempts int
+
+	// Keepalive pings idle connections so dead peers are noticed before the next call.
+	// Optional. Default value a ping every 30 seconds with a 10 second timeout.
+	Keepalive keepalive.ClientParameters
+
+	// UnaryInterceptors and StreamInterceptors run after the tracing, request ID, tenant and logger interceptors.
+	// Optional.
+	UnaryInterceptors  []grpc.UnaryClientInterceptor
+	StreamInterceptors []grpc.StreamClientInterceptor
+
+	// DialOptions are appended last, so they override everything above.
+	// Optional.
+	DialOptions []grpc.DialOption
+}
+
+func (o GRPCClientOptions) valuesOrDefaults() GRPCClientOptions {
+	if o.Timeout == 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = 3
+	}
+	if o.Keepalive.Time == 0 {
+		o.Keepalive.Time = 30 * time.Second
+	}
+	if o.Keepalive.Timeout == 0 {
+		o.Keepalive.Timeout = 10 * time.Second
+	}
+	return o
+}
+
+// equal reports whether o and other, both with their defaults applied, dial the same connection. Credentials are
+// compared by what they send. Interceptors and dial options are functions, which cannot be compared, so options
+// holding any never equal others.
+func (o GRPCClientOptions) equal(other GRPCClientOptions) bool {
+	return o.Target == other.Target &&
+		o.TLS == other.TLS &&
+		o.Timeout == other.Timeout &&
+		o.MaxAttempts == other.MaxAttempts &&
+		o.Keepalive == other.Keepalive &&
+		equalCredentials(o.Credentials, other.Credentials) &&
+		len(o.UnaryInterceptors)+len(other.UnaryInterceptors) == 0 &&
+		len(o.StreamInterceptors)+len(other.StreamInterceptors) == 0 &&
+		len(o.DialOptions)+len(other.DialOptions) == 0
+}
+
+func equalCredentials(a, b credentials.PerRPCCredentials) bool {
+	switch a := a.(type) {
+	case *idTokenCredentials:
+		b, ok := b.(*idTokenCredentials)
+		return ok && a.audience == b.audience
+	case staticTokenCredentials:
+		b, ok := b.(staticTokenCredentials)
+		return ok && a == b
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// GRPCClientOptionsFromConfig builds the options for config.Config.GRPCClientConfigs. Clients with a
+// GoogleIAMAudience authenticate with an ID token for that audience, which Cloud Run only accepts over TLS.
+func GRPCClientOptionsFromConfig(configs map[string]config.ClientConfig) map[string]GRPCClientOptions {
+	options := make(map[string]GRPCClientOptions, len(configs))
+	for name, conf := range configs {
+		opts := GRPCClientOptions{
+			Target: net.JoinHostPort(conf.Host, conf.Port),
+			TLS:    conf.TLS || conf.GoogleIAMAudience != "",
+		}
+		switch {
+		case conf.GoogleIAMAudience != "":
+			opts.Credentials = IDTokenCredentials(conf.GoogleIAMAudience)
+		case conf.Token != "":
+			opts.Credentials = StaticTokenCredentials(conf.Token, opts.TLS)
+		}
+		options[name] = opts
+	}
+	return options
+}
+
+// GRPCClients is a registry of named downstream connections. Connections are dialed on first use and closed
+// together when the foundation shuts down.
+type GRPCClients struct {
+	logger  Logger
+	tracing *Tracing
+	health  *Health
+	mu      sync.Mutex
+	options map[string]GRPCClientOptions
+	conns   map[string]*grpc.ClientConn
+	checked map[string]bool
+	closed  bool
+}
+
+func NewGRPCClients(logger Logger, options map[string]GRPCClientOptions) *GRPCClients {
+	clients := &GRPCClients{
+		logger:  logger,
+		options: map[string]GRPCClientOptions{},
+		conns:   map[string]*grpc.ClientConn{},
+		checked: map[string]bool{},
+	}
+	for name, opts := range options {
+		clients.Add(name, opts)
+	}
+	return clients
+}
+
+// Add registers a client. Adding a name again replaces its options but not an already dialed connection.
+func (c *GRPCClients) Add(name string, opts GRPCClientOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.options[name] = opts.valuesOrDefaults()
+	c.addHealthCheckLocked(name)
+}
+
+// registerHealthChecks adds a readiness check named "grpc:<name>" to health for every client, now and as they are
+// added. New calls it with Foundation.Health.
+func (c *GRPCClients) registerHealthChecks(health *Health) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.health = health
+	for name := range c.options {
+		c.addHealthCheckLocked(name)
+	}
+}
+
+func (c *GRPCClients) addHealthCheckLocked(name string) {
+	if c.health == nil || c.checked[name] {
+		return
+	}
+	c.checked[name] = true
+	c.health.AddReadinessCheck("grpc:"+name, c.healthCheck(name))
+}
+
+// healthCheck fails while the connection of name is in TRANSIENT_FAILURE. Connections are dialed lazily, so a client
+// that was never used, or was removed by Update, passes.
+func (c *GRPCClients) healthCheck(name string) HealthCheck {
+	return func(context.Context) error {
+		c.mu.Lock()
+		conn, found := c.conns[name]
+		c.mu.Unlock()
+		if !found {
+			return nil
+		}
+		if state := conn.GetState(); state == connectivity.TransientFailure {
+			return errors.New(state.String())
+		}
+		return nil
+	}
+}
+
+// Update replaces every client's options, ex. on config reload. Clients missing from options are removed, and
+// connections whose options changed in any way, ex. a rotated token, are closed so the next Conn dials with the new
+// options. Calls in flight on a closed connection fail.
+func (c *GRPCClients) Update(options map[string]GRPCClientOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for name, conn := range c.conns {
+		previous := c.options[name]
+		next, found := options[name]
+		if found && next.valuesOrDefaults().equal(previous) {
+			continue
+		}
+		if err := conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("[foundation] grpc client %q: %w", name, err))
+		}
+		delete(c.conns, name)
+		c.logger.Info("grpc client closed for update", zap.String("client", name), zap.String("target", previous.Target))
+	}
+	c.options = make(map[string]GRPCClientOptions, len(options))
+	for name, opts := range options {
+		c.options[name] = opts.valuesOrDefaults()
+		c.addHealthCheckLocked(name)
+	}
+	return errors.Join(errs...)
+}
+
+// Names returns the registered client names, sorted.
+func (c *GRPCClients) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.options))
+	for name := range c.options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Conn returns the connection for name, dialing it on first use.
+func (c *GRPCClients) Conn(name string) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrGRPCClientsClosed
+	}
+	if conn, found := c.conns[name]; found {
+		return conn, nil
+	}
+	opts, found := c.options[name]
+	if !found {
+		return nil, fmt.Errorf("[foundation] grpc client %q is not configured", name)
+	}
+
+	conn, err := grpc.Dial(opts.Target, c.dialOptions(name, opts)...)
+	if err != nil {
+		return nil, fmt.Errorf("[foundation] grpc client %q: %w", name, err)
+	}
+	c.logger.Info("grpc client created", zap.String("client", name), zap.String("target", opts.Target))
+	c.conns[name] = conn
+	return conn, nil
+}
+
+// GRPCClient returns a typed client for name, ex. GRPCClient(f.GRPCClients, "orders", orderspb.NewOrdersClient).
+func GRPCClient[T any](clients *GRPCClients, name string, newClient func(grpc.ClientConnInterface) T) (T, error) {
+	conn, err := clients.Conn(name)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return newClient(conn), nil
+}
+
+// Close closes every dialed connection. Conn fails afterwards.
+func (c *GRPCClients) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	var errs []error
+	for name, conn := range c.conns {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("[foundation] grpc client %q: %w", name, err))
+		}
+		delete(c.conns, name)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *GRPCClients) dialOptions(name string, opts GRPCClientOptions) []grpc.DialOption {
+	transport := insecure.NewCredentials()
+	if opts.TLS {
+		transport = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	unary := []grpc.UnaryClientInterceptor{unaryClientDeadline(opts.Timeout)}
+	var stream []grpc.StreamClientInterceptor
+	if c.tracing != nil && c.tracing.Enabled() {
+		unary = append(unary, UnaryClientTracing(c.tracing))
+		stream = append(stream, StreamClientTracing(c.tracing))
+	}
+	unary = append(unary, unaryClientRequestID(), unaryClientTenant(), unaryClientLogger(c.logger.With(zap.String("client", name))))
+	stream = append(stream, streamClientRequestID(), streamClientTenant())
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(transport),
+		grpc.WithKeepaliveParams(opts.Keepalive),
+		grpc.WithDefaultServiceConfig(retryServiceConfig(opts.MaxAttempts)),
+		grpc.WithChainUnaryInterceptor(append(unary, opts.UnaryInterceptors...)...),
+		grpc.WithChainStreamInterceptor(append(stream, opts.StreamInterceptors...)...),
+	}
+	if opts.Credentials != nil {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(opts.Credentials))
+	}
+	return append(dialOpts, opts.DialOptions...)
+}
+
+// retryServiceConfig retries UNAVAILABLE, which gRPC only returns when the call did not reach the server handler.
+func retryServiceConfig(maxAttempts int) string {
+	return fmt.Sprintf(`{"methodConfig":[{"name":[{}],"retryPolicy":{
+		"maxAttempts":%d,
+		"initialBackoff":"0.1s",
+		"maxBackoff":"1s",
+		"backoffMultiplier":2,
+		"retryableStatusCodes":["UNAVAILABLE"]
+	}}]}`, maxAttempts)
+}
+
+func unaryClientDeadline(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func unaryClientRequestID() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingRequestID(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+func streamClientRequestID() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingRequestID(ctx), desc, cc, method, opts...)
+	}
+}
+
+// outgoingRequestID forwards the request ID of the current request, so downstream logs can be joined up. A
+// *gin.Context passed as ctx exposes its keys through Value, so calls made straight from gin handlers work too.
+func outgoingRequestID(ctx context.Context) context.Context {
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" {
+		requestID, _ = ctx.Value(RequestIDKey).(string)
+	}
+	if requestID == "" {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get("x-request-id")) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "x-request-id", requestID)
+}
+
+// unaryClientLogger logs every call with the request's logger, falling back to the registry's.
+func unaryClientLogger(fallback Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		logger := fallback
+		if ctxLogger, ok := ctx.Value(contextKey(LoggerKey)).(Logger); ok {
+			logger = ctxLogger
+		} else if ginLogger, ok := ctx.Value(LoggerKey).(Logger); ok {
+			logger = ginLogger
+		}
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		args := []any{
+			slog.String("grpc_method", method),
+			slog.String("grpc_code", status.Code(err).String()),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if err != nil {
+			logger.WarnContext(ctx, "grpc client call failed", append(args, slog.Any("error", err))...)
+			return err
+		}
+		logger.DebugContext(ctx, "grpc client call", args...)
+		return nil
+	}
+}
+
+// IDTokenCredentials authenticates calls with a Google-signed ID token for audience, the URL of the Cloud Run
+// service being called. Tokens come from the metadata server, or GOOGLE_APPLICATION_CREDENTIALS when running
+// locally, and are cached until they expire.
+func IDTokenCredentials(audience string) credentials.PerRPCCredentials {
+	return &idTokenCredentials{audience: audience}
+}
+
+type idTokenCredentials struct {
+	audience string
+	mu       sync.Mutex
+	source   oauth2.TokenSource
+}
+
+// tokenSource creates the token source on the first call, as it needs credentials that are missing in most tests,
+// and again on the next calls until it succeeds, so a metadata server hiccup at startup is not permanent.
+func (c *idTokenCredentials) tokenSource() (oauth2.TokenSource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.source == nil {
+		source, err := idtoken.NewTokenSource(context.Background(), c.audience)
+		if err != nil {
+			return nil, err
+		}
+		c.source = source
+	}
+	return c.source, nil
+}
+
+func (c *idTokenCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	source, err := c.tokenSource()
+	if err != nil {
+		return nil, fmt.Errorf("[foundation] id token for %q: %w", c.audience, err)
+	}
+	token, err := source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("[foundation] id token for %q: %w", c.audience, err)
+	}
+	return map[string]string{"authorization": "Bearer " + token.AccessToken}, nil
+}
+
+func (c *idTokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+// StaticTokenCredentials authenticates calls with a fixed bearer token, such as the system token checked by
+// grpcmw.UnaryBearerToken.
+func StaticTokenCredentials(token string, requireTLS bool) credentials.PerRPCCredentials {
+	return staticTokenCredentials{token: token, requireTLS: requireTLS}
+}
+
+type staticTokenCredentials struct {
+	token      string
+	requireTLS bool
+}
+
+func (c staticTokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+func (c staticTokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
@@ -0,0 +1,196 @@
+package foundation_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/testhelpers"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The testhelpers server listens on a package level bufconn, so everything using it stays in this one test.
+func Test_GRPCClients(t *testing.T) {
+	var (
+		mu           sync.Mutex
+		gotMD        metadata.MD
+		gotDeadline  bool
+		attempts     int
+		failAttempts int
+	)
+	server := testhelpers.InitiateGRPCTestServer(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		gotMD, _ = metadata.FromIncomingContext(ctx)
+		_, gotDeadline = ctx.Deadline()
+		attempts++
+		if attempts <= failAttempts {
+			return nil, status.Error(codes.Unavailable, "warming up")
+		}
+		return handler(ctx, req)
+	})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	testhelpers.StartGRPCTestServer(server)
+	t.Cleanup(server.Stop)
+
+	clients := foundation.NewGRPCClients(foundation.NewNopLogger(), map[string]foundation.GRPCClientOptions{
+		"health": {
+			Target:      "bufnet",
+			Credentials: foundation.StaticTokenCredentials("system-token", false),
+			DialOptions: []grpc.DialOption{testhelpers.BufDialOption()},
+		},
+	})
+	client, err := foundation.GRPCClient(clients, "health", healthpb.NewHealthClient)
+	require.NoError(t, err)
+
+	t.Run("propagates request id, tenant, credentials and deadline", func(t *testing.T) {
+		ctx := foundation.ContextWithRequestID(context.Background(), "abc-123")
+		ctx = foundation.ContextWithTenant(ctx, &foundation.Tenant{ID: "t-1", Subdomain: "wu"})
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{"abc-123"}, gotMD.Get("x-request-id"))
+		assert.Equal(t, []string{"t-1"}, gotMD.Get(foundation.TenantMetadataKey))
+		assert.Equal(t, []string{"Bearer system-token"}, gotMD.Get("authorization"))
+		assert.True(t, gotDeadline)
+	})
+
+	t.Run("retries unavailable", func(t *testing.T) {
+		mu.Lock()
+		attempts, failAttempts = 0, 2
+		mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("unknown client", func(t *testing.T) {
+		_, err := clients.Conn("orders")
+		assert.ErrorContains(t, err, `grpc client "orders" is not configured`)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		require.NoError(t, clients.Close())
+		_, err := clients.Conn("health")
+		assert.ErrorIs(t, err, foundation.ErrGRPCClientsClosed)
+	})
+}
+
+func Test_GRPCClientOptionsFromConfig(t *testing.T) {
+	t.Parallel()
+
+	options := foundation.GRPCClientOptionsFromConfig(map[string]config.ClientConfig{
+		"core":    {Host: "core-abc.a.run.app", Port: "443", GoogleIAMAudience: "https://core-abc.a.run.app"},
+		"billing": {Host: "localhost", Port: "8081", Token: "system-token"},
+	})
+
+	assert.Equal(t, "core-abc.a.run.app:443", options["core"].Target)
+	assert.True(t, options["core"].TLS)
+	assert.True(t, options["core"].Credentials.RequireTransportSecurity())
+
+	assert.Equal(t, "localhost:8081", options["billing"].Target)
+	assert.False(t, options["billing"].TLS)
+	md, err := options["billing"].Credentials.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer system-token"}, md)
+}
+
+func Test_GRPCClientsUpdate(t *testing.T) {
+	t.Parallel()
+
+	clients := foundation.NewGRPCClients(foundation.NewNopLogger(), map[string]foundation.GRPCClientOptions{
+		"orders":  {Target: "orders:8081"},
+		"billing": {Target: "billing:8081"},
+	})
+	t.Cleanup(func() { _ = clients.Close() })
+	orders, err := clients.Conn("orders")
+	require.NoError(t, err)
+	billing, err := clients.Conn("billing")
+	require.NoError(t, err)
+
+	require.NoError(t, clients.Update(map[string]foundation.GRPCClientOptions{
+		"orders": {Target: "orders:8081"},
+		"users":  {Target: "users:8081"},
+	}))
+	assert.Equal(t, []string{"orders", "users"}, clients.Names())
+	same, err := clients.Conn("orders")
+	require.NoError(t, err)
+	assert.Same(t, orders, same, "unchanged target keeps its connection")
+	assert.Equal(t, connectivity.Shutdown, billing.GetState(), "removed client is closed")
+	_, err = clients.Conn("billing")
+	assert.Error(t, err)
+
+	require.NoError(t, clients.Update(map[string]foundation.GRPCClientOptions{"orders": {Target: "orders-v2:8081"}}))
+	moved, err := clients.Conn("orders")
+	require.NoError(t, err)
+	assert.NotSame(t, orders, moved)
+	assert.Equal(t, "orders-v2:8081", moved.Target())
+	assert.Equal(t, connectivity.Shutdown, orders.GetState())
+
+	tests := []struct {
+		name  string
+		given foundation.GRPCClientOptions
+		want  bool
+	}{
+		{name: "same options", given: foundation.GRPCClientOptions{Target: "orders-v2:8081", Timeout: 10 * time.Second}, want: true},
+		{name: "rotated token", given: foundation.GRPCClientOptions{Target: "orders-v2:8081", Credentials: foundation.StaticTokenCredentials("v2", false)}},
+		{name: "timeout", given: foundation.GRPCClientOptions{Target: "orders-v2:8081", Timeout: time.Second}},
+		{name: "max attempts", given: foundation.GRPCClientOptions{Target: "orders-v2:8081", MaxAttempts: 1}},
+	}
+	for _, tc := range tests {
+		require.NoError(t, clients.Update(map[string]foundation.GRPCClientOptions{"orders": {Target: "orders-v2:8081"}}), tc.name)
+		current, err := clients.Conn("orders")
+		require.NoError(t, err, tc.name)
+		require.NoError(t, clients.Update(map[string]foundation.GRPCClientOptions{"orders": tc.given}), tc.name)
+		next, err := clients.Conn("orders")
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.want, current == next, tc.name)
+	}
+}
+
+func Test_GRPCClientsReadiness(t *testing.T) {
+	t.Parallel()
+
+	f := foundation.New(foundation.Options{
+		Environment: foundation.Test,
+		Logger:      foundation.NewNopLogger(),
+		GRPCClients: map[string]foundation.GRPCClientOptions{"orders": {Target: "127.0.0.1:" + freePort(t)}},
+	})
+	t.Cleanup(func() { _ = f.GRPCClients.Close() })
+
+	report, found := f.Health.Check(context.Background(), "grpc:orders")
+	require.True(t, found)
+	assert.True(t, report.OK(), "a client never dialed is ready")
+
+	conn, err := f.GRPCClients.Conn("orders")
+	require.NoError(t, err)
+	conn.Connect()
+	assert.Eventually(t, func() bool {
+		report, _ := f.Health.Check(context.Background(), "grpc:orders")
+		return !report.OK() && report.Checks["grpc:orders"] == connectivity.TransientFailure.String()
+	}, 5*time.Second, 10*time.Millisecond, "nothing listens on the port")
+
+	f.GRPCClients.Add("billing", foundation.GRPCClientOptions{Target: "billing:8081"})
+	_, found = f.Health.Check(context.Background(), "grpc:billing")
+	assert.True(t, found, "clients added later are checked too")
+}
@@ -0,0 +1,141 @@
+package grpcmw
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TokenValidator validates a bearer token and returns its claims. *middleware.JWTValidator implements it.
+type TokenValidator interface {
+	Validate(ctx context.Context, token string) (*foundation.Claims, error)
+}
+
+// HealthService is skipped by the auth interceptors so load balancers can probe without credentials.
+const HealthService = "/grpc.health.v1.Health/"
+
+// UnaryJWT returns an interceptor that rejects calls without a valid bearer token in the authorization metadata
+// and stores the claims in the context for foundation.ClaimsFromContext. skipMethods are full method names, or
+// service names ending in a slash, that do not require a token; the health service is always skipped.
+func UnaryJWT(validator TokenValidator, skipMethods ...string) grpc.UnaryServerInterceptor {
+	authenticate := jwtAuthenticator(validator)
+	skip := authSkipSet(skipMethods)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if skipMethod(skip, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamJWT is the streaming counterpart of UnaryJWT.
+func StreamJWT(validator TokenValidator, skipMethods ...string) grpc.StreamServerInterceptor {
+	authenticate := jwtAuthenticator(validator)
+	skip := authSkipSet(skipMethods)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if skipMethod(skip, info.FullMethod) {
+			return handler(srv, stream)
+		}
+		ctx, err := authenticate(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, withContext(stream, ctx))
+	}
+}
+
+// UnaryBearerToken returns an interceptor that only allows calls carrying systemToken as their bearer token, the
+// gRPC counterpart of middleware.BasicJWT.
+func UnaryBearerToken(systemToken string, skipMethods ...string) grpc.UnaryServerInterceptor {
+	authenticate := systemTokenAuthenticator(systemToken)
+	skip := authSkipSet(skipMethods)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if skipMethod(skip, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamBearerToken is the streaming counterpart of UnaryBearerToken.
+func StreamBearerToken(systemToken string, skipMethods ...string) grpc.StreamServerInterceptor {
+	authenticate := systemTokenAuthenticator(systemToken)
+	skip := authSkipSet(skipMethods)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if skipMethod(skip, info.FullMethod) {
+			return handler(srv, stream)
+		}
+		ctx, err := authenticate(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, withContext(stream, ctx))
+	}
+}
+
+func authSkipSet(skipMethods []string) map[string]struct{} {
+	skip := skipSet(skipMethods)
+	skip[HealthService] = struct{}{}
+	return skip
+}
+
+type authenticator func(ctx context.Context) (context.Context, error)
+
+func jwtAuthenticator(validator TokenValidator) authenticator {
+	return func(ctx context.Context) (context.Context, error) {
+		token, err := bearerToken(ctx)
+		if err != nil {
+			return ctx, err
+		}
+		claims, err := validator.Validate(ctx, token)
+		if err != nil {
+			foundation.LoggerFromContext(ctx).Warn("bearer token not valid", slog.Any("error", err))
+			return ctx, status.Error(codes.Unauthenticated, "unauthorized")
+		}
+		return foundation.ContextWithClaims(ctx, claims), nil
+	}
+}
+
+func systemTokenAuthenticator(systemToken string) authenticator {
+	return func(ctx context.Context) (context.Context, error) {
+		token, err := bearerToken(ctx)
+		if err != nil {
+			return ctx, err
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(systemToken)) != 1 {
+			foundation.LoggerFromContext(ctx).Warn("bearer token not valid")
+			return ctx, status.Error(codes.Unauthenticated, "unauthorized")
+		}
+		return ctx, nil
+	}
+}
+
+func bearerToken(ctx context.Context) (string, error) {
+	var authHeader string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authHeader = values[0]
+		}
+	}
+	token, err := middleware.BearerToken(authHeader)
+	if err != nil {
+		foundation.LoggerFromContext(ctx).Warn(err.Error())
+		return "", status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return token, nil
+}
@@ -0,0 +1,80 @@
+// Package grpcmw provides the gRPC server interceptors that mirror the gin middleware in foundation/middleware:
+// request IDs, request logging, panic recovery, bearer token authentication, rate limiting and tenants.
+package grpcmw
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// DefaultUnaryInterceptors returns the request ID, logger and recovery interceptors in the order they should run.
+func DefaultUnaryInterceptors(logger foundation.Logger) []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{
+		UnaryRequestID(),
+		UnaryLogger(logger),
+		UnaryRecovery(),
+	}
+}
+
+// DefaultStreamInterceptors returns the request ID, logger and recovery interceptors in the order they should run.
+func DefaultStreamInterceptors(logger foundation.Logger) []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		StreamRequestID(),
+		StreamLogger(logger),
+		StreamRecovery(),
+	}
+}
+
+// serverStream lets stream interceptors hand a modified context to the handler.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func withContext(stream grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &serverStream{ServerStream: stream, ctx: ctx}
+}
+
+// metadataKey converts an HTTP header name to the lower case form gRPC metadata uses.
+func metadataKey(header string) string {
+	return strings.ToLower(header)
+}
+
+func skipMethod(skip map[string]struct{}, fullMethod string) bool {
+	if _, ok := skip[fullMethod]; ok {
+		return true
+	}
+	service, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	_, ok := skip["/"+service+"/"]
+	return ok
+}
+
+func skipSet(methods []string) map[string]struct{} {
+	skip := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		skip[method] = struct{}{}
+	}
+	return skip
+}
+
+// peerIP returns the IP address of the caller, empty when unknown.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		return host
+	}
+	return ip
+}
@@ -0,0 +1,321 @@
+package grpcmw_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/grpcmw"
+	"github.com/OptechLabs/monorepo/foundation/ratelimit"
+	"github.com/OptechLabs/monorepo/foundation/tenancy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+type fakeValidator struct{}
+
+func (fakeValidator) Validate(_ context.Context, token string) (*foundation.Claims, error) {
+	if token != "good" {
+		return nil, errors.New("bad signature")
+	}
+	return &foundation.Claims{Subject: "auth0|123"}, nil
+}
+
+func chain(ctx context.Context, method string, handler grpc.UnaryHandler, interceptors ...grpc.UnaryServerInterceptor) (interface{}, error) {
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler(ctx, nil)
+}
+
+func Test_UnaryRequestIDAndLogger(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "abc-123"))
+
+	var gotRequestID string
+	_, err := chain(ctx, "/orders.v1.Orders/Create", func(ctx context.Context, req interface{}) (interface{}, error) {
+		gotRequestID = foundation.RequestIDFromContext(ctx)
+		return nil, nil
+	}, grpcmw.DefaultUnaryInterceptors(foundation.NewZapLogger(zap.New(core)))...)
+	require.NoError(t, err)
+
+	assert.Equal(t, "abc-123", gotRequestID)
+	require.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "[foundation] /orders.v1.Orders/Create", logs.All()[0].Message)
+	assert.Equal(t, "abc-123", fields["X-Request-ID"])
+	assert.Equal(t, "/orders.v1.Orders/Create", fields["path"])
+	assert.Equal(t, int64(codes.OK), fields["status_code"])
+	for _, field := range []string{"content_type", "body_bytes", "latency", "client_ip", "method"} {
+		assert.Contains(t, fields, field)
+	}
+}
+
+func Test_UnaryRequestIDGenerated(t *testing.T) {
+	t.Parallel()
+
+	var gotRequestID string
+	_, err := chain(context.Background(), "/orders.v1.Orders/Create", func(ctx context.Context, req interface{}) (interface{}, error) {
+		gotRequestID = foundation.RequestIDFromContext(ctx)
+		return nil, nil
+	}, grpcmw.UnaryRequestID())
+	require.NoError(t, err)
+	assert.NotEmpty(t, gotRequestID)
+}
+
+func Test_Recovery(t *testing.T) {
+	t.Parallel()
+
+	_, err := chain(context.Background(), "/orders.v1.Orders/Create", func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("expected unit test panic")
+	}, grpcmw.UnaryRecovery())
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	err = grpcmw.StreamRecovery()(nil, &fakeStream{ctx: context.Background()}, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+		panic("expected unit test panic")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func Test_UnaryJWT(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		givenMethod string
+		givenAuth   string
+		wantCode    codes.Code
+		wantSubject string
+	}{
+		{name: "no token", givenMethod: "/orders.v1.Orders/Create", wantCode: codes.Unauthenticated},
+		{name: "not a bearer token", givenMethod: "/orders.v1.Orders/Create", givenAuth: "good", wantCode: codes.Unauthenticated},
+		{name: "invalid token", givenMethod: "/orders.v1.Orders/Create", givenAuth: "Bearer bad", wantCode: codes.Unauthenticated},
+		{name: "valid token", givenMethod: "/orders.v1.Orders/Create", givenAuth: "Bearer good", wantCode: codes.OK, wantSubject: "auth0|123"},
+		{name: "health is skipped", givenMethod: "/grpc.health.v1.Health/Check", wantCode: codes.OK},
+		{name: "skipped method", givenMethod: "/orders.v1.Orders/List", wantCode: codes.OK},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			if tc.givenAuth != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tc.givenAuth))
+			}
+
+			var gotSubject string
+			_, err := chain(ctx, tc.givenMethod, func(ctx context.Context, req interface{}) (interface{}, error) {
+				if claims, ok := foundation.ClaimsFromContext(ctx); ok {
+					gotSubject = claims.Subject
+				}
+				return nil, nil
+			}, grpcmw.UnaryJWT(fakeValidator{}, "/orders.v1.Orders/List"))
+
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			assert.Equal(t, tc.wantSubject, gotSubject)
+		})
+	}
+}
+
+func Test_StreamBearerToken(t *testing.T) {
+	t.Parallel()
+
+	interceptor := grpcmw.StreamBearerToken("token")
+	info := &grpc.StreamServerInfo{FullMethod: "/orders.v1.Orders/Watch"}
+	handler := func(srv interface{}, stream grpc.ServerStream) error { return nil }
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+	assert.NoError(t, interceptor(nil, &fakeStream{ctx: ctx}, info, handler))
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer bad token"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(interceptor(nil, &fakeStream{ctx: ctx}, info, handler)))
+}
+
+// transportStream records the headers grpc.SetHeader sends in unary calls.
+type transportStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func Test_UnaryRateLimit(t *testing.T) {
+	t.Parallel()
+
+	limiter, err := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.PerMinute(1))
+	require.NoError(t, err)
+	interceptor := grpcmw.UnaryRateLimit(limiter)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	call := func(ip, apiKey, method string, interceptors ...grpc.UnaryServerInterceptor) (*transportStream, error) {
+		if len(interceptors) == 0 {
+			interceptors = []grpc.UnaryServerInterceptor{interceptor}
+		}
+		stream := &transportStream{}
+		ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}})
+		if apiKey != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", apiKey))
+		}
+		_, err := chain(ctx, method, handler, interceptors...)
+		return stream, err
+	}
+
+	stream, err := call("10.0.0.1", "", "/orders.v1.Orders/Get")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, stream.header.Get("ratelimit-limit"))
+	assert.Equal(t, []string{"0"}, stream.header.Get("ratelimit-remaining"))
+
+	stream, err = call("10.0.0.1", "", "/orders.v1.Orders/Get")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"60"}, stream.header.Get("retry-after"))
+
+	_, err = call("10.0.0.1", "k1", "/orders.v1.Orders/Get")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "api keys are not counted by default")
+	_, err = call("10.0.0.2", "", "/orders.v1.Orders/Get")
+	assert.NoError(t, err)
+	_, err = call("10.0.0.1", "", grpcmw.HealthService+"Check")
+	assert.NoError(t, err, "health checks are not limited")
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: fakeAddr("inprocess")})
+	for i := 0; i < 2; i++ {
+		_, err = chain(ctx, "/orders.v1.Orders/Get", handler, interceptor)
+		assert.NoError(t, err, "in-process calls are not limited")
+	}
+}
+
+func Test_UnaryRateLimitAPIKey(t *testing.T) {
+	t.Parallel()
+
+	limiter, err := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.PerMinute(1))
+	require.NoError(t, err)
+	valid := func(_ context.Context, apiKey string) bool { return apiKey == "k1" }
+	interceptor := grpcmw.UnaryRateLimitWithConfig(grpcmw.RateLimitConfig{
+		Limiter: limiter,
+		KeyFunc: grpcmw.KeyFirst(grpcmw.KeyByAPIKey("X-API-Key", valid), grpcmw.KeyByPeerIP),
+	})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	call := func(apiKey string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", apiKey))
+		_, err := chain(ctx, "/orders.v1.Orders/Get", handler, interceptor)
+		return err
+	}
+
+	assert.NoError(t, call("random-1"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("random-2")), "unknown keys are counted by ip")
+	assert.NoError(t, call("k1"), "valid keys get their own count")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("k1")))
+}
+
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return string(a) }
+func (a fakeAddr) String() string  { return string(a) }
+
+func Test_StreamRateLimit(t *testing.T) {
+	t.Parallel()
+
+	limiter, err := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.PerMinute(1))
+	require.NoError(t, err)
+	interceptor := grpcmw.StreamRateLimit(limiter)
+	info := &grpc.StreamServerInfo{FullMethod: "/orders.v1.Orders/Watch"}
+	handler := func(srv interface{}, stream grpc.ServerStream) error { return nil }
+	ctx := foundation.ContextWithClaims(context.Background(), &foundation.Claims{Subject: "auth0|123"})
+
+	stream := &fakeStream{ctx: ctx}
+	assert.NoError(t, interceptor(nil, stream, info, handler))
+	assert.Equal(t, []string{"1"}, stream.header.Get("ratelimit-limit"))
+
+	stream = &fakeStream{ctx: ctx}
+	assert.Equal(t, codes.ResourceExhausted, status.Code(interceptor(nil, stream, info, handler)))
+	assert.Equal(t, []string{"60"}, stream.header.Get("retry-after"))
+}
+
+func Test_UnaryTenant(t *testing.T) {
+	t.Parallel()
+
+	registry := tenancy.NewStaticRegistry(foundation.Tenant{ID: "t-1", Subdomain: "wu"})
+	interceptor := grpcmw.UnaryTenantWithConfig(grpcmw.TenantConfig{
+		Registry: registry,
+		Trusted:  grpcmw.TrustAny(foundation.IsInProcessCall, grpcmw.TrustSubjects("orders@optech.iam.gserviceaccount.com")),
+	})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		tenant, ok := foundation.TenantFromContext(ctx)
+		if !ok {
+			return "", nil
+		}
+		return tenant.Subdomain, nil
+	}
+
+	tests := []struct {
+		name         string
+		interceptor  grpc.UnaryServerInterceptor
+		givenSubject string
+		givenMD      metadata.MD
+		wantResp     interface{}
+		wantCode     codes.Code
+	}{
+		{name: "tenant", givenSubject: "orders@optech.iam.gserviceaccount.com", givenMD: metadata.Pairs(foundation.TenantMetadataKey, "t-1"), wantResp: "wu"},
+		{name: "no tenant", givenSubject: "orders@optech.iam.gserviceaccount.com", givenMD: metadata.MD{}, wantResp: ""},
+		{name: "unknown tenant", givenSubject: "orders@optech.iam.gserviceaccount.com", givenMD: metadata.Pairs(foundation.TenantMetadataKey, "t-9"), wantCode: codes.NotFound},
+		{name: "untrusted subject", givenSubject: "auth0|1", givenMD: metadata.Pairs(foundation.TenantMetadataKey, "t-1"), wantResp: ""},
+		{name: "unauthenticated", givenMD: metadata.Pairs(foundation.TenantMetadataKey, "t-1"), wantResp: ""},
+		{name: "network callers untrusted by default", interceptor: grpcmw.UnaryTenant(registry),
+			givenSubject: "orders@optech.iam.gserviceaccount.com", givenMD: metadata.Pairs(foundation.TenantMetadataKey, "t-1"), wantResp: ""},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := metadata.NewIncomingContext(context.Background(), tc.givenMD)
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+			if tc.givenSubject != "" {
+				ctx = foundation.ContextWithClaims(ctx, &foundation.Claims{Subject: tc.givenSubject})
+			}
+			if tc.interceptor == nil {
+				tc.interceptor = interceptor
+			}
+			resp, err := chain(ctx, "/orders.v1.Orders/Get", handler, tc.interceptor)
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			assert.Equal(t, tc.wantResp, resp)
+		})
+	}
+}
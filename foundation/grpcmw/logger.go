@@ -0,0 +1,115 @@
+package grpcmw
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// LoggerConfig defines the config for Logger interceptors.
+type LoggerConfig struct {
+	// RequestIDField is the field name the request ID is logged under
+	RequestIDField string
+
+	// SkipMethods is a list of full method names, ex. "/grpc.health.v1.Health/Check", which logs are not written.
+	// A service name ending in a slash, ex. "/grpc.health.v1.Health/", skips every method of the service.
+	// Optional.
+	SkipMethods []string
+}
+
+// UnaryLogger returns an interceptor that writes structured request logs with the same fields as
+// middleware.Logger and stores a request scoped logger in the context for foundation.LoggerFromContext.
+func UnaryLogger(logger foundation.Logger) grpc.UnaryServerInterceptor {
+	return UnaryLoggerWithConfig(logger, LoggerConfig{RequestIDField: middleware.RequestIDField})
+}
+
+func UnaryLoggerWithConfig(logger foundation.Logger, conf LoggerConfig) grpc.UnaryServerInterceptor {
+	skip := skipSet(conf.SkipMethods)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = loggerContext(ctx, logger)
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		if !skipMethod(skip, info.FullMethod) {
+			bodyBytes := 0
+			if msg, ok := resp.(proto.Message); ok {
+				bodyBytes = proto.Size(msg)
+			}
+			logCall(ctx, logger, conf, info.FullMethod, start, bodyBytes, err)
+		}
+		return resp, err
+	}
+}
+
+// StreamLogger is the streaming counterpart of UnaryLogger.
+func StreamLogger(logger foundation.Logger) grpc.StreamServerInterceptor {
+	return StreamLoggerWithConfig(logger, LoggerConfig{RequestIDField: middleware.RequestIDField})
+}
+
+func StreamLoggerWithConfig(logger foundation.Logger, conf LoggerConfig) grpc.StreamServerInterceptor {
+	skip := skipSet(conf.SkipMethods)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := loggerContext(stream.Context(), logger)
+		start := time.Now()
+
+		err := handler(srv, withContext(stream, ctx))
+
+		if !skipMethod(skip, info.FullMethod) {
+			logCall(ctx, logger, conf, info.FullMethod, start, 0, err)
+		}
+		return err
+	}
+}
+
+func loggerContext(ctx context.Context, logger foundation.Logger) context.Context {
+	if reqID := foundation.RequestIDFromContext(ctx); reqID != "" {
+		attr := slog.String(foundation.RequestIDLogField, reqID)
+		ctx = foundation.ContextWithLogAttrs(ctx, attr)
+		return foundation.ContextWithLogger(ctx, logger.With(attr))
+	}
+	return foundation.ContextWithLogger(ctx, logger)
+}
+
+func logCall(ctx context.Context, logger foundation.Logger, conf LoggerConfig, fullMethod string, start time.Time, bodyBytes int, err error) {
+	latency := time.Since(start)
+	if latency > time.Minute {
+		latency = latency.Truncate(time.Second)
+	}
+
+	var contentType string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("content-type"); len(values) > 0 {
+			contentType = values[0]
+		}
+	}
+	clientIP := peerIP(ctx)
+	code := status.Code(err)
+
+	msg := "[foundation] " + fullMethod
+	args := []any{
+		slog.String(conf.RequestIDField, foundation.RequestIDFromContext(ctx)),
+		slog.String("content_type", contentType),
+		slog.Int("body_bytes", bodyBytes),
+		slog.Int("status_code", int(code)),
+		slog.String("grpc_code", code.String()),
+		slog.String("latency", latency.String()),
+		slog.String("client_ip", clientIP),
+		slog.String("method", "grpc"),
+		slog.String("path", fullMethod),
+	}
+
+	if err != nil {
+		args = append(args, slog.String("error", err.Error()))
+		logger.Error(msg, args...)
+	} else {
+		logger.Info(msg, args...)
+	}
+}
@@ -0,0 +1,187 @@
+package grpcmw
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/OptechLabs/monorepo/foundation/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// KeyFunc returns the key a call is counted under, or false to try the next KeyFunc.
+type KeyFunc func(ctx context.Context) (string, bool)
+
+// KeyByPeerIP counts calls per caller IP. Behind a load balancer this is the balancer's address. In-process calls,
+// ex. from the gRPC gateway, have no IP and are left to the HTTP rate limit.
+func KeyByPeerIP(ctx context.Context) (string, bool) {
+	ip := peerIP(ctx)
+	return "ip:" + ip, net.ParseIP(ip) != nil
+}
+
+// KeyBySubject counts calls per authenticated subject, so it must run after the JWT interceptor.
+func KeyBySubject(ctx context.Context) (string, bool) {
+	claims, ok := foundation.ClaimsFromContext(ctx)
+	if !ok || claims.Subject == "" {
+		return "", false
+	}
+	return "sub:" + claims.Subject, true
+}
+
+// KeyByAPIKey counts calls per API key sent in the header metadata, for the keys valid accepts, like
+// middleware.KeyByAPIKey. Keys are hashed the same way so HTTP and gRPC calls with the same key share their count.
+func KeyByAPIKey(header string, valid middleware.APIKeyValidator) KeyFunc {
+	key := metadataKey(header)
+	return func(ctx context.Context) (string, bool) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(key)
+		if len(values) == 0 || values[0] == "" || !valid(ctx, values[0]) {
+			return "", false
+		}
+		return "key:" + middleware.HashKey(values[0]), true
+	}
+}
+
+// KeyFirst returns the key of the first keyFunc that has one.
+func KeyFirst(keyFuncs ...KeyFunc) KeyFunc {
+	return func(ctx context.Context) (string, bool) {
+		for _, keyFunc := range keyFuncs {
+			if key, ok := keyFunc(ctx); ok {
+				return key, true
+			}
+		}
+		return "", false
+	}
+}
+
+// RateLimitConfig defines the config for the rate limit interceptors, see middleware.RateLimitConfig.
+type RateLimitConfig struct {
+	// Limiter counts the calls. A nil Limiter disables the interceptors.
+	Limiter *ratelimit.Limiter
+
+	// KeyFunc returns the key calls are counted under. Calls without a key are not limited.
+	// Optional. Default value KeyFirst(KeyBySubject, KeyByPeerIP).
+	KeyFunc KeyFunc
+
+	// Prefix separates the counts of limiters sharing a store.
+	// Optional.
+	Prefix string
+
+	// FailClosed rejects calls when the store fails instead of letting them through.
+	// Optional.
+	FailClosed bool
+
+	// SkipMethods are full method names, or service names ending in a slash, that are not limited. The health
+	// service is always skipped.
+	// Optional.
+	SkipMethods []string
+}
+
+// UnaryRateLimit returns an interceptor that limits the calls of each authenticated subject, or else of each caller IP.
+// Rejected calls fail with ResourceExhausted.
+func UnaryRateLimit(limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return UnaryRateLimitWithConfig(RateLimitConfig{Limiter: limiter})
+}
+
+// UnaryRateLimitWithConfig returns a UnaryRateLimit interceptor with config.
+func UnaryRateLimitWithConfig(conf RateLimitConfig) grpc.UnaryServerInterceptor {
+	limit := rateLimiter(conf)
+	skip := authSkipSet(conf.SkipMethods)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if skipMethod(skip, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		md, err := limit(ctx)
+		if md != nil {
+			setRateLimitHeader(ctx, grpc.SetHeader(ctx, md))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamRateLimit is the streaming counterpart of UnaryRateLimit, counting one request per stream.
+func StreamRateLimit(limiter *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return StreamRateLimitWithConfig(RateLimitConfig{Limiter: limiter})
+}
+
+// StreamRateLimitWithConfig returns a StreamRateLimit interceptor with config.
+func StreamRateLimitWithConfig(conf RateLimitConfig) grpc.StreamServerInterceptor {
+	limit := rateLimiter(conf)
+	skip := authSkipSet(conf.SkipMethods)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if skipMethod(skip, info.FullMethod) {
+			return handler(srv, stream)
+		}
+		md, err := limit(stream.Context())
+		if md != nil {
+			setRateLimitHeader(stream.Context(), stream.SetHeader(md))
+		}
+		if err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// rateLimiter counts a call and returns the rate limit headers for the response metadata.
+func rateLimiter(conf RateLimitConfig) func(ctx context.Context) (metadata.MD, error) {
+	if conf.KeyFunc == nil {
+		conf.KeyFunc = KeyFirst(KeyBySubject, KeyByPeerIP)
+	}
+	return func(ctx context.Context) (metadata.MD, error) {
+		if conf.Limiter == nil {
+			return nil, nil
+		}
+		key, ok := conf.KeyFunc(ctx)
+		if !ok {
+			return nil, nil
+		}
+
+		logger := foundation.LoggerFromContext(ctx)
+		result, err := conf.Limiter.Allow(ctx, conf.Prefix+key)
+		if err != nil {
+			logger.Error("rate limit store failed", slog.Any("error", err))
+			if conf.FailClosed {
+				return nil, status.Error(codes.Unavailable, "unable to rate limit")
+			}
+			return nil, nil
+		}
+
+		md := metadata.Pairs(
+			metadataKey(middleware.RateLimitLimitHeader), strconv.Itoa(result.Limit),
+			metadataKey(middleware.RateLimitRemainingHeader), strconv.Itoa(result.Remaining),
+			metadataKey(middleware.RateLimitResetHeader), strconv.Itoa(ceilSeconds(result.Reset)),
+		)
+		if !result.Allowed {
+			md.Set(metadataKey(middleware.RetryAfterHeader), strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+		}
+		if !result.Allowed {
+			logger.Warn("rate limit exceeded", slog.String("rateLimitKey", key))
+			return md, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return md, nil
+	}
+}
+
+// setRateLimitHeader logs the failure to send the rate limit headers, which does not fail the call.
+func setRateLimitHeader(ctx context.Context, err error) {
+	if err != nil {
+		foundation.LoggerFromContext(ctx).Debug("rate limit headers not set", slog.Any("error", err))
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, the unit of the rate limit headers.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
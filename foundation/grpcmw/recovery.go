@@ -0,0 +1,42 @@
+package grpcmw
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const internalErrorMessage = "An internal error has occurred. Contact Tech for more information"
+
+// UnaryRecovery returns an interceptor that recovers from any panics and returns codes.Internal if there was one.
+func UnaryRecovery() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecovery is the streaming counterpart of UnaryRecovery.
+func StreamRecovery() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(stream.Context(), r)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+func recovered(ctx context.Context, r interface{}) error {
+	foundation.LoggerFromContext(ctx).Error("panic occurred and recovered", slog.Any("error", r))
+	return status.Error(codes.Internal, internalErrorMessage)
+}
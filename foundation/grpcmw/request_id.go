@@ -0,0 +1,43 @@
+package grpcmw
+
+import (
+	"context"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/gofrs/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryRequestID returns an interceptor that reads the request ID from the x-request-id metadata, generating one
+// when it is missing, stores it in the context for foundation.RequestIDFromContext and echoes it as a header.
+func UnaryRequestID() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(requestIDContext(ctx), req)
+	}
+}
+
+// StreamRequestID is the streaming counterpart of UnaryRequestID.
+func StreamRequestID() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, withContext(stream, requestIDContext(stream.Context())))
+	}
+}
+
+func requestIDContext(ctx context.Context) context.Context {
+	key := metadataKey(middleware.RequestIDField)
+	var reqID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(key); len(values) > 0 {
+			reqID = values[0]
+		}
+	}
+	if reqID == "" {
+		reqID = uuid.Must(uuid.NewV4()).String()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(key, reqID))
+	trace.SpanFromContext(ctx).SetAttributes(foundation.RequestIDSpanAttribute.String(reqID))
+	return foundation.ContextWithRequestID(ctx, reqID)
+}
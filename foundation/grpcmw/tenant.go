@@ -0,0 +1,122 @@
+package grpcmw
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/tenancy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TrustFunc reports whether the caller of a call may pick its tenant with the x-tenant-id metadata.
+type TrustFunc func(ctx context.Context) bool
+
+// TrustSubjects trusts the callers authenticated as one of subjects, ex. the service accounts of the services calling
+// this one, so it must run after the JWT interceptor.
+func TrustSubjects(subjects ...string) TrustFunc {
+	trusted := skipSet(subjects)
+	return func(ctx context.Context) bool {
+		claims, ok := foundation.ClaimsFromContext(ctx)
+		if !ok || claims.Subject == "" {
+			return false
+		}
+		_, found := trusted[claims.Subject]
+		return found
+	}
+}
+
+// TrustAny trusts the callers any of trustFuncs trusts.
+func TrustAny(trustFuncs ...TrustFunc) TrustFunc {
+	return func(ctx context.Context) bool {
+		for _, trust := range trustFuncs {
+			if trust(ctx) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TenantConfig defines the config for the tenant interceptors.
+type TenantConfig struct {
+	// Registry looks the tenants up. A nil Registry disables the interceptors.
+	Registry tenancy.Registry
+
+	// Trusted reports whether a caller may pick its tenant. The x-tenant-id metadata of other callers is ignored, as
+	// anybody reaching the server could send it.
+	// Optional. Default value foundation.IsInProcessCall, the gRPC gateway of this service.
+	Trusted TrustFunc
+}
+
+// UnaryTenant returns an interceptor that looks up the tenant ID forwarded in the x-tenant-id metadata by this
+// service's gRPC gateway, and stores the tenant for foundation.TenantFromContext. Calls without the metadata, or from
+// other callers, run without a tenant; calls for unknown tenants fail with NotFound. Services called by others through
+// foundation's gRPC clients trust them with UnaryTenantWithConfig.
+func UnaryTenant(registry tenancy.Registry) grpc.UnaryServerInterceptor {
+	return UnaryTenantWithConfig(TenantConfig{Registry: registry})
+}
+
+// UnaryTenantWithConfig returns a UnaryTenant interceptor with config.
+func UnaryTenantWithConfig(conf TenantConfig) grpc.UnaryServerInterceptor {
+	resolve := tenantResolver(conf)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamTenant is the streaming counterpart of UnaryTenant.
+func StreamTenant(registry tenancy.Registry) grpc.StreamServerInterceptor {
+	return StreamTenantWithConfig(TenantConfig{Registry: registry})
+}
+
+// StreamTenantWithConfig returns a StreamTenant interceptor with config.
+func StreamTenantWithConfig(conf TenantConfig) grpc.StreamServerInterceptor {
+	resolve := tenantResolver(conf)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := resolve(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, withContext(stream, ctx))
+	}
+}
+
+func tenantResolver(conf TenantConfig) func(ctx context.Context) (context.Context, error) {
+	if conf.Trusted == nil {
+		conf.Trusted = foundation.IsInProcessCall
+	}
+	return func(ctx context.Context) (context.Context, error) {
+		if conf.Registry == nil {
+			return ctx, nil
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(foundation.TenantMetadataKey)
+		if len(values) == 0 || values[0] == "" {
+			return ctx, nil
+		}
+		if !conf.Trusted(ctx) {
+			foundation.LoggerFromContext(ctx).Warn("tenant metadata from untrusted caller ignored", slog.String("tenantID", values[0]))
+			return ctx, nil
+		}
+
+		tenant, err := conf.Registry.ByID(ctx, values[0])
+		if errors.Is(err, tenancy.ErrUnknownTenant) {
+			foundation.LoggerFromContext(ctx).Warn("unknown tenant", slog.String("tenantID", values[0]))
+			return ctx, status.Error(codes.NotFound, "unknown tenant")
+		}
+		if err != nil {
+			foundation.LoggerFromContext(ctx).Error("tenant registry failed", slog.Any("error", err), slog.String("tenantID", values[0]))
+			return ctx, status.Error(codes.Unavailable, "unable to resolve tenant")
+		}
+		return foundation.ContextWithTenant(ctx, tenant), nil
+	}
+}
@@ -0,0 +1,259 @@
+package foundation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	HealthPath    = "/healthz"
+	ReadinessPath = "/readyz"
+	LivenessPath  = "/livez"
+
+	HealthStatusOK      = "ok"
+	HealthStatusFailing = "failing"
+)
+
+// ErrShuttingDown is reported by readiness once Foundation has started shutting down.
+var ErrShuttingDown = errors.New("shutting down")
+
+// HealthCheck reports whether a dependency is usable. It should honour ctx and return quickly.
+type HealthCheck func(ctx context.Context) error
+
+// HealthReport is the result of running a set of checks. Checks maps each check name to "ok" or its error.
+type HealthReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// OK reports whether every check passed.
+func (r HealthReport) OK() bool {
+	return r.Status == HealthStatusOK
+}
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// Health holds the named checks registered by processors, database pools and clients. Readiness checks decide if
+// the service should receive traffic, liveness checks decide if it should be restarted. /healthz runs both.
+type Health struct {
+	// Timeout bounds each individual check.
+	Timeout time.Duration
+
+	mu           sync.RWMutex
+	readiness    []namedCheck
+	liveness     []namedCheck
+	shuttingDown atomic.Bool
+}
+
+func NewHealth() *Health {
+	return &Health{Timeout: 5 * time.Second}
+}
+
+// AddReadinessCheck registers a check that must pass before the service receives traffic.
+func (h *Health) AddReadinessCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, namedCheck{name: name, check: check})
+}
+
+// AddLivenessCheck registers a check that fails only when the process can no longer recover by itself.
+func (h *Health) AddLivenessCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, namedCheck{name: name, check: check})
+}
+
+// SetShuttingDown makes readiness fail so load balancers stop routing new requests to this instance.
+func (h *Health) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// Ready runs the readiness checks.
+func (h *Health) Ready(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	checks := append([]namedCheck(nil), h.readiness...)
+	h.mu.RUnlock()
+	if h.shuttingDown.Load() {
+		checks = append(checks, namedCheck{name: "shutdown", check: func(context.Context) error { return ErrShuttingDown }})
+	}
+	return h.run(ctx, checks)
+}
+
+// Live runs the liveness checks.
+func (h *Health) Live(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	checks := append([]namedCheck(nil), h.liveness...)
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// Healthy runs every registered check.
+func (h *Health) Healthy(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	checks := append(append([]namedCheck(nil), h.liveness...), h.readiness...)
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// Check runs the readiness or liveness check registered under name.
+func (h *Health) Check(ctx context.Context, name string) (HealthReport, bool) {
+	h.mu.RLock()
+	var found []namedCheck
+	for _, c := range append(append([]namedCheck(nil), h.liveness...), h.readiness...) {
+		if c.name == name {
+			found = append(found, c)
+		}
+	}
+	h.mu.RUnlock()
+	if len(found) == 0 {
+		return HealthReport{}, false
+	}
+	return h.run(ctx, found), true
+}
+
+func (h *Health) run(ctx context.Context, checks []namedCheck) HealthReport {
+	report := HealthReport{Status: HealthStatusOK, Checks: make(map[string]string, len(checks))}
+	results := make([]error, len(checks))
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, h.Timeout)
+			defer cancel()
+			results[i] = c.check(checkCtx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i, c := range checks {
+		if results[i] != nil {
+			report.Status = HealthStatusFailing
+			report.Checks[c.name] = results[i].Error()
+			continue
+		}
+		report.Checks[c.name] = HealthStatusOK
+	}
+	return report
+}
+
+// RegisterRoutes mounts /healthz, /readyz and /livez on router.
+func (h *Health) RegisterRoutes(router gin.IRoutes) {
+	router.GET(HealthPath, gin.WrapF(h.handler(h.Healthy)))
+	router.GET(ReadinessPath, gin.WrapF(h.handler(h.Ready)))
+	router.GET(LivenessPath, gin.WrapF(h.handler(h.Live)))
+}
+
+// RegisterHandlers mounts /healthz, /readyz and /livez on mux, ex. the admin server's.
+func (h *Health) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc(HealthPath, h.handler(h.Healthy))
+	mux.HandleFunc(ReadinessPath, h.handler(h.Ready))
+	mux.HandleFunc(LivenessPath, h.handler(h.Live))
+}
+
+func (h *Health) handler(run func(ctx context.Context) HealthReport) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := run(r.Context())
+		code := http.StatusOK
+		if !report.OK() {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// GRPCServer returns an implementation of the standard grpc.health.v1.Health service. The empty service name
+// reports readiness; any other service name reports the check registered under that name.
+func (h *Health) GRPCServer() healthpb.HealthServer {
+	return &grpcHealthServer{health: h, pollInterval: time.Second}
+}
+
+type grpcHealthServer struct {
+	healthpb.UnimplementedHealthServer
+	health       *Health
+	pollInterval time.Duration
+}
+
+func (s *grpcHealthServer) servingStatus(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	var report HealthReport
+	if service == "" {
+		report = s.health.Ready(ctx)
+	} else {
+		var found bool
+		if report, found = s.health.Check(ctx, service); !found {
+			return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, status.Errorf(codes.NotFound, "unknown service %q", service)
+		}
+	}
+	if report.OK() {
+		return healthpb.HealthCheckResponse_SERVING, nil
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING, nil
+}
+
+func (s *grpcHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	servingStatus, err := s.servingStatus(ctx, req.GetService())
+	if err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: servingStatus}, nil
+}
+
+func (s *grpcHealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx := stream.Context()
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		servingStatus, _ := s.servingStatus(ctx, req.GetService())
+		if servingStatus != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: servingStatus}); err != nil {
+				return err
+			}
+			last = servingStatus
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// processorHealthCheck fails unless the named processor is running.
+func (f *Foundation) processorHealthCheck(name string) HealthCheck {
+	return func(context.Context) error {
+		for _, s := range f.ProcessorStatuses() {
+			if s.Name != name {
+				continue
+			}
+			if s.State == ProcessorRunning {
+				return nil
+			}
+			if s.LastError != nil {
+				return errors.New(string(s.State) + ": " + s.LastError.Error())
+			}
+			return errors.New(string(s.State))
+		}
+		return errors.New("not registered")
+	}
+}
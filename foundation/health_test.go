@@ -0,0 +1,109 @@
+package foundation_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func Test_HealthEndpoints(t *testing.T) {
+	t.Parallel()
+
+	f := foundation.New(foundation.Options{Environment: foundation.Test, Logger: foundation.NewNopLogger()})
+	f.Health.AddLivenessCheck("goroutines", func(context.Context) error { return nil })
+	f.Health.AddReadinessCheck("db:primary", func(context.Context) error { return errors.New("connection refused") })
+
+	tests := []struct {
+		name       string
+		givenPath  string
+		wantCode   int
+		wantChecks map[string]string
+	}{
+		{
+			name:       "liveness ignores readiness",
+			givenPath:  foundation.LivenessPath,
+			wantCode:   http.StatusOK,
+			wantChecks: map[string]string{"goroutines": "ok"},
+		},
+		{
+			name:       "readiness reports failing check",
+			givenPath:  foundation.ReadinessPath,
+			wantCode:   http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"db:primary": "connection refused"},
+		},
+		{
+			name:       "health runs every check",
+			givenPath:  foundation.HealthPath,
+			wantCode:   http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"goroutines": "ok", "db:primary": "connection refused"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp := httptest.NewRecorder()
+			f.HTTPRouter.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tc.givenPath, nil))
+
+			var report foundation.HealthReport
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+			assert.Equal(t, tc.wantCode, resp.Code)
+			assert.Equal(t, tc.wantChecks, report.Checks)
+		})
+	}
+}
+
+func Test_ReadinessFailsWhenShuttingDown(t *testing.T) {
+	t.Parallel()
+
+	health := foundation.NewHealth()
+	health.AddReadinessCheck("db:primary", func(context.Context) error { return nil })
+	assert.True(t, health.Ready(context.Background()).OK())
+
+	health.SetShuttingDown()
+
+	report := health.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, foundation.ErrShuttingDown.Error(), report.Checks["shutdown"])
+	assert.True(t, health.Live(context.Background()).OK())
+}
+
+func Test_GRPCHealthServer(t *testing.T) {
+	t.Parallel()
+
+	health := foundation.NewHealth()
+	health.AddReadinessCheck("pubsub", func(context.Context) error { return errors.New("emulator unavailable") })
+	server := health.GRPCServer()
+
+	resp, err := server.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+
+	_, err = server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func Test_ProcessorsRegisterReadinessChecks(t *testing.T) {
+	t.Parallel()
+
+	f := newTestFoundation()
+	f.AddNamedProcessor("db", &testProcessor{name: "db", log: &eventLog{}})
+
+	report := f.Health.Ready(context.Background())
+	assert.Equal(t, "pending", report.Checks["processor:db"])
+
+	require.Empty(t, f.StartProcessors(context.Background()))
+	assert.True(t, f.Health.Ready(context.Background()).OK())
+}
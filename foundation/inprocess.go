@@ -0,0 +1,85 @@
+package foundation
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc/peer"
+)
+
+// inProcessAddr is the address of both ends of an inProcessListener connection.
+type inProcessAddr struct{}
+
+func (inProcessAddr) Network() string { return "inprocess" }
+func (inProcessAddr) String() string  { return "inprocess" }
+
+// inProcessConn reports inProcessAddr rather than net.Pipe's own addresses, so the server can tell the calls made
+// over it, see IsInProcessCall.
+type inProcessConn struct {
+	net.Conn
+}
+
+func (inProcessConn) LocalAddr() net.Addr  { return inProcessAddr{} }
+func (inProcessConn) RemoteAddr() net.Addr { return inProcessAddr{} }
+
+// inProcessListener is a net.Listener whose connections are net.Pipes dialed from the same process, used by the
+// gRPC gateway to call GRPCServer without going through the network.
+type inProcessListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var errInProcessListenerClosed = errors.New("[foundation] in-process listener closed")
+
+func newInProcessListener() *inProcessListener {
+	return &inProcessListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *inProcessListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errInProcessListenerClosed
+	}
+}
+
+func (l *inProcessListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *inProcessListener) Addr() net.Addr {
+	return inProcessAddr{}
+}
+
+// DialContext connects to the listener, waiting for it to accept the connection.
+func (l *inProcessListener) DialContext(ctx context.Context) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- inProcessConn{server}:
+		return inProcessConn{client}, nil
+	case <-l.done:
+	case <-ctx.Done():
+	}
+	server.Close()
+	client.Close()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, errInProcessListenerClosed
+}
+
+// IsInProcessCall reports whether the gRPC call in ctx came from this process, through the gRPC gateway, rather
+// than over the network.
+func IsInProcessCall(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	_, inProcess := p.Addr.(inProcessAddr)
+	return inProcess
+}
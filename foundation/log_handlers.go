@@ -0,0 +1,184 @@
+package foundation
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type logAttrsKey struct{}
+
+// ContextWithLogAttrs returns a copy of ctx carrying request scoped log attributes, added to every record logged
+// with that context through a ContextHandler.
+func ContextWithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	merged = append(merged, existing...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, logAttrsKey{}, merged)
+}
+
+// LogAttrsFromContext returns the attributes stored by ContextWithLogAttrs.
+func LogAttrsFromContext(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// ContextHandler adds the attributes stored with ContextWithLogAttrs to each record. Attributes the logger already
+// carries, ex. a request_id added with Logger.With, are not repeated.
+type ContextHandler struct {
+	next slog.Handler
+	keys map[string]struct{}
+}
+
+func NewContextHandler(next slog.Handler) *ContextHandler {
+	return &ContextHandler{next: next}
+}
+
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	for _, attr := range LogAttrsFromContext(ctx) {
+		if _, found := h.keys[attr.Key]; !found {
+			record.AddAttrs(attr)
+		}
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	keys := make(map[string]struct{}, len(h.keys)+len(attrs))
+	for key := range h.keys {
+		keys[key] = struct{}{}
+	}
+	for _, attr := range attrs {
+		keys[attr.Key] = struct{}{}
+	}
+	return &ContextHandler{next: h.next.WithAttrs(attrs), keys: keys}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{next: h.next.WithGroup(name), keys: h.keys}
+}
+
+// ZapHandler is an slog.Handler writing to a zap logger, so zap encoders, sampling and cores keep working behind
+// the slog API. Groups become zap namespaces and the caller is taken from the record.
+type ZapHandler struct {
+	logger *zap.Logger
+}
+
+// NewZapHandler returns a handler writing to logger. Records at LevelFatal are written at zap's fatal level but do
+// not exit, that is left to Logger.Fatal.
+func NewZapHandler(logger *zap.Logger) *ZapHandler {
+	return &ZapHandler{logger: logger.WithOptions(zap.WithFatalHook(zapcore.WriteThenNoop))}
+}
+
+func (h *ZapHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Core().Enabled(zapLevel(level))
+}
+
+func (h *ZapHandler) Handle(_ context.Context, record slog.Record) error {
+	entry := h.logger.Check(zapLevel(record.Level), record.Message)
+	if entry == nil {
+		return nil
+	}
+	if !record.Time.IsZero() {
+		entry.Time = record.Time
+	}
+	if record.PC != 0 && entry.Caller.Defined {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		entry.Caller = zapcore.NewEntryCaller(frame.PC, frame.File, frame.Line, true)
+		entry.Caller.Function = frame.Function
+	}
+	fields := make([]zap.Field, 0, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendZapFields(fields, attr)
+		return true
+	})
+	entry.Write(fields...)
+	return nil
+}
+
+func (h *ZapHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]zap.Field, 0, len(attrs))
+	for _, attr := range attrs {
+		fields = appendZapFields(fields, attr)
+	}
+	return &ZapHandler{logger: h.logger.With(fields...)}
+}
+
+func (h *ZapHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &ZapHandler{logger: h.logger.With(zap.Namespace(name))}
+}
+
+func zapLevel(level slog.Level) zapcore.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return zapcore.DebugLevel
+	case level < slog.LevelWarn:
+		return zapcore.InfoLevel
+	case level < slog.LevelError:
+		return zapcore.WarnLevel
+	case level < LevelFatal:
+		return zapcore.ErrorLevel
+	}
+	return zapcore.FatalLevel
+}
+
+func appendZapFields(fields []zap.Field, attr slog.Attr) []zap.Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+	value := attr.Value
+	switch value.Kind() {
+	case slog.KindString:
+		return append(fields, zap.String(attr.Key, value.String()))
+	case slog.KindInt64:
+		return append(fields, zap.Int64(attr.Key, value.Int64()))
+	case slog.KindUint64:
+		return append(fields, zap.Uint64(attr.Key, value.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, zap.Float64(attr.Key, value.Float64()))
+	case slog.KindBool:
+		return append(fields, zap.Bool(attr.Key, value.Bool()))
+	case slog.KindDuration:
+		return append(fields, zap.Duration(attr.Key, value.Duration()))
+	case slog.KindTime:
+		return append(fields, zap.Time(attr.Key, value.Time()))
+	case slog.KindGroup:
+		attrs := value.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if attr.Key == "" {
+			for _, attr := range attrs {
+				fields = appendZapFields(fields, attr)
+			}
+			return fields
+		}
+		return append(fields, zap.Object(attr.Key, zapGroup(attrs)))
+	}
+	return append(fields, zap.Any(attr.Key, value.Any()))
+}
+
+type zapGroup []slog.Attr
+
+func (g zapGroup) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	var fields []zap.Field
+	for _, attr := range g {
+		fields = appendZapFields(fields, attr)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	return nil
+}
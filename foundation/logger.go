@@ -1,6 +1,10 @@
 package foundation
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
 	"runtime"
 	"strings"
 	"time"
@@ -9,18 +13,193 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-// TODO: REplace with slog golang standard library
-
+// Logger is the logging API used across foundation, built on log/slog. Arguments are slog key-value pairs or
+// slog.Attr values; zap.Field values are still accepted and converted while call sites migrate.
+//
+// The *Context methods pass ctx to the handler, so a ContextHandler adds the request scoped attributes stored with
+// ContextWithLogAttrs.
 type Logger interface {
-	Debug(msg string, fields ...zap.Field)
-	Error(msg string, fields ...zap.Field)
-	Fatal(msg string, fields ...zap.Field)
-	Info(msg string, fields ...zap.Field)
-	Warn(msg string, fields ...zap.Field)
-	With(fields ...zap.Field) *zap.Logger
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+	// Fatal logs at LevelFatal and exits the process.
+	Fatal(msg string, args ...any)
+	DebugContext(ctx context.Context, msg string, args ...any)
+	InfoContext(ctx context.Context, msg string, args ...any)
+	WarnContext(ctx context.Context, msg string, args ...any)
+	ErrorContext(ctx context.Context, msg string, args ...any)
+	With(args ...any) Logger
+	// Slog returns the underlying *slog.Logger, for libraries that take one.
+	Slog() *slog.Logger
+}
+
+// LevelFatal is the level Logger.Fatal logs at.
+const LevelFatal = slog.Level(12)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing to handler, wrapped in a ContextHandler.
+func NewSlogLogger(handler slog.Handler) Logger {
+	if _, ok := handler.(*ContextHandler); !ok {
+		handler = NewContextHandler(handler)
+	}
+	return &slogLogger{logger: slog.New(handler)}
+}
+
+// NewZapLogger returns a Logger writing to logger through a ZapHandler.
+func NewZapLogger(logger *zap.Logger) Logger {
+	return NewSlogLogger(NewZapHandler(logger))
+}
+
+// NewNopLogger returns a Logger that discards everything, for tests.
+func NewNopLogger() Logger {
+	return NewZapLogger(zap.NewNop())
+}
+
+func (l *slogLogger) Debug(msg string, args ...any) {
+	l.log(context.Background(), slog.LevelDebug, msg, args)
+}
+
+func (l *slogLogger) Info(msg string, args ...any) {
+	l.log(context.Background(), slog.LevelInfo, msg, args)
+}
+
+func (l *slogLogger) Warn(msg string, args ...any) {
+	l.log(context.Background(), slog.LevelWarn, msg, args)
+}
+
+func (l *slogLogger) Error(msg string, args ...any) {
+	l.log(context.Background(), slog.LevelError, msg, args)
+}
+
+func (l *slogLogger) Fatal(msg string, args ...any) {
+	l.log(context.Background(), LevelFatal, msg, args)
+	os.Exit(1)
+}
+
+func (l *slogLogger) DebugContext(ctx context.Context, msg string, args ...any) {
+	l.log(ctx, slog.LevelDebug, msg, args)
+}
+
+func (l *slogLogger) InfoContext(ctx context.Context, msg string, args ...any) {
+	l.log(ctx, slog.LevelInfo, msg, args)
+}
+
+func (l *slogLogger) WarnContext(ctx context.Context, msg string, args ...any) {
+	l.log(ctx, slog.LevelWarn, msg, args)
+}
+
+func (l *slogLogger) ErrorContext(ctx context.Context, msg string, args ...any) {
+	l.log(ctx, slog.LevelError, msg, args)
+}
+
+func (l *slogLogger) With(args ...any) Logger {
+	return &slogLogger{logger: l.logger.With(zapArgs(args)...)}
 }
 
+func (l *slogLogger) Slog() *slog.Logger {
+	return l.logger
+}
+
+// log mirrors slog.Logger.log so the record points at the caller of the Logger method.
+func (l *slogLogger) log(ctx context.Context, level slog.Level, msg string, args []any) {
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip Callers, log and the Logger method
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	record.Add(zapArgs(args)...)
+	_ = l.logger.Handler().Handle(ctx, record)
+}
+
+// zapArgs replaces the zap.Field values in args with slog attributes.
+func zapArgs(args []any) []any {
+	var converted []any
+	for i, arg := range args {
+		field, ok := arg.(zap.Field)
+		if !ok {
+			continue
+		}
+		if converted == nil {
+			converted = make([]any, len(args))
+			copy(converted, args)
+		}
+		converted[i] = ZapFieldAttr(field)
+	}
+	if converted == nil {
+		return args
+	}
+	return converted
+}
+
+// ZapFieldAttr converts a zap.Field to an slog.Attr.
+func ZapFieldAttr(field zap.Field) slog.Attr {
+	switch field.Type {
+	case zapcore.StringType:
+		return slog.String(field.Key, field.String)
+	case zapcore.BoolType:
+		return slog.Bool(field.Key, field.Integer == 1)
+	case zapcore.Int64Type, zapcore.Int32Type, zapcore.Int16Type, zapcore.Int8Type:
+		return slog.Int64(field.Key, field.Integer)
+	case zapcore.DurationType:
+		return slog.Duration(field.Key, time.Duration(field.Integer))
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok {
+			return slog.Any(field.Key, err)
+		}
+	case zapcore.StringerType:
+		if stringer, ok := field.Interface.(fmt.Stringer); ok {
+			return slog.String(field.Key, stringer.String())
+		}
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	field.AddTo(enc)
+	if value, found := enc.Fields[field.Key]; found && len(enc.Fields) == 1 {
+		return slog.Any(field.Key, value)
+	}
+	attrs := make([]any, 0, len(enc.Fields))
+	for key, value := range enc.Fields {
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	// fields like zap.Error add more than their own key, ex. errorVerbose, so they are inlined
+	return slog.Group("", attrs...)
+}
+
+// NewDefaultLogger returns a Logger with a zap backend configured for environment, writing the Cloud Logging
+// structured format to stderr.
 func NewDefaultLogger(environment string) (Logger, error) {
+	logger, err := loggerConfig(environment).Build(zap.WrapCore(WrapCloudLoggingCore))
+	if err != nil {
+		return nil, err
+	}
+	return NewZapLogger(logger), nil
+}
+
+// NewLogger is NewDefaultLogger logging at level, which can be changed while running, ex. on config reload.
+func NewLogger(environment string, level zap.AtomicLevel) (Logger, error) {
+	config := loggerConfig(environment)
+	config.Level = level
+	logger, err := config.Build(zap.WrapCore(WrapCloudLoggingCore))
+	if err != nil {
+		return nil, err
+	}
+	return NewZapLogger(logger), nil
+}
+
+// DefaultLogLevel is the level NewDefaultLogger logs at in environment.
+func DefaultLogLevel(environment string) zapcore.Level {
+	switch environment {
+	case "", Development, Test:
+		return zapcore.DebugLevel
+	}
+	return zapcore.InfoLevel
+}
+
+func loggerConfig(environment string) zap.Config {
 	config := zap.Config{}
 
 	if environment == "" {
@@ -34,17 +213,10 @@ func NewDefaultLogger(environment string) (Logger, error) {
 		config = zap.NewProductionConfig()
 	}
 
+	// the same Cloud Logging format everywhere, so local logs group under request traces too
 	config.Encoding = "json"
-	config.EncoderConfig.EncodeLevel = func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
-		lvl := l.CapitalString()
-		if lvl == "WARN" {
-			lvl = "WARNING"
-		}
-		enc.AppendString(lvl + ":")
-	}
-	config.EncoderConfig.EncodeTime = zapcore.RFC3339TimeEncoder
-	config.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
-	return config.Build()
+	config.EncoderConfig = CloudLoggingEncoderConfig()
+	return config
 }
 
 func LogExecutionTime(l Logger, methodOverride string, fn func()) {
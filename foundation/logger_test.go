@@ -0,0 +1,98 @@
+package foundation_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_ZapLogger(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := foundation.NewZapLogger(zap.New(core, zap.AddCaller()))
+
+	tests := []struct {
+		name       string
+		log        func(ctx context.Context)
+		wantLevel  zapcore.Level
+		wantFields map[string]interface{}
+	}{
+		{
+			name: "slog key values and attrs",
+			log: func(ctx context.Context) {
+				logger.Info("handled", "status", 200, slog.Bool("cached", true))
+			},
+			wantLevel:  zapcore.InfoLevel,
+			wantFields: map[string]interface{}{"status": int64(200), "cached": true},
+		},
+		{
+			name: "zap fields",
+			log: func(ctx context.Context) {
+				logger.Warn("slow", zap.String("path", "/orders"), zap.Duration("latency", time.Second), zap.Error(errors.New("boom")))
+			},
+			wantLevel:  zapcore.WarnLevel,
+			wantFields: map[string]interface{}{"path": "/orders", "latency": time.Second, "error": "boom"},
+		},
+		{
+			name: "with and groups",
+			log: func(ctx context.Context) {
+				logger.With(zap.String("client", "orders")).Debug("call", slog.Group("grpc", slog.String("code", "OK")))
+			},
+			wantLevel:  zapcore.DebugLevel,
+			wantFields: map[string]interface{}{"client": "orders", "grpc": map[string]interface{}{"code": "OK"}},
+		},
+		{
+			name: "context attrs",
+			log: func(ctx context.Context) {
+				ctx = foundation.ContextWithLogAttrs(ctx, slog.String("request_id", "abc"), slog.String("tenant", "acme"))
+				logger.With("request_id", "abc").ErrorContext(ctx, "failed")
+			},
+			wantLevel:  zapcore.ErrorLevel,
+			wantFields: map[string]interface{}{"request_id": "abc", "tenant": "acme"},
+		},
+	}
+
+	// subtests share the observer, so they run in order
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.log(context.Background())
+			entries := logs.TakeAll()
+			require.Len(t, entries, 1)
+			assert.Equal(t, tc.wantLevel, entries[0].Level)
+			assert.Equal(t, tc.wantFields, entries[0].ContextMap())
+			assert.Equal(t, "logger_test.go", filepath.Base(entries[0].Caller.File), "caller is the call site")
+		})
+	}
+}
+
+func Test_SlogLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := foundation.NewSlogLogger(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	ctx := foundation.ContextWithLogAttrs(context.Background(), slog.String("request_id", "abc"))
+
+	logger.DebugContext(ctx, "dropped")
+	logger.InfoContext(ctx, "kept", zap.Int("items", 3))
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "kept", got["msg"])
+	assert.Equal(t, "abc", got["request_id"])
+	assert.Equal(t, float64(3), got["items"])
+	assert.NotNil(t, logger.Slog())
+}
@@ -0,0 +1,157 @@
+package foundation
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsPath is where the admin server serves the Prometheus metrics.
+const MetricsPath = "/metrics"
+
+// unmatchedRoute labels requests that matched no route, so scanners probing random paths cannot blow up the
+// number of series.
+const unmatchedRoute = "unmatched"
+
+// Metrics holds the Prometheus registry of a Foundation and the request (RED) metrics recorded for the HTTP router
+// and gRPC server: request counts by status, which give the error rate, and latency histograms.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	grpcRequests *prometheus.CounterVec
+	grpcDuration *prometheus.HistogramVec
+}
+
+// NewMetrics returns a registry with the Go runtime, process and request metrics registered.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests handled, by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time to handle HTTP requests, by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "gRPC calls handled, by service, method and status code.",
+		}, []string{"grpc_service", "grpc_method", "grpc_code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Time to handle gRPC calls, by service and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"grpc_service", "grpc_method"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration, m.grpcRequests, m.grpcDuration,
+	)
+	return m
+}
+
+// Register adds the service's own collectors to the registry.
+func (m *Metrics) Register(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := m.Registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// HTTPMetrics returns a gin middleware recording every request under its route pattern, ex. "/orders/:id", rather
+// than the raw path. New installs it on the router.
+func HTTPMetrics(m *Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		m.httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		m.httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// UnaryServerMetrics returns an interceptor recording every call by method and status code. New installs it on the
+// gRPC server.
+func UnaryServerMetrics(m *Metrics) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.observeGRPC(info.FullMethod, err, start)
+		return resp, err
+	}
+}
+
+// StreamServerMetrics is the streaming counterpart of UnaryServerMetrics, a stream is recorded once it ends.
+func StreamServerMetrics(m *Metrics) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		m.observeGRPC(info.FullMethod, err, start)
+		return err
+	}
+}
+
+func (m *Metrics) observeGRPC(fullMethod string, err error, start time.Time) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	m.grpcRequests.WithLabelValues(service, method, status.Code(err).String()).Inc()
+	m.grpcDuration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+}
+
+// processorCollector reports the supervisor's processors at scrape time.
+type processorCollector struct {
+	statuses func() []ProcessorStatus
+	up       *prometheus.Desc
+	restarts *prometheus.Desc
+}
+
+func newProcessorCollector(statuses func() []ProcessorStatus) prometheus.Collector {
+	return &processorCollector{
+		statuses: statuses,
+		up: prometheus.NewDesc("foundation_processor_up",
+			"Whether the processor is running.", []string{"processor"}, nil),
+		restarts: prometheus.NewDesc("foundation_processor_restarts_total",
+			"Times the processor was restarted after crashing or failing to start.", []string{"processor"}, nil),
+	}
+}
+
+func (c *processorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.restarts
+}
+
+func (c *processorCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, status := range c.statuses() {
+		up := 0.0
+		if status.State == ProcessorRunning {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up, status.Name)
+		ch <- prometheus.MustNewConstMetric(c.restarts, prometheus.CounterValue, float64(status.Restarts), status.Name)
+	}
+}
@@ -0,0 +1,97 @@
+package foundation_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_HTTPMetrics(t *testing.T) {
+	t.Parallel()
+
+	f := newTestFoundation()
+	f.HTTPRouter.GET("/orders/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, path := range []string{"/orders/1", "/orders/2", "/wp-login.php", foundation.LivenessPath} {
+		f.HTTPRouter.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	want := `
+# HELP http_requests_total HTTP requests handled, by method, route and status code.
+# TYPE http_requests_total counter
+http_requests_total{code="200",method="GET",route="/orders/:id"} 2
+http_requests_total{code="404",method="GET",route="unmatched"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(f.Metrics.Registry, strings.NewReader(want), "http_requests_total"))
+	count, err := testutil.GatherAndCount(f.Metrics.Registry, "http_request_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func Test_GRPCMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := foundation.NewMetrics()
+	interceptor := foundation.UnaryServerMetrics(metrics)
+	info := &grpc.UnaryServerInfo{FullMethod: "/orders.v1.Orders/GetOrder"}
+	for _, err := range []error{nil, status.Error(codes.NotFound, "no such order")} {
+		_, _ = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, err
+		})
+	}
+
+	want := `
+# HELP grpc_server_handled_total gRPC calls handled, by service, method and status code.
+# TYPE grpc_server_handled_total counter
+grpc_server_handled_total{grpc_code="NotFound",grpc_method="GetOrder",grpc_service="orders.v1.Orders"} 1
+grpc_server_handled_total{grpc_code="OK",grpc_method="GetOrder",grpc_service="orders.v1.Orders"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(metrics.Registry, strings.NewReader(want), "grpc_server_handled_total"))
+}
+
+func Test_AdminServerServesMetrics(t *testing.T) {
+	t.Parallel()
+
+	port := freePort(t)
+	f := foundation.New(foundation.Options{Environment: foundation.Test, Logger: foundation.NewNopLogger(), AdminPort: port})
+	f.AddNamedProcessor("relay", &testProcessor{name: "relay", log: &eventLog{}})
+	orders := prometheus.NewCounter(prometheus.CounterOpts{Name: "orders_created_total", Help: "Orders created."})
+	require.NoError(t, f.Metrics.Register(orders))
+	orders.Add(3)
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- f.RunWithContext(ctx, stop) }()
+	defer func() {
+		stop()
+		<-done
+	}()
+
+	var body string
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://127.0.0.1:" + port + foundation.MetricsPath)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body = string(data)
+		return resp.StatusCode == http.StatusOK && strings.Contains(body, `foundation_processor_up{processor="relay"} 1`)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, body, `foundation_processor_restarts_total{processor="relay"} 0`)
+	assert.Contains(t, body, "orders_created_total 3")
+	assert.Contains(t, body, "go_goroutines")
+}
@@ -2,47 +2,80 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
 
 	"github.com/OptechLabs/monorepo/foundation"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-// BasicAuth returns a middleware that allows you to use basic authentication...not for real production
-func BasicAuth(environment string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		if environment != "development" {
-			logger := foundation.LoggerFrom(c)
-			username, password, ok := c.Request.BasicAuth()
-			if !ok {
-				logger.Warn("no basic auth present")
-				c.Header("WWW-Authenticate", `Basic realm="Give username and password"`)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "No basic auth present"})
-				return
-			}
-
-			if !isAuthorised(username, password) {
-				logger.Warn("incorrect basic auth present")
-				c.Header("WWW-Authenticate", `Basic realm="Give username and password"`)
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "No basic auth present"})
-				return
-			}
-			logger.Info("basic auth successful")
-		}
-		c.Next()
-	}
+// BasicAuthConfig defines the config for BasicAuth middleware.
+type BasicAuthConfig struct {
+	// Store authenticates the credentials.
+	// Required.
+	Store CredentialStore
+
+	// Realm is sent in the WWW-Authenticate challenge and passed to Store so users can be limited to a route group.
+	// Optional. Default value "Restricted".
+	Realm string
+
+	// SkipEnvironments is a list of foundation environments in which authentication is not enforced.
+	// Optional.
+	SkipEnvironments []string
 }
 
-func isAuthorised(username, password string) bool {
-	users := map[string]string{
-		"optech":  "ProtectYoNeck",
-		"barrett": "Since1941",
-		"tpj":     "UncrushEm",
-	}
+const DefaultBasicAuthRealm = "Restricted"
 
-	pass, ok := users[username]
-	if !ok {
-		return false
+// BasicAuth returns a middleware that authenticates requests against store, skipped in development.
+func BasicAuth(environment string, store CredentialStore) gin.HandlerFunc {
+	return BasicAuthWithConfig(environment, BasicAuthConfig{
+		Store:            store,
+		SkipEnvironments: []string{foundation.Development},
+	})
+}
+
+// BasicAuthWithConfig returns a BasicAuth middleware with config. Use one per route group to give each group its
+// own realm and skip rules. It panics when conf.Store is nil.
+func BasicAuthWithConfig(environment string, conf BasicAuthConfig) gin.HandlerFunc {
+	if conf.Store == nil {
+		panic("[foundation] basic auth needs a credential store")
+	}
+	if conf.Realm == "" {
+		conf.Realm = DefaultBasicAuthRealm
 	}
+	skip := slices.Contains(conf.SkipEnvironments, environment)
+	challenge := `Basic realm="` + conf.Realm + `", charset="UTF-8"`
 
-	return password == pass
+	return func(c *gin.Context) {
+		if skip {
+			c.Next()
+			return
+		}
+
+		logger := foundation.LoggerFrom(c)
+		username, password, ok := c.Request.BasicAuth()
+		if !ok {
+			logger.Warn("no basic auth present")
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "No basic auth present"})
+			return
+		}
+
+		authorised, err := conf.Store.Authenticate(c.Request.Context(), conf.Realm, username, password)
+		if err != nil {
+			logger.Error("basic auth credential store failed", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Unable to authenticate"})
+			return
+		}
+		if !authorised {
+			logger.Warn("incorrect basic auth present", zap.String("username", username))
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "No basic auth present"})
+			return
+		}
+
+		logger.Info("basic auth successful", zap.String("username", username))
+		c.Set(gin.AuthUserKey, username)
+		c.Next()
+	}
 }
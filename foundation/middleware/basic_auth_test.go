@@ -0,0 +1,161 @@
+package middleware_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func argon2idHash(t *testing.T, password string) string {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	require.NoError(t, err)
+	key := argon2.IDKey([]byte(password), salt, 1, 64*1024, 1, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 64*1024, 1, 1,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func bcryptHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return string(hash)
+}
+
+func Test_BasicAuth(t *testing.T) {
+	t.Parallel()
+
+	memory := middleware.NewMemoryCredentialStore()
+	memory.Add("optech", "ProtectYoNeck", "")
+	memory.Add("ops", "Since1941", "admin")
+
+	hashed, err := middleware.NewHashedCredentialStore(map[string]config.BasicAuthUser{
+		"barrett": {PasswordHash: bcryptHash(t, "Since1941")},
+		"tpj":     {PasswordHash: argon2idHash(t, "UncrushEm"), Realm: "admin"},
+	})
+	require.NoError(t, err)
+
+	htpasswdFile := filepath.Join(t.TempDir(), ".htpasswd")
+	require.NoError(t, os.WriteFile(htpasswdFile, []byte(
+		"# generated by htpasswd -B\n"+
+			"wu:"+bcryptHash(t, "Tang")+"\n"+
+			"legacy:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"), 0o600))
+	htpasswd, err := middleware.LoadHtpasswdFile(htpasswdFile, "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		givenEnv  string
+		givenConf middleware.BasicAuthConfig
+		givenUser string
+		givenPass string
+		wantCode  int
+	}{
+		{name: "no credentials", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: memory}, wantCode: http.StatusUnauthorized},
+		{name: "memory store", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: memory}, givenUser: "optech", givenPass: "ProtectYoNeck", wantCode: http.StatusOK},
+		{name: "wrong password", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: memory}, givenUser: "optech", givenPass: "protectyoneck", wantCode: http.StatusUnauthorized},
+		{name: "unknown user", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: hashed}, givenUser: "nobody", givenPass: "", wantCode: http.StatusUnauthorized},
+		{name: "bcrypt", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: hashed}, givenUser: "barrett", givenPass: "Since1941", wantCode: http.StatusOK},
+		{name: "argon2id", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: hashed, Realm: "admin"}, givenUser: "tpj", givenPass: "UncrushEm", wantCode: http.StatusOK},
+		{name: "wrong realm", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: hashed}, givenUser: "tpj", givenPass: "UncrushEm", wantCode: http.StatusUnauthorized},
+		{name: "memory wrong realm", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: memory, Realm: "reports"}, givenUser: "ops", givenPass: "Since1941", wantCode: http.StatusUnauthorized},
+		{name: "htpasswd bcrypt", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: htpasswd}, givenUser: "wu", givenPass: "Tang", wantCode: http.StatusOK},
+		{name: "htpasswd sha", givenEnv: foundation.Production, givenConf: middleware.BasicAuthConfig{Store: htpasswd}, givenUser: "legacy", givenPass: "password", wantCode: http.StatusOK},
+		{name: "skipped environment", givenEnv: foundation.Test, givenConf: middleware.BasicAuthConfig{Store: memory, SkipEnvironments: []string{foundation.Development, foundation.Test}}, wantCode: http.StatusOK},
+		{name: "not skipped environment", givenEnv: foundation.Staging, givenConf: middleware.BasicAuthConfig{Store: memory, SkipEnvironments: []string{foundation.Development}}, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.New()
+			router.Use(middleware.BasicAuthWithConfig(tc.givenEnv, tc.givenConf))
+			router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.givenUser != "" {
+				req.SetBasicAuth(tc.givenUser, tc.givenPass)
+			}
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			if tc.wantCode == http.StatusUnauthorized {
+				assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "Basic realm=")
+			}
+		})
+	}
+}
+
+func Test_BasicAuthSkipsDevelopment(t *testing.T) {
+	t.Parallel()
+
+	router := gin.New()
+	router.Use(middleware.BasicAuth(foundation.Development, middleware.NewMemoryCredentialStore()))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func Test_BasicAuthRequiresStore(t *testing.T) {
+	t.Parallel()
+
+	assert.PanicsWithValue(t, "[foundation] basic auth needs a credential store", func() {
+		middleware.BasicAuth(foundation.Production, nil)
+	})
+}
+
+func Test_NewHashedCredentialStoreRejectsUnknownHashes(t *testing.T) {
+	t.Parallel()
+
+	_, err := middleware.NewHashedCredentialStore(map[string]config.BasicAuthUser{
+		"optech": {PasswordHash: "ProtectYoNeck"},
+	})
+	assert.ErrorContains(t, err, `basic auth user "optech"`)
+}
+
+func Test_NewHashedCredentialStoreRejectsMalformedArgon2Parameters(t *testing.T) {
+	t.Parallel()
+
+	salt := base64.RawStdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	key := base64.RawStdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	tests := []struct {
+		name  string
+		given string
+	}{
+		{name: "no passes", given: fmt.Sprintf("$argon2id$v=%d$m=65536,t=0,p=1$%s$%s", argon2.Version, salt, key)},
+		{name: "no threads", given: fmt.Sprintf("$argon2id$v=%d$m=65536,t=1,p=0$%s$%s", argon2.Version, salt, key)},
+		{name: "too little memory", given: fmt.Sprintf("$argon2id$v=%d$m=7,t=1,p=1$%s$%s", argon2.Version, salt, key)},
+		{name: "no memory", given: fmt.Sprintf("$argon2id$v=%d$m=0,t=1,p=1$%s$%s", argon2.Version, salt, key)},
+		{name: "empty salt", given: fmt.Sprintf("$argon2id$v=%d$m=65536,t=1,p=1$$%s", argon2.Version, key)},
+		{name: "empty key", given: fmt.Sprintf("$argon2id$v=%d$m=65536,t=1,p=1$%s$", argon2.Version, salt)},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := middleware.NewHashedCredentialStore(map[string]config.BasicAuthUser{
+				"optech": {PasswordHash: tc.given},
+			})
+			assert.ErrorContains(t, err, "malformed argon2id parameters")
+		})
+	}
+}
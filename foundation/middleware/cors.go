@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig defines the cross-origin requests SecurityPolicy allows.
+type CORSConfig struct {
+	// AllowOrigins are the origins allowed, ex. "https://app.optech.com". One "*" matches any part of an origin, ex.
+	// "https://*.optech.com" or "http://localhost:*", and "*" alone any origin.
+	AllowOrigins []string
+
+	// AllowOriginFunc allows origins not in AllowOrigins.
+	// Optional.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowMethods are the methods allowed in preflight requests.
+	// Optional. Default value GET, HEAD, POST, PUT, PATCH and DELETE.
+	AllowMethods []string
+
+	// AllowHeaders are the request headers allowed in preflight requests, "*" allows any.
+	// Optional. Default value Authorization, Content-Type, X-Request-ID and X-API-Key.
+	AllowHeaders []string
+
+	// ExposeHeaders are the response headers scripts may read on top of the CORS-safelisted ones.
+	// Optional. Default value X-Request-ID and the rate limit headers.
+	ExposeHeaders []string
+
+	// AllowCredentials lets browsers send cookies and authorization headers. The request's origin is then echoed
+	// instead of "*".
+	// Optional.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers cache a preflight response.
+	// Optional.
+	MaxAge time.Duration
+}
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", RequestIDField, DefaultAPIKeyHeader}
+	defaultCORSExposed = []string{RequestIDField, RateLimitLimitHeader, RateLimitRemainingHeader, RateLimitResetHeader, RetryAfterHeader}
+)
+
+// corsPolicy is a CORSConfig compiled by newCORSPolicy.
+type corsPolicy struct {
+	anyOrigin       bool
+	origins         map[string]struct{}
+	patterns        []originPattern
+	allowOriginFunc func(origin string) bool
+	methods         map[string]struct{}
+	anyHeader       bool
+	headers         map[string]struct{}
+	credentials     bool
+
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+type originPattern struct {
+	prefix, suffix string
+}
+
+func newCORSPolicy(conf CORSConfig) *corsPolicy {
+	if conf.AllowMethods == nil {
+		conf.AllowMethods = defaultCORSMethods
+	}
+	if conf.AllowHeaders == nil {
+		conf.AllowHeaders = defaultCORSHeaders
+	}
+	if conf.ExposeHeaders == nil {
+		conf.ExposeHeaders = defaultCORSExposed
+	}
+
+	p := &corsPolicy{
+		origins:         map[string]struct{}{},
+		allowOriginFunc: conf.AllowOriginFunc,
+		methods:         map[string]struct{}{},
+		headers:         map[string]struct{}{},
+		credentials:     conf.AllowCredentials,
+		exposeHeaders:   strings.Join(conf.ExposeHeaders, ", "),
+	}
+	for _, origin := range conf.AllowOrigins {
+		origin = strings.ToLower(origin)
+		switch strings.Count(origin, "*") {
+		case 0:
+			p.origins[origin] = struct{}{}
+		case 1:
+			if origin == "*" {
+				p.anyOrigin = true
+				continue
+			}
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			p.patterns = append(p.patterns, originPattern{prefix: prefix, suffix: suffix})
+		default:
+			panic("[foundation] CORS origin " + origin + " has more than one wildcard")
+		}
+	}
+
+	methods := make([]string, len(conf.AllowMethods))
+	for i, method := range conf.AllowMethods {
+		methods[i] = strings.ToUpper(method)
+		p.methods[methods[i]] = struct{}{}
+	}
+	p.allowMethods = strings.Join(methods, ", ")
+	for _, header := range conf.AllowHeaders {
+		if header == "*" {
+			p.anyHeader = true
+			continue
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	p.allowHeaders = strings.Join(conf.AllowHeaders, ", ")
+	if conf.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(conf.MaxAge.Seconds()))
+	}
+	return p
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if _, ok := p.origins[lower]; ok {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if len(lower) > len(pattern.prefix)+len(pattern.suffix) &&
+			strings.HasPrefix(lower, pattern.prefix) && strings.HasSuffix(lower, pattern.suffix) {
+			return true
+		}
+	}
+	return p.allowOriginFunc != nil && p.allowOriginFunc(origin)
+}
+
+// handle adds the CORS headers for cross-origin requests and reports whether it answered a preflight request, with
+// a 204 when it is allowed and a 403 otherwise.
+func (p *corsPolicy) handle(c *gin.Context) bool {
+	origin := c.GetHeader("Origin")
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+	if !p.anyOrigin || p.credentials {
+		c.Writer.Header().Add("Vary", "Origin")
+	}
+	if preflight {
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+	}
+	if origin == "" {
+		return false
+	}
+
+	allowed := p.allowOrigin(origin)
+	if !preflight {
+		// disallowed origins get no CORS headers so browsers hide the response, other clients are not affected
+		if allowed {
+			p.setOrigin(c, origin)
+			if p.exposeHeaders != "" {
+				c.Header("Access-Control-Expose-Headers", p.exposeHeaders)
+			}
+		}
+		return false
+	}
+
+	if !allowed || !p.allowPreflight(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return true
+	}
+	p.setOrigin(c, origin)
+	c.Header("Access-Control-Allow-Methods", p.allowMethods)
+	if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+		if p.anyHeader {
+			c.Header("Access-Control-Allow-Headers", requested)
+		} else {
+			c.Header("Access-Control-Allow-Headers", p.allowHeaders)
+		}
+	}
+	if p.maxAge != "" {
+		c.Header("Access-Control-Max-Age", p.maxAge)
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+	return true
+}
+
+func (p *corsPolicy) allowPreflight(c *gin.Context) bool {
+	if _, ok := p.methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))]; !ok {
+		return false
+	}
+	if p.anyHeader {
+		return true
+	}
+	requested := strings.Split(c.GetHeader("Access-Control-Request-Headers"), ",")
+	return !slices.ContainsFunc(requested, func(header string) bool {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			return false
+		}
+		_, ok := p.headers[http.CanonicalHeaderKey(header)]
+		return !ok
+	})
+}
+
+func (p *corsPolicy) setOrigin(c *gin.Context, origin string) {
+	if p.anyOrigin && !p.credentials {
+		c.Header("Access-Control-Allow-Origin", "*")
+		return
+	}
+	c.Header("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		c.Header("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CredentialStore authenticates basic auth credentials.
+type CredentialStore interface {
+	// Authenticate reports whether password is valid for username within realm. An error is only returned when
+	// the store itself failed, never for bad credentials.
+	Authenticate(ctx context.Context, realm, username, password string) (bool, error)
+}
+
+// MemoryCredentialStore keeps plain text credentials in memory. It is meant for tests and local development.
+type MemoryCredentialStore struct {
+	mu    sync.RWMutex
+	users map[string]memoryUser
+}
+
+type memoryUser struct {
+	password string
+	realm    string
+}
+
+func NewMemoryCredentialStore() *MemoryCredentialStore {
+	return &MemoryCredentialStore{users: map[string]memoryUser{}}
+}
+
+// Add stores a user. An empty realm lets the user authenticate against every realm.
+func (s *MemoryCredentialStore) Add(username, password, realm string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[username] = memoryUser{password: password, realm: realm}
+}
+
+func (s *MemoryCredentialStore) Authenticate(_ context.Context, realm, username, password string) (bool, error) {
+	s.mu.RLock()
+	user, found := s.users[username]
+	s.mu.RUnlock()
+
+	// compare digests so neither the result nor the timing reveals the stored password's length
+	given := sha256.Sum256([]byte(password))
+	stored := sha256.Sum256([]byte(user.password))
+	match := subtle.ConstantTimeCompare(given[:], stored[:]) == 1
+	return found && match && realmAllows(user.realm, realm), nil
+}
+
+// HashedCredentialStore authenticates against bcrypt, argon2id or htpasswd {SHA} password hashes.
+type HashedCredentialStore struct {
+	users map[string]config.BasicAuthUser
+}
+
+// NewHashedCredentialStore builds a store from the users in config.Config.BasicAuthUsers. Every hash is checked up
+// front so a typo fails at startup rather than on the first login.
+func NewHashedCredentialStore(users map[string]config.BasicAuthUser) (*HashedCredentialStore, error) {
+	store := &HashedCredentialStore{users: make(map[string]config.BasicAuthUser, len(users))}
+	for username, user := range users {
+		if _, err := hashScheme(user.PasswordHash); err != nil {
+			return nil, fmt.Errorf("basic auth user %q: %w", username, err)
+		}
+		store.users[username] = user
+	}
+	return store, nil
+}
+
+// LoadHtpasswdFile builds a store from an Apache htpasswd file. Only bcrypt and {SHA} entries are supported. Every
+// user in the file is bound to realm; pass an empty realm to allow them everywhere.
+func LoadHtpasswdFile(path, realm string) (*HashedCredentialStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := map[string]config.BasicAuthUser{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		username, hash, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected username:hash", path, line)
+		}
+		users[username] = config.BasicAuthUser{PasswordHash: hash, Realm: realm}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewHashedCredentialStore(users)
+}
+
+// dummyBcryptHash is compared against when the user does not exist so unknown and known users take the same time.
+var dummyBcryptHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+func (s *HashedCredentialStore) Authenticate(_ context.Context, realm, username, password string) (bool, error) {
+	user, found := s.users[username]
+	if !found {
+		_ = bcrypt.CompareHashAndPassword(dummyBcryptHash, []byte(password))
+		return false, nil
+	}
+	match, err := verifyPassword(user.PasswordHash, password)
+	if err != nil {
+		return false, err
+	}
+	return match && realmAllows(user.Realm, realm), nil
+}
+
+func realmAllows(userRealm, realm string) bool {
+	return userRealm == "" || userRealm == realm
+}
+
+const (
+	schemeBcrypt = "bcrypt"
+	schemeArgon2 = "argon2id"
+	schemeSHA    = "sha"
+)
+
+func hashScheme(hash string) (string, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return schemeBcrypt, nil
+	case strings.HasPrefix(hash, "$argon2id$"):
+		if _, err := parseArgon2Hash(hash); err != nil {
+			return "", err
+		}
+		return schemeArgon2, nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		return schemeSHA, nil
+	}
+	return "", errors.New("unsupported password hash, expected bcrypt, argon2id or {SHA}")
+}
+
+func verifyPassword(hash, password string) (bool, error) {
+	scheme, err := hashScheme(hash)
+	if err != nil {
+		return false, err
+	}
+	switch scheme {
+	case schemeBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case schemeArgon2:
+		params, _ := parseArgon2Hash(hash)
+		derived := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+		return subtle.ConstantTimeCompare(derived, params.key) == 1, nil
+	default:
+		sum := sha1.Sum([]byte(password))
+		derived := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(derived), []byte(hash)) == 1, nil
+	}
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2Hash decodes the PHC string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func parseArgon2Hash(hash string) (argon2Params, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, errors.New("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	// argon2.IDKey panics below these, which must not take down the request verifying a bad row
+	if params.time < 1 || params.threads < 1 || params.memory < 8*uint32(params.threads) {
+		return params, errors.New("malformed argon2id parameters")
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, fmt.Errorf("malformed argon2id key: %w", err)
+	}
+	if len(params.salt) == 0 || len(params.key) == 0 {
+		return params, errors.New("malformed argon2id parameters")
+	}
+	return params, nil
+}
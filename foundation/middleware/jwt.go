@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// JWTConfig defines the config for JWT middleware.
+type JWTConfig struct {
+	// JWKSURL is the endpoint publishing the keys tokens are signed with.
+	JWKSURL string
+
+	// Issuer is the required "iss" claim. NewJWTValidator refuses an empty Issuer.
+	Issuer string
+
+	// Audience is the required "aud" claim. NewJWTValidator refuses an empty Audience, or any token minted by the
+	// issuer, for any API, would be accepted.
+	Audience string
+
+	// Algorithms lists the accepted signing algorithms.
+	// Optional. Default value []string{"RS256"}.
+	Algorithms []string
+
+	// RolesClaim is the claim that holds the user's roles.
+	// Optional. Default value "roles".
+	RolesClaim string
+
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat.
+	// Optional.
+	Leeway time.Duration
+
+	// RefreshInterval is how long fetched keys are trusted before the JWKS endpoint is queried again.
+	// Optional. Default value 1 hour.
+	RefreshInterval time.Duration
+
+	// MinRefreshInterval limits how often an unknown key id can trigger a refresh.
+	// Optional. Default value 1 minute.
+	MinRefreshInterval time.Duration
+
+	// HTTPClient fetches the JWKS.
+	// Optional. Default value a client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// JWTConfigFromAuth0 builds a JWTConfig for tokens issued by the Auth0 tenant in cfg. Without a domain the JWKSURL
+// and Issuer are left empty, for NewJWTValidator to refuse.
+func JWTConfigFromAuth0(cfg config.Auth0Config) JWTConfig {
+	conf := JWTConfig{Audience: cfg.Audience, RolesClaim: cfg.RolesClaim}
+	if domain := strings.TrimSuffix(strings.TrimPrefix(cfg.Domain, "https://"), "/"); domain != "" {
+		conf.JWKSURL = "https://" + domain + "/.well-known/jwks.json"
+		conf.Issuer = "https://" + domain + "/"
+	}
+	return conf
+}
+
+// JWTValidator verifies bearer tokens against a JWKS endpoint. It is safe for concurrent use.
+type JWTValidator struct {
+	conf   JWTConfig
+	keys   *jwks
+	parser *jwt.Parser
+}
+
+// NewJWTValidator returns a validator for conf, or an error when conf lacks the JWKSURL, Issuer or Audience every
+// token is checked against.
+func NewJWTValidator(conf JWTConfig) (*JWTValidator, error) {
+	switch {
+	case conf.JWKSURL == "":
+		return nil, errors.New("[middleware] jwt validator needs a JWKSURL")
+	case conf.Issuer == "":
+		return nil, errors.New("[middleware] jwt validator needs an Issuer")
+	case conf.Audience == "":
+		return nil, errors.New("[middleware] jwt validator needs an Audience")
+	}
+	if len(conf.Algorithms) == 0 {
+		conf.Algorithms = []string{"RS256"}
+	}
+	if conf.RolesClaim == "" {
+		conf.RolesClaim = "roles"
+	}
+	if conf.RefreshInterval == 0 {
+		conf.RefreshInterval = time.Hour
+	}
+	if conf.MinRefreshInterval == 0 {
+		conf.MinRefreshInterval = time.Minute
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(conf.Algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(conf.Leeway),
+		jwt.WithIssuer(conf.Issuer),
+		jwt.WithAudience(conf.Audience),
+	}
+
+	return &JWTValidator{
+		conf:   conf,
+		keys:   newJWKS(conf.JWKSURL, conf.HTTPClient, conf.RefreshInterval, conf.MinRefreshInterval),
+		parser: jwt.NewParser(parserOpts...),
+	}, nil
+}
+
+// Validate verifies the signature and registered claims of token and returns its claims.
+func (v *JWTValidator) Validate(ctx context.Context, token string) (*foundation.Claims, error) {
+	mapClaims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, mapClaims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.claims(mapClaims)
+}
+
+func (v *JWTValidator) claims(mapClaims jwt.MapClaims) (*foundation.Claims, error) {
+	claims := &foundation.Claims{Raw: mapClaims}
+	claims.Subject, _ = mapClaims.GetSubject()
+	claims.Issuer, _ = mapClaims.GetIssuer()
+	claims.Audience, _ = mapClaims.GetAudience()
+	if exp, _ := mapClaims.GetExpirationTime(); exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	if scope, ok := mapClaims["scope"].(string); ok {
+		claims.Scopes = strings.Fields(scope)
+	}
+	var err error
+	if claims.Permissions, err = stringSliceClaim(mapClaims, "permissions"); err != nil {
+		return nil, err
+	}
+	if claims.Roles, err = stringSliceClaim(mapClaims, v.conf.RolesClaim); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func stringSliceClaim(mapClaims jwt.MapClaims, name string) ([]string, error) {
+	switch value := mapClaims[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %q must only contain strings", name)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("claim %q must be a string or an array of strings", name)
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header value.
+func BearerToken(authHeader string) (string, error) {
+	if authHeader == "" {
+		return "", errors.New("no bearer token in request header")
+	}
+	scheme, token, found := strings.Cut(authHeader, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", errors.New("not a bearer token")
+	}
+	return token, nil
+}
+
+// JWT returns a middleware that rejects requests without a valid bearer token and stores the token's claims in the
+// context for foundation.ClaimsFrom.
+func JWT(validator *JWTValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := foundation.LoggerFrom(c)
+
+		token, err := BearerToken(c.GetHeader("Authorization"))
+		if err != nil {
+			logger.Warn(err.Error())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "unauthorized"})
+			return
+		}
+
+		claims, err := validator.Validate(c.Request.Context(), token)
+		if err != nil {
+			logger.Warn("bearer token not valid", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "unauthorized"})
+			return
+		}
+
+		c.Set(foundation.ClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// RequireScope returns a middleware that only allows requests whose token was granted every one of scopes. It must
+// run after JWT.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return requireClaims("scope", func(claims *foundation.Claims) bool {
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireRole returns a middleware that only allows requests whose token carries at least one of roles. It must
+// run after JWT.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return requireClaims("role", func(claims *foundation.Claims) bool {
+		for _, role := range roles {
+			if claims.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func requireClaims(kind string, allowed func(claims *foundation.Claims) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := foundation.ClaimsFrom(c)
+		if !ok {
+			foundation.LoggerFrom(c).Warn("no claims in context, is the JWT middleware installed?")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "unauthorized"})
+			return
+		}
+		if !allowed(claims) {
+			foundation.LoggerFrom(c).Warn("token missing required "+kind, zap.String("subject", claims.Subject))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,279 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testJWKS struct {
+	mu   sync.Mutex
+	keys map[string]*rsa.PrivateKey
+}
+
+func newTestJWKS(t *testing.T, kids ...string) (*testJWKS, *httptest.Server) {
+	j := &testJWKS{keys: map[string]*rsa.PrivateKey{}}
+	for _, kid := range kids {
+		j.rotate(t, kid)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		keys := []map[string]string{}
+		for kid, key := range j.keys {
+			keys = append(keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	t.Cleanup(server.Close)
+	return j, server
+}
+
+func (j *testJWKS) rotate(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys[kid] = key
+}
+
+func (j *testJWKS) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	j.mu.Lock()
+	key := j.keys[kid]
+	j.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "auth0|123",
+		"iss":   "https://optech.test/",
+		"aud":   []string{"https://api.optech.test"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"scope": "read:orders write:orders",
+		"roles": []string{"admin"},
+	}
+}
+
+func Test_JWT(t *testing.T) {
+	t.Parallel()
+
+	keys, server := newTestJWKS(t, "key-1")
+	validator, err := middleware.NewJWTValidator(middleware.JWTConfig{
+		JWKSURL:            server.URL,
+		Issuer:             "https://optech.test/",
+		Audience:           "https://api.optech.test",
+		MinRefreshInterval: time.Nanosecond,
+	})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(middleware.JWT(validator))
+	router.GET("/", func(c *gin.Context) {
+		claims, ok := foundation.ClaimsFrom(c)
+		require.True(t, ok)
+		c.String(http.StatusOK, claims.Subject)
+	})
+
+	withClaim := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+
+	tests := []struct {
+		name       string
+		givenToken func() string
+		wantCode   int
+	}{
+		{name: "no token", givenToken: func() string { return "" }, wantCode: http.StatusUnauthorized},
+		{name: "not a jwt", givenToken: func() string { return "Bearer token" }, wantCode: http.StatusUnauthorized},
+		{
+			name: "expired",
+			givenToken: func() string {
+				return "Bearer " + keys.sign(t, "key-1", withClaim("exp", time.Now().Add(-time.Minute).Unix()))
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "not yet valid",
+			givenToken: func() string {
+				return "Bearer " + keys.sign(t, "key-1", withClaim("nbf", time.Now().Add(time.Hour).Unix()))
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong issuer",
+			givenToken: func() string { return "Bearer " + keys.sign(t, "key-1", withClaim("iss", "https://evil.test/")) },
+			wantCode:   http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong audience",
+			givenToken: func() string { return "Bearer " + keys.sign(t, "key-1", withClaim("aud", "https://other.test")) },
+			wantCode:   http.StatusUnauthorized,
+		},
+		{
+			name:       "happy path",
+			givenToken: func() string { return "Bearer " + keys.sign(t, "key-1", validClaims()) },
+			wantCode:   http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if token := tc.givenToken(); token != "" {
+				req.Header.Add("Authorization", token)
+			}
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tc.wantCode, rr.Code)
+		})
+	}
+}
+
+func Test_JWTKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	keys, server := newTestJWKS(t, "key-1")
+	validator, err := middleware.NewJWTValidator(middleware.JWTConfig{
+		JWKSURL:            server.URL,
+		Issuer:             "https://optech.test/",
+		Audience:           "https://api.optech.test",
+		MinRefreshInterval: time.Nanosecond,
+	})
+	require.NoError(t, err)
+
+	claims, err := validator.Validate(context.Background(), keys.sign(t, "key-1", validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "auth0|123", claims.Subject)
+
+	keys.rotate(t, "key-2")
+	claims, err = validator.Validate(context.Background(), keys.sign(t, "key-2", validClaims()))
+	require.NoError(t, err)
+	assert.True(t, claims.HasScope("write:orders"))
+	assert.True(t, claims.HasRole("admin"))
+}
+
+func Test_RequireScopeAndRole(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		givenClaims *foundation.Claims
+		givenGuard  gin.HandlerFunc
+		wantCode    int
+	}{
+		{name: "no claims", givenGuard: middleware.RequireScope("read:orders"), wantCode: http.StatusUnauthorized},
+		{
+			name:        "missing scope",
+			givenClaims: &foundation.Claims{Scopes: []string{"read:orders"}},
+			givenGuard:  middleware.RequireScope("read:orders", "write:orders"),
+			wantCode:    http.StatusForbidden,
+		},
+		{
+			name:        "scope from permissions",
+			givenClaims: &foundation.Claims{Permissions: []string{"read:orders"}},
+			givenGuard:  middleware.RequireScope("read:orders"),
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "missing role",
+			givenClaims: &foundation.Claims{Roles: []string{"viewer"}},
+			givenGuard:  middleware.RequireRole("admin"),
+			wantCode:    http.StatusForbidden,
+		},
+		{
+			name:        "any role",
+			givenClaims: &foundation.Claims{Roles: []string{"viewer"}},
+			givenGuard:  middleware.RequireRole("admin", "viewer"),
+			wantCode:    http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tc.givenClaims != nil {
+					c.Set(foundation.ClaimsKey, tc.givenClaims)
+				}
+			})
+			router.GET("/", tc.givenGuard, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tc.wantCode, rr.Code)
+		})
+	}
+}
+
+func Test_JWTConfigFromAuth0(t *testing.T) {
+	t.Parallel()
+
+	conf := middleware.JWTConfigFromAuth0(config.Auth0Config{
+		Domain:   "optech.us.auth0.com",
+		Audience: "https://api.optech.test",
+	})
+	assert.Equal(t, "https://optech.us.auth0.com/.well-known/jwks.json", conf.JWKSURL)
+	assert.Equal(t, "https://optech.us.auth0.com/", conf.Issuer)
+	assert.Equal(t, "https://api.optech.test", conf.Audience)
+}
+
+func Test_NewJWTValidatorRequiresChecks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		given   config.Auth0Config
+		wantErr string
+	}{
+		{name: "no domain", given: config.Auth0Config{Audience: "https://api.optech.test"}, wantErr: "[middleware] jwt validator needs a JWKSURL"},
+		{name: "no audience", given: config.Auth0Config{Domain: "optech.us.auth0.com"}, wantErr: "[middleware] jwt validator needs an Audience"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := middleware.NewJWTValidator(middleware.JWTConfigFromAuth0(tc.given))
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+
+	_, err := middleware.NewJWTValidator(middleware.JWTConfig{JWKSURL: "https://optech.test/jwks.json", Audience: "https://api.optech.test"})
+	assert.EqualError(t, err, "[middleware] jwt validator needs an Issuer")
+}
@@ -1,12 +1,14 @@
 package middleware
 
 import (
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/helpers/config"
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
-	"go.uber.org/zap"
 )
 
 // LoggerConfig defines the config for Logger middleware.
@@ -17,10 +19,61 @@ type LoggerConfig struct {
 	// SkipPaths is a url path array which logs are not written.
 	// Optional.
 	SkipPaths []string
+
+	// SkipPathSet holds more paths which logs are not written. Unlike SkipPaths, it can be replaced while serving,
+	// ex. from a config.Watcher subscriber.
+	// Optional.
+	SkipPathSet *PathSet
+
+	// GoogleProjectID names the trace of requests carrying traceparent or X-Cloud-Trace-Context, so Cloud Logging
+	// groups their logs under it.
+	// Optional.
+	GoogleProjectID string
+}
+
+// PathSet is a set of url paths that can be replaced while requests read it.
+type PathSet struct {
+	paths atomic.Pointer[map[string]struct{}]
+}
+
+func NewPathSet(paths ...string) *PathSet {
+	s := &PathSet{}
+	s.Set(paths...)
+	return s
+}
+
+// Set replaces the paths in the set.
+func (s *PathSet) Set(paths ...string) {
+	set := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		set[path] = struct{}{}
+	}
+	s.paths.Store(&set)
+}
+
+// Contains reports whether path is in the set.
+func (s *PathSet) Contains(path string) bool {
+	if s == nil {
+		return false
+	}
+	set := s.paths.Load()
+	if set == nil {
+		return false
+	}
+	_, found := (*set)[path]
+	return found
 }
 
 const RequestIDField = "X-Request-ID"
 
+// LoggerConfigFromConfig builds the LoggerConfig of a service, naming its traces after conf.GoogleProjectID.
+func LoggerConfigFromConfig(conf config.Config) LoggerConfig {
+	return LoggerConfig{
+		RequestIDField:  RequestIDField,
+		GoogleProjectID: conf.GoogleProjectID,
+	}
+}
+
 // Logger returns a middleware that that will write structured http request logs with zap
 func Logger(logger foundation.Logger) gin.HandlerFunc {
 	return LoggerWithConfig(logger, LoggerConfig{
@@ -47,7 +100,17 @@ func LoggerWithConfig(logger foundation.Logger, conf LoggerConfig) gin.HandlerFu
 		}
 		c.Header(conf.RequestIDField, reqID)
 		c.Set(foundation.RequestIDKey, reqID)
-		c.Set(foundation.LoggerKey, logger.With(zap.String("request_id", reqID)))
+		attrs := []slog.Attr{slog.String(foundation.RequestIDLogField, reqID)}
+		// the span started by foundation.HTTPTracing wins over the caller's headers, so logs join this service's span
+		if trace, ok := foundation.TraceContextFromContext(c.Request.Context()); ok {
+			attrs = append(attrs, trace.LogAttrs(conf.GoogleProjectID)...)
+		} else if trace, ok := foundation.TraceContextFromHeaders(c.Request.Header); ok {
+			attrs = append(attrs, trace.LogAttrs(conf.GoogleProjectID)...)
+		}
+		requestLogger := logger.With(attrsToArgs(attrs)...)
+		c.Set(foundation.LoggerKey, requestLogger)
+		// handlers logging with the request context get the request attributes from any logger
+		c.Request = c.Request.WithContext(foundation.ContextWithLogAttrs(c.Request.Context(), attrs...))
 
 		// Start timer
 		start := time.Now()
@@ -58,7 +121,7 @@ func LoggerWithConfig(logger foundation.Logger, conf LoggerConfig) gin.HandlerFu
 		c.Next()
 
 		// Log only when path is not being skipped
-		if _, ok := skip[path]; !ok {
+		if _, ok := skip[path]; !ok && !conf.SkipPathSet.Contains(path) {
 			// Stop timer
 			latency := time.Since(start)
 			if latency > time.Minute {
@@ -75,24 +138,45 @@ func LoggerWithConfig(logger foundation.Logger, conf LoggerConfig) gin.HandlerFu
 			}
 
 			msg := "[foundation] " + path
-			fields := []zap.Field{
-				zap.String(conf.RequestIDField, reqID),
-				zap.String("content_type", contentType),
-				zap.Int("body_bytes", c.Writer.Size()),
-				zap.Int("status_code", c.Writer.Status()),
-				zap.String("latency", latency.String()),
-				zap.String("client_ip", c.ClientIP()),
-				zap.String("method", c.Request.Method),
-				zap.String("path", path),
+			args := []any{
+				slog.String(conf.RequestIDField, reqID),
+				slog.String("content_type", contentType),
+				slog.Int("body_bytes", c.Writer.Size()),
+				slog.Int("status_code", c.Writer.Status()),
+				slog.String("latency", latency.String()),
+				slog.String("client_ip", c.ClientIP()),
+				slog.String("method", c.Request.Method),
+				slog.String("path", path),
 			}
 
+			args = append(args, foundation.HTTPRequestLog{
+				Method:       c.Request.Method,
+				URL:          c.Request.URL.String(),
+				RequestSize:  max(c.Request.ContentLength, 0),
+				Status:       c.Writer.Status(),
+				ResponseSize: int64(max(c.Writer.Size(), 0)),
+				UserAgent:    c.Request.UserAgent(),
+				RemoteIP:     c.ClientIP(),
+				Referer:      c.Request.Referer(),
+				Protocol:     c.Request.Proto,
+				Latency:      latency,
+			}.LogAttr())
+
 			if len(c.Errors) > 0 {
-				fields = append(fields,
-					zap.String("error", c.Errors.ByType(gin.ErrorTypePrivate).String()))
-				logger.Error(msg, fields...)
+				args = append(args,
+					slog.String("error", c.Errors.ByType(gin.ErrorTypePrivate).String()))
+				requestLogger.Error(msg, args...)
 			} else {
-				logger.Info(msg, fields...)
+				requestLogger.Info(msg, args...)
 			}
 		}
 	}
 }
+
+func attrsToArgs(attrs []slog.Attr) []any {
+	args := make([]any, len(attrs))
+	for i, attr := range attrs {
+		args[i] = attr
+	}
+	return args
+}
@@ -0,0 +1,77 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_LoggerSkipPathSet(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zap.InfoLevel)
+	skip := middleware.NewPathSet("/health")
+	router := gin.New()
+	router.Use(middleware.LoggerWithConfig(foundation.NewZapLogger(zap.New(core)), middleware.LoggerConfig{
+		RequestIDField: middleware.RequestIDField,
+		SkipPaths:      []string{"/ready"},
+		SkipPathSet:    skip,
+	}))
+	router.GET("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+	get := func(path string) {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	get("/health")
+	get("/ready")
+	get("/orders")
+	assert.Equal(t, 1, logs.FilterMessage("[foundation] /orders").Len())
+	assert.Equal(t, 1, logs.Len())
+
+	skip.Set("/orders")
+	get("/health")
+	get("/orders")
+	assert.Equal(t, 1, logs.FilterMessage("[foundation] /health").Len())
+	assert.Equal(t, 2, logs.Len())
+}
+
+func Test_LoggerHTTPRequestAndTrace(t *testing.T) {
+	t.Parallel()
+
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(middleware.LoggerWithConfig(foundation.NewZapLogger(zap.New(core)),
+		middleware.LoggerConfigFromConfig(config.Config{GoogleProjectID: "monorepo"})))
+	router.GET("/orders", func(c *gin.Context) {
+		foundation.LoggerFrom(c).Info("listing orders")
+		c.String(http.StatusOK, "[]")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders?page=2", nil)
+	req.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	req.Header.Set("User-Agent", "curl/8.0")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Equal(t, "projects/monorepo/traces/105445aa7843bc8bf206b12000100000", entry.ContextMap()[foundation.CloudTraceKey], entry.Message)
+	}
+	httpRequest, ok := entries[1].ContextMap()[foundation.CloudHTTPRequestKey].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "GET", httpRequest["requestMethod"])
+	assert.Equal(t, "/orders?page=2", httpRequest["requestUrl"])
+	assert.Equal(t, int64(http.StatusOK), httpRequest["status"])
+	assert.Equal(t, "2", httpRequest["responseSize"])
+	assert.Equal(t, "curl/8.0", httpRequest["userAgent"])
+	assert.Regexp(t, `^\d+\.\d{9}s$`, httpRequest["latency"])
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/ratelimit"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Headers set by RateLimit, from the IETF RateLimit header fields draft.
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RetryAfterHeader         = "Retry-After"
+)
+
+// DefaultAPIKeyHeader is the header KeyByAPIKey reads by default.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// KeyFunc returns the key a request is counted under, or false to try the next KeyFunc.
+type KeyFunc func(c *gin.Context) (string, bool)
+
+// KeyByIP counts requests per client IP, as resolved by gin's trusted proxies settings.
+func KeyByIP(c *gin.Context) (string, bool) {
+	ip := c.ClientIP()
+	return "ip:" + ip, ip != ""
+}
+
+// KeyBySubject counts requests per authenticated subject, so it must run after the JWT middleware.
+func KeyBySubject(c *gin.Context) (string, bool) {
+	claims, ok := foundation.ClaimsFrom(c)
+	if !ok || claims.Subject == "" {
+		return "", false
+	}
+	return "sub:" + claims.Subject, true
+}
+
+// APIKeyValidator reports whether apiKey was issued to a client. It is only called with keys that are not empty.
+type APIKeyValidator func(ctx context.Context, apiKey string) bool
+
+// KeyByAPIKey counts requests per API key sent in header, for the keys valid accepts. Other keys are skipped, as
+// anybody could send a new one with every request to get a fresh count, so combine it with KeyByIP, ex.
+// KeyFirst(KeyBySubject, KeyByAPIKey(DefaultAPIKeyHeader, valid), KeyByIP). The key is hashed so it is not stored in
+// clear.
+func KeyByAPIKey(header string, valid APIKeyValidator) KeyFunc {
+	return func(c *gin.Context) (string, bool) {
+		apiKey := c.GetHeader(header)
+		if apiKey == "" || !valid(c.Request.Context(), apiKey) {
+			return "", false
+		}
+		return "key:" + HashKey(apiKey), true
+	}
+}
+
+// HashKey hashes a secret used as a rate limit key.
+func HashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:16])
+}
+
+// KeyFirst returns the key of the first keyFunc that has one, ex. KeyFirst(KeyBySubject, KeyByIP).
+func KeyFirst(keyFuncs ...KeyFunc) KeyFunc {
+	return func(c *gin.Context) (string, bool) {
+		for _, keyFunc := range keyFuncs {
+			if key, ok := keyFunc(c); ok {
+				return key, true
+			}
+		}
+		return "", false
+	}
+}
+
+// RateLimitConfig defines the config for RateLimit middleware.
+type RateLimitConfig struct {
+	// Limiter counts the requests. A nil Limiter disables the middleware.
+	Limiter *ratelimit.Limiter
+
+	// KeyFunc returns the key requests are counted under. Requests without a key are not limited.
+	// Optional. Default value KeyFirst(KeyBySubject, KeyByIP).
+	KeyFunc KeyFunc
+
+	// Prefix separates the counts of limiters sharing a store, ex. one per route group.
+	// Optional.
+	Prefix string
+
+	// FailClosed rejects requests when the store fails instead of letting them through.
+	// Optional.
+	FailClosed bool
+}
+
+// RateLimit returns a middleware that limits the requests of each authenticated subject, or else of each client IP.
+func RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return RateLimitWithConfig(RateLimitConfig{Limiter: limiter})
+}
+
+// RateLimitWithConfig returns a RateLimit middleware with config. Allowed requests get the RateLimit-* headers,
+// rejected ones a 429 with Retry-After as well.
+func RateLimitWithConfig(conf RateLimitConfig) gin.HandlerFunc {
+	if conf.KeyFunc == nil {
+		conf.KeyFunc = KeyFirst(KeyBySubject, KeyByIP)
+	}
+
+	return func(c *gin.Context) {
+		if conf.Limiter == nil {
+			c.Next()
+			return
+		}
+		key, ok := conf.KeyFunc(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		result, err := conf.Limiter.Allow(c.Request.Context(), conf.Prefix+key)
+		if err != nil {
+			foundation.LoggerFrom(c).Error("rate limit store failed", zap.Error(err))
+			if conf.FailClosed {
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Unable to rate limit"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header(RateLimitLimitHeader, strconv.Itoa(result.Limit))
+		c.Header(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+		c.Header(RateLimitResetHeader, strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			foundation.LoggerFrom(c).Warn("rate limit exceeded", zap.String("rateLimitKey", key))
+			c.Header(RetryAfterHeader, strconv.Itoa(max(ceilSeconds(result.RetryAfter), 1)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, the unit of the rate limit headers.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
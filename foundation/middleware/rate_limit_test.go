@@ -0,0 +1,118 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/OptechLabs/monorepo/foundation/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	valid := func(_ context.Context, apiKey string) bool { return apiKey == "k1" || apiKey == "k2" }
+	withAPIKeys := middleware.KeyFirst(middleware.KeyBySubject, middleware.KeyByAPIKey(middleware.DefaultAPIKeyHeader, valid), middleware.KeyByIP)
+
+	tests := []struct {
+		name         string
+		givenKeyFunc middleware.KeyFunc
+		givenReqs    []func(r *http.Request)
+		wantCodes    []int
+	}{
+		{
+			name:      "per ip",
+			givenReqs: []func(r *http.Request){setIP("10.0.0.1"), setIP("10.0.0.1"), setIP("10.0.0.2")},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:      "api keys ignored by default",
+			givenReqs: []func(r *http.Request){setAPIKey("k1"), setAPIKey("k2")},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:         "valid api key before ip",
+			givenKeyFunc: withAPIKeys,
+			givenReqs:    []func(r *http.Request){setAPIKey("k1"), setAPIKey("k2"), setAPIKey("k1")},
+			wantCodes:    []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:         "unknown api keys counted by ip",
+			givenKeyFunc: withAPIKeys,
+			givenReqs:    []func(r *http.Request){setAPIKey("random-1"), setAPIKey("random-2")},
+			wantCodes:    []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:         "subject before api key",
+			givenKeyFunc: withAPIKeys,
+			givenReqs:    []func(r *http.Request){setSubject("auth0|1"), setAPIKey("k1"), setSubject("auth0|1")},
+			wantCodes:    []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			limiter, err := ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.PerMinute(1))
+			require.NoError(t, err)
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if subject := c.GetHeader("X-Test-Subject"); subject != "" {
+					c.Set(foundation.ClaimsKey, &foundation.Claims{Subject: subject})
+				}
+			})
+			router.Use(middleware.RateLimitWithConfig(middleware.RateLimitConfig{Limiter: limiter, KeyFunc: tc.givenKeyFunc}))
+			router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			for i, given := range tc.givenReqs {
+				rr := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				given(req)
+				router.ServeHTTP(rr, req)
+
+				assert.Equal(t, tc.wantCodes[i], rr.Code, "request %d", i)
+				assert.Equal(t, "1", rr.Header().Get(middleware.RateLimitLimitHeader))
+				assert.Equal(t, "0", rr.Header().Get(middleware.RateLimitRemainingHeader))
+				assert.Equal(t, "60", rr.Header().Get(middleware.RateLimitResetHeader))
+				if rr.Code == http.StatusTooManyRequests {
+					assert.Equal(t, "60", rr.Header().Get(middleware.RetryAfterHeader))
+				} else {
+					assert.Empty(t, rr.Header().Get(middleware.RetryAfterHeader))
+				}
+			}
+		})
+	}
+}
+
+func Test_RateLimitDisabled(t *testing.T) {
+	t.Parallel()
+
+	router := gin.New()
+	router.Use(middleware.RateLimit(nil))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(middleware.RateLimitLimitHeader))
+}
+
+func setIP(ip string) func(r *http.Request) {
+	return func(r *http.Request) { r.RemoteAddr = ip + ":1234" }
+}
+
+func setAPIKey(key string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set(middleware.DefaultAPIKeyHeader, key) }
+}
+
+func setSubject(subject string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("X-Test-Subject", subject) }
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/OptechLabs/monorepo/foundation"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"go.uber.org/zap"
 )
 
 func Test_Recovery(t *testing.T) {
@@ -44,7 +43,7 @@ func Test_Recovery(t *testing.T) {
 			_, r := gin.CreateTestContext(resp)
 
 			r.Use(func(c *gin.Context) {
-				c.Set(foundation.LoggerKey, zap.NewNop())
+				c.Set(foundation.LoggerKey, foundation.NewNopLogger())
 				c.Next()
 				assert.Equal(t, tc.wantErrCount, len(c.Errors))
 				assert.Equal(t, tc.wantRespCode, c.Writer.Status())
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/gin-gonic/gin"
+	"github.com/unrolled/secure"
+	"go.uber.org/zap"
+)
+
+// CSPNonceKey is the gin context key holding the request's Content-Security-Policy nonce, see CSPNonceFrom.
+const CSPNonceKey = "cspNonce"
+
+// NoncePlaceholder is replaced by 'nonce-<nonce>' in SecurityPolicy.ContentSecurityPolicy, ex.
+// "script-src 'self' $NONCE".
+const NoncePlaceholder = "$NONCE"
+
+// SecurityPolicy defines the security headers, host checks and CORS rules of Security middleware.
+type SecurityPolicy struct {
+	// SSLRedirect redirects http requests to https.
+	// Optional.
+	SSLRedirect bool
+
+	// SSLProxyHeaders are headers with the values a TLS terminating proxy sets on https requests.
+	// Optional. Default value {"X-Forwarded-Proto": "https"}.
+	SSLProxyHeaders map[string]string
+
+	// HSTSMaxAge sets Strict-Transport-Security on https requests, zero leaves it out.
+	// Optional.
+	HSTSMaxAge time.Duration
+
+	// HSTSIncludeSubdomains and HSTSPreload add the includeSubDomains and preload directives.
+	// Optional.
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// ContentSecurityPolicy is sent as Content-Security-Policy. Each NoncePlaceholder is replaced by a nonce
+	// generated per request, for templates to read with CSPNonceFrom.
+	// Optional.
+	ContentSecurityPolicy string
+
+	// FrameOptions is sent as X-Frame-Options, ex. "DENY" or "SAMEORIGIN".
+	// Optional.
+	FrameOptions string
+
+	// ContentTypeNosniff sends X-Content-Type-Options: nosniff.
+	// Optional.
+	ContentTypeNosniff bool
+
+	// ReferrerPolicy is sent as Referrer-Policy, ex. "strict-origin-when-cross-origin".
+	// Optional.
+	ReferrerPolicy string
+
+	// PermissionsPolicy is sent as Permissions-Policy, ex. "camera=(), microphone=()".
+	// Optional.
+	PermissionsPolicy string
+
+	// AllowedHosts rejects requests for other hosts with a 400 Bad Host. Entries are host names, or regular
+	// expressions with AllowedHostsAreRegex.
+	// Optional. Default value any host.
+	AllowedHosts         []string
+	AllowedHostsAreRegex bool
+
+	// HostsProxyHeaders are headers holding the original host of proxied requests, ex. "X-Forwarded-Host".
+	// Optional.
+	HostsProxyHeaders []string
+
+	// CORS allows cross-origin requests, rejected by browsers without it.
+	// Optional.
+	CORS *CORSConfig
+}
+
+// SecurityPolicies maps foundation environments to their SecurityPolicy.
+type SecurityPolicies map[string]SecurityPolicy
+
+// For returns the policy of environment, falling back to the production one.
+func (p SecurityPolicies) For(environment string) SecurityPolicy {
+	if policy, ok := p[environment]; ok {
+		return policy
+	}
+	return p[foundation.Production]
+}
+
+// DefaultContentSecurityPolicy only allows same origin resources and nonced scripts.
+const DefaultContentSecurityPolicy = "default-src 'self'; script-src 'self' " + NoncePlaceholder +
+	"; object-src 'none'; base-uri 'self'; frame-ancestors 'none'"
+
+// DefaultSecurityPolicies returns the policies for each foundation environment. Every environment sends
+// DefaultContentSecurityPolicy, denies framing and sniffing, and allows CORS from https://rootDomain and its
+// subdomains. Development and test also allow http://localhost on any port; the deployed environments redirect to
+// https and send HSTS, for a day outside production and two years, with subdomains, in production.
+func DefaultSecurityPolicies(rootDomain string) SecurityPolicies {
+	base := SecurityPolicy{
+		ContentSecurityPolicy: DefaultContentSecurityPolicy,
+		FrameOptions:          "DENY",
+		ContentTypeNosniff:    true,
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+	}
+	cors := func(origins ...string) *CORSConfig {
+		return &CORSConfig{
+			AllowOrigins:     append([]string{"https://" + rootDomain, "https://*." + rootDomain}, origins...),
+			AllowCredentials: true,
+			MaxAge:           time.Hour,
+		}
+	}
+
+	local := base
+	local.CORS = cors("http://localhost", "http://localhost:*")
+
+	deployed := base
+	deployed.SSLRedirect = true
+	deployed.HSTSMaxAge = 24 * time.Hour
+	deployed.CORS = cors()
+
+	production := deployed
+	production.HSTSMaxAge = 2 * 365 * 24 * time.Hour
+	production.HSTSIncludeSubdomains = true
+
+	return SecurityPolicies{
+		foundation.Development: local,
+		foundation.Test:        local,
+		foundation.Staging:     deployed,
+		foundation.Sandbox:     deployed,
+		foundation.Integration: deployed,
+		foundation.Production:  production,
+	}
+}
+
+// Security returns a middleware applying the policy of environment.
+func Security(environment string, policies SecurityPolicies) gin.HandlerFunc {
+	return SecurityWithPolicy(policies.For(environment))
+}
+
+// SecurityWithPolicy returns a middleware applying policy, ex. a looser one on a route group serving embeddable
+// widgets. The policy is compiled once, invalid host expressions and CORS origins panic.
+//
+// A route group only sees CORS preflight requests for its OPTIONS routes, so either use the middleware on the
+// router or give the group a catch-all: group.OPTIONS("/*path", func(*gin.Context) {}).
+func SecurityWithPolicy(policy SecurityPolicy) gin.HandlerFunc {
+	sec := newSecure(policy)
+	var cors *corsPolicy
+	if policy.CORS != nil {
+		cors = newCORSPolicy(*policy.CORS)
+	}
+
+	return func(c *gin.Context) {
+		// preflight requests are answered before the host and https checks, which do not apply to them
+		if cors != nil && cors.handle(c) {
+			return
+		}
+
+		nonce, err := sec.ProcessAndReturnNonce(c.Writer, c.Request)
+		if err != nil {
+			foundation.LoggerFrom(c).Debug("security policy stopped request", zap.Error(err))
+			c.Abort()
+			return
+		}
+		if status := c.Writer.Status(); status > 300 && status < 399 {
+			// avoid header rewrite if response is a redirection.
+			c.Abort()
+			return
+		}
+		if nonce != "" {
+			c.Set(CSPNonceKey, nonce)
+			c.Request = c.Request.WithContext(secure.WithCSPNonce(c.Request.Context(), nonce))
+		}
+		c.Next()
+	}
+}
+
+// CSPNonceFrom returns the request's Content-Security-Policy nonce, for inline scripts:
+// <script nonce="{{ .nonce }}">.
+func CSPNonceFrom(c *gin.Context) string {
+	return c.GetString(CSPNonceKey)
+}
+
+func newSecure(policy SecurityPolicy) *secure.Secure {
+	if policy.SSLProxyHeaders == nil {
+		policy.SSLProxyHeaders = map[string]string{"X-Forwarded-Proto": "https"}
+	}
+	sec := secure.New(secure.Options{
+		SSLRedirect:             policy.SSLRedirect,
+		SSLProxyHeaders:         policy.SSLProxyHeaders,
+		STSSeconds:              int64(policy.HSTSMaxAge.Seconds()),
+		STSIncludeSubdomains:    policy.HSTSIncludeSubdomains,
+		STSPreload:              policy.HSTSPreload,
+		ContentSecurityPolicy:   policy.ContentSecurityPolicy,
+		CustomFrameOptionsValue: policy.FrameOptions,
+		ContentTypeNosniff:      policy.ContentTypeNosniff,
+		ReferrerPolicy:          policy.ReferrerPolicy,
+		PermissionsPolicy:       policy.PermissionsPolicy,
+		AllowedHosts:            policy.AllowedHosts,
+		AllowedHostsAreRegex:    policy.AllowedHostsAreRegex,
+		HostsProxyHeaders:       policy.HostsProxyHeaders,
+	})
+	// secure answers a 500 by default, the request is at fault
+	sec.SetBadHostHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Bad Host", http.StatusBadRequest)
+	}))
+	return sec
+}
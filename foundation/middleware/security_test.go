@@ -0,0 +1,248 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Security(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		givenEnv    string
+		givenHeader map[string]string
+		wantCode    int
+		wantHeader  map[string]string
+	}{
+		{
+			name:     "development headers",
+			givenEnv: foundation.Development,
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"X-Frame-Options":           "DENY",
+				"X-Content-Type-Options":    "nosniff",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name:       "production redirects http",
+			givenEnv:   foundation.Production,
+			wantCode:   http.StatusMovedPermanently,
+			wantHeader: map[string]string{"Location": "https://optech.com/"},
+		},
+		{
+			name:        "production hsts",
+			givenEnv:    foundation.Production,
+			givenHeader: map[string]string{"X-Forwarded-Proto": "https"},
+			wantCode:    http.StatusOK,
+			wantHeader:  map[string]string{"Strict-Transport-Security": "max-age=63072000; includeSubDomains"},
+		},
+		{
+			name:        "staging hsts",
+			givenEnv:    foundation.Staging,
+			givenHeader: map[string]string{"X-Forwarded-Proto": "https"},
+			wantCode:    http.StatusOK,
+			wantHeader:  map[string]string{"Strict-Transport-Security": "max-age=86400"},
+		},
+		{
+			name:        "unknown environment uses production",
+			givenEnv:    "qa",
+			givenHeader: map[string]string{"X-Forwarded-Proto": "https"},
+			wantCode:    http.StatusOK,
+			wantHeader:  map[string]string{"Strict-Transport-Security": "max-age=63072000; includeSubDomains"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.New()
+			router.Use(middleware.Security(tc.givenEnv, middleware.DefaultSecurityPolicies("optech.com")))
+			router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, middleware.CSPNonceFrom(c)) })
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "http://optech.com/", nil)
+			for key, value := range tc.givenHeader {
+				req.Header.Set(key, value)
+			}
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			for key, value := range tc.wantHeader {
+				assert.Equal(t, value, rr.Header().Get(key), key)
+			}
+			if rr.Code == http.StatusOK {
+				nonce := rr.Body.String()
+				require.NotEmpty(t, nonce)
+				assert.Contains(t, rr.Header().Get("Content-Security-Policy"), "script-src 'self' 'nonce-"+nonce+"'")
+			}
+		})
+	}
+}
+
+func Test_SecurityAllowedHosts(t *testing.T) {
+	t.Parallel()
+
+	router := gin.New()
+	router.Use(middleware.SecurityWithPolicy(middleware.SecurityPolicy{
+		AllowedHosts:         []string{`^(.+\.)?optech\.com$`},
+		AllowedHostsAreRegex: true,
+	}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for host, wantCode := range map[string]int{
+		"optech.com":      http.StatusOK,
+		"acme.optech.com": http.StatusOK,
+		"optech.com.evil": http.StatusBadRequest,
+	} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+		assert.Equal(t, wantCode, rr.Code, host)
+	}
+}
+
+func Test_CORS(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		givenMethod string
+		givenHeader map[string]string
+		wantCode    int
+		wantHeader  map[string]string
+	}{
+		{
+			name:        "same origin",
+			givenMethod: http.MethodGet,
+			wantCode:    http.StatusOK,
+			wantHeader:  map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+		{
+			name:        "allowed origin",
+			givenMethod: http.MethodGet,
+			givenHeader: map[string]string{"Origin": "https://acme.optech.com"},
+			wantCode:    http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://acme.optech.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After",
+			},
+		},
+		{
+			name:        "disallowed origin",
+			givenMethod: http.MethodGet,
+			givenHeader: map[string]string{"Origin": "https://optech.com.evil"},
+			wantCode:    http.StatusOK,
+			wantHeader:  map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "preflight",
+			givenMethod: http.MethodOptions,
+			givenHeader: map[string]string{
+				"Origin":                         "https://optech.com",
+				"Access-Control-Request-Method":  http.MethodPatch,
+				"Access-Control-Request-Headers": "authorization, content-type",
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":  "https://optech.com",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers": "Authorization, Content-Type, X-Request-ID, X-API-Key",
+				"Access-Control-Max-Age":       "3600",
+			},
+		},
+		{
+			name:        "preflight from disallowed origin",
+			givenMethod: http.MethodOptions,
+			givenHeader: map[string]string{"Origin": "https://evil.com", "Access-Control-Request-Method": http.MethodGet},
+			wantCode:    http.StatusForbidden,
+			wantHeader:  map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "preflight with disallowed method",
+			givenMethod: http.MethodOptions,
+			givenHeader: map[string]string{"Origin": "https://optech.com", "Access-Control-Request-Method": "PROPFIND"},
+			wantCode:    http.StatusForbidden,
+		},
+		{
+			name:        "preflight with disallowed header",
+			givenMethod: http.MethodOptions,
+			givenHeader: map[string]string{
+				"Origin":                         "https://optech.com",
+				"Access-Control-Request-Method":  http.MethodGet,
+				"Access-Control-Request-Headers": "x-internal",
+			},
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			router := gin.New()
+			router.Use(middleware.Security(foundation.Production, middleware.DefaultSecurityPolicies("optech.com")))
+			router.GET("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.givenMethod, "https://optech.com/orders", nil)
+			for key, value := range tc.givenHeader {
+				req.Header.Set(key, value)
+			}
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			for key, value := range tc.wantHeader {
+				assert.Equal(t, value, rr.Header().Get(key), key)
+			}
+		})
+	}
+}
+
+func Test_SecurityRouteGroups(t *testing.T) {
+	t.Parallel()
+
+	router := gin.New()
+	router.Use(middleware.Security(foundation.Production, middleware.DefaultSecurityPolicies("optech.com")))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	widgets := gin.New()
+	group := widgets.Group("/widgets", middleware.SecurityWithPolicy(middleware.SecurityPolicy{
+		ContentSecurityPolicy: "frame-ancestors *",
+		CORS:                  &middleware.CORSConfig{AllowOrigins: []string{"*"}},
+	}))
+	group.GET("/chart", func(c *gin.Context) { c.Status(http.StatusOK) })
+	group.OPTIONS("/*path", func(*gin.Context) {})
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "https://optech.com/widgets/chart", nil)
+	req.Header.Set("Origin", "https://partner.com")
+	widgets.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rr.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "frame-ancestors *", rr.Header().Get("Content-Security-Policy"))
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodOptions, "https://optech.com/widgets/chart", nil)
+	req.Header.Set("Origin", "https://partner.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	widgets.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "https://optech.com/", nil))
+	assert.True(t, strings.HasPrefix(rr.Header().Get("Content-Security-Policy"), "default-src 'self'"))
+}
@@ -8,6 +8,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// ParseSubdomain stores the first label of three part hosts under "subdomain".
+//
+// Deprecated: use Tenant, which strips the configured root domain, handles ports and looks the tenant up.
 func ParseSubdomain(environment string, localSubdomainDefault string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		subdomain, err := getSubdomain(c.Request.Host)
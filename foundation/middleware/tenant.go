@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/tenancy"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// TenantConfig defines the config for Tenant middleware.
+type TenantConfig struct {
+	// Registry looks the tenants up. A nil Registry disables the middleware.
+	Registry tenancy.Registry
+
+	// RootDomain is stripped from the host to get the tenant's subdomain, ex. config.Config.RootDomain.
+	RootDomain string
+
+	// DefaultSubdomain is used for hosts without a subdomain, ex. localhost in development.
+	// Optional.
+	DefaultSubdomain string
+
+	// HostHeaders are headers holding the original host of proxied requests, ex. "X-Forwarded-Host".
+	// Optional.
+	HostHeaders []string
+
+	// SkipPaths are url paths served without a tenant, ex. a page to pick one.
+	// Optional.
+	SkipPaths []string
+
+	// Optional lets requests without a known tenant through, handlers then check foundation.TenantFrom.
+	// Optional.
+	Optional bool
+
+	// UnknownTenant responds to requests without a known tenant.
+	// Optional. Default value a 404 {"message": "Unknown tenant"}.
+	UnknownTenant gin.HandlerFunc
+}
+
+// Tenant returns a middleware that resolves the tenant of each request from its subdomain of rootDomain, for
+// handlers to read with foundation.TenantFrom. It is forwarded to the gRPC services the request calls.
+func Tenant(rootDomain string, registry tenancy.Registry) gin.HandlerFunc {
+	return TenantWithConfig(TenantConfig{Registry: registry, RootDomain: rootDomain})
+}
+
+// TenantWithConfig returns a Tenant middleware with config.
+func TenantWithConfig(conf TenantConfig) gin.HandlerFunc {
+	if conf.UnknownTenant == nil {
+		conf.UnknownTenant = func(c *gin.Context) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "Unknown tenant"})
+		}
+	}
+	skip := make(map[string]struct{}, len(conf.SkipPaths))
+	for _, path := range conf.SkipPaths {
+		skip[path] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		if conf.Registry == nil {
+			c.Next()
+			return
+		}
+		if _, ok := skip[c.Request.URL.Path]; ok {
+			c.Next()
+			return
+		}
+
+		subdomain, ok := tenancy.Subdomain(requestHost(c, conf.HostHeaders), conf.RootDomain)
+		if !ok {
+			subdomain = conf.DefaultSubdomain
+		}
+		var tenant *foundation.Tenant
+		err := tenancy.ErrUnknownTenant
+		if subdomain != "" {
+			tenant, err = conf.Registry.BySubdomain(c.Request.Context(), subdomain)
+		}
+		if err != nil {
+			if !errors.Is(err, tenancy.ErrUnknownTenant) {
+				foundation.LoggerFrom(c).Error("tenant registry failed", zap.Error(err), zap.String("subdomain", subdomain))
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Unable to resolve tenant"})
+				return
+			}
+			if conf.Optional {
+				c.Next()
+				return
+			}
+			foundation.LoggerFrom(c).Info("unknown tenant", zap.String("subdomain", subdomain))
+			conf.UnknownTenant(c)
+			c.Abort()
+			return
+		}
+
+		c.Set(foundation.TenantKey, tenant)
+		c.Request = c.Request.WithContext(foundation.ContextWithTenant(c.Request.Context(), tenant))
+		c.Next()
+	}
+}
+
+func requestHost(c *gin.Context, headers []string) string {
+	for _, header := range headers {
+		if host := c.GetHeader(header); host != "" {
+			// X-Forwarded-Host lists every proxy's host, the first is the client's
+			host, _, _ = strings.Cut(host, ",")
+			return strings.TrimSpace(host)
+		}
+	}
+	return c.Request.Host
+}
@@ -0,0 +1,94 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/OptechLabs/monorepo/foundation/tenancy"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingRegistry struct{ tenancy.Registry }
+
+func (failingRegistry) BySubdomain(context.Context, string) (*foundation.Tenant, error) {
+	return nil, errors.New("connection reset")
+}
+
+func Test_Tenant(t *testing.T) {
+	t.Parallel()
+
+	registry := tenancy.NewStaticRegistry(
+		foundation.Tenant{ID: "t-1", Subdomain: "wu"},
+		foundation.Tenant{ID: "t-2", Subdomain: "demo"},
+	)
+
+	tests := []struct {
+		name       string
+		givenConf  middleware.TenantConfig
+		givenHost  string
+		givenPath  string
+		wantCode   int
+		wantTenant string
+	}{
+		{name: "subdomain", givenHost: "wu.otosapp.co.uk:8080", wantCode: http.StatusOK, wantTenant: "t-1"},
+		{name: "unknown tenant", givenHost: "gza.otosapp.co.uk", wantCode: http.StatusNotFound},
+		{name: "no subdomain", givenHost: "otosapp.co.uk", wantCode: http.StatusNotFound},
+		{name: "default subdomain", givenConf: middleware.TenantConfig{DefaultSubdomain: "demo"}, givenHost: "localhost:8080", wantCode: http.StatusOK, wantTenant: "t-2"},
+		{name: "skipped path", givenConf: middleware.TenantConfig{SkipPaths: []string{"/select_subdomain"}}, givenHost: "otosapp.co.uk", givenPath: "/select_subdomain", wantCode: http.StatusOK},
+		{name: "optional", givenConf: middleware.TenantConfig{Optional: true}, givenHost: "gza.otosapp.co.uk", wantCode: http.StatusOK},
+		{
+			name: "custom unknown tenant response",
+			givenConf: middleware.TenantConfig{UnknownTenant: func(c *gin.Context) {
+				c.Redirect(http.StatusFound, "https://otosapp.co.uk/select_subdomain")
+			}},
+			givenHost: "gza.otosapp.co.uk",
+			wantCode:  http.StatusFound,
+		},
+		{name: "registry failure", givenConf: middleware.TenantConfig{Registry: failingRegistry{}}, givenHost: "wu.otosapp.co.uk", wantCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			conf := tc.givenConf
+			conf.RootDomain = "otosapp.co.uk"
+			if conf.Registry == nil {
+				conf.Registry = registry
+			}
+			path := tc.givenPath
+			if path == "" {
+				path = "/"
+			}
+			router := gin.New()
+			router.Use(middleware.TenantWithConfig(conf))
+			router.GET(path, func(c *gin.Context) {
+				tenant, ok := foundation.TenantFrom(c)
+				fromContext, _ := foundation.TenantFromContext(c.Request.Context())
+				assert.Equal(t, tenant, fromContext)
+				if ok {
+					c.String(http.StatusOK, tenant.ID)
+					return
+				}
+				c.Status(http.StatusOK)
+			})
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Host = tc.givenHost
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.wantCode, rr.Code)
+			if tc.wantCode == http.StatusOK {
+				assert.Equal(t, tc.wantTenant, rr.Body.String())
+			}
+		})
+	}
+}
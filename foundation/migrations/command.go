@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/golang-migrate/migrate/v4"
+)
+
+const commandUsage = `usage: migrate [-db name] <command>
+
+commands:
+  up          apply every pending migration
+  down        revert every applied migration
+  steps N     apply N migrations, or revert them when N is negative
+  force V     set the version to V without running migrations
+  version     print the current version
+`
+
+// Command implements the migrate subcommand of a service binary, ex. "core migrate -db main up". Without -db the
+// command runs against every database with a MigrationsURL, in name order.
+func Command(ctx context.Context, args []string, configs map[string]config.DBConfig, logger foundation.Logger, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() { fmt.Fprint(out, commandUsage) }
+	database := flags.String("db", "", "DBConfigs entry to migrate, all of them when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("[migrations] missing command")
+	}
+
+	var names []string
+	for name, conf := range configs {
+		if (*database == "" && conf.MigrationsURL != "") || name == *database {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("[migrations] no database to migrate, check DBConfigs and -db %q", *database)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		migrator := New(FromConfig(name, configs[name]), logger)
+		err := runCommand(ctx, migrator, flags.Args(), out)
+		if closeErr := migrator.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCommand(ctx context.Context, migrator *Migrator, args []string, out io.Writer) error {
+	argument := func() (int, error) {
+		if len(args) != 2 {
+			return 0, fmt.Errorf("[migrations] %s takes exactly one argument", args[0])
+		}
+		return strconv.Atoi(args[1])
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		return migrator.Down(ctx)
+	case "steps":
+		n, err := argument()
+		if err != nil {
+			return err
+		}
+		return migrator.Steps(ctx, n)
+	case "force":
+		version, err := argument()
+		if err != nil {
+			return err
+		}
+		return migrator.Force(ctx, version)
+	case "version":
+		version, dirty, err := migrator.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			fmt.Fprintf(out, "%s: no migrations applied\n", migrator.conf.Name)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s: version %d, dirty %t\n", migrator.conf.Name, version, dirty)
+		return nil
+	}
+	return fmt.Errorf("[migrations] unknown command %q", args[0])
+}
@@ -0,0 +1,121 @@
+package migrations_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/migrations"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var migrationFiles = fstest.MapFS{
+	"sql/1_create_orders.up.sql":      {Data: []byte("CREATE TABLE orders (id uuid PRIMARY KEY);")},
+	"sql/1_create_orders.down.sql":    {Data: []byte("DROP TABLE orders;")},
+	"sql/2_add_orders_total.up.sql":   {Data: []byte("ALTER TABLE orders ADD COLUMN total bigint;")},
+	"sql/2_add_orders_total.down.sql": {Data: []byte("ALTER TABLE orders DROP COLUMN total;")},
+}
+
+func Test_Migrator(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	migrator := migrations.New(migrations.Config{
+		Name:        "main",
+		DatabaseURL: "stub://",
+		FS:          migrationFiles,
+		Path:        "sql",
+	}, foundation.NewNopLogger())
+	defer migrator.Close()
+	assert.Equal(t, "migrations:main", migrator.Name())
+
+	_, _, err := migrator.Version()
+	assert.ErrorIs(t, err, migrate.ErrNilVersion)
+
+	require.NoError(t, migrator.Start(ctx))
+	version, dirty, err := migrator.Version()
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), version)
+	assert.False(t, dirty)
+
+	// nothing left to apply is not an error
+	require.NoError(t, migrator.Up(ctx))
+
+	require.NoError(t, migrator.Steps(ctx, -1))
+	version, _, err = migrator.Version()
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), version)
+
+	require.NoError(t, migrator.Force(ctx, 2))
+	version, _, err = migrator.Version()
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), version)
+
+	require.NoError(t, migrator.Down(ctx))
+	_, _, err = migrator.Version()
+	assert.ErrorIs(t, err, migrate.ErrNilVersion)
+}
+
+func Test_MigratorStartFailureIsPermanent(t *testing.T) {
+	t.Parallel()
+
+	migrator := migrations.New(migrations.Config{
+		Name:        "main",
+		DatabaseURL: "stub://",
+		FS:          migrationFiles,
+		Path:        "missing",
+	}, foundation.NewNopLogger())
+	defer migrator.Close()
+
+	var permanent *foundation.PermanentError
+	assert.ErrorAs(t, migrator.Start(context.Background()), &permanent)
+}
+
+func Test_Command(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1_create_orders.up.sql"), migrationFiles["sql/1_create_orders.up.sql"].Data, 0o600))
+	configs := map[string]config.DBConfig{
+		"main":     {ConnectionURL: "stub://", MigrationsURL: "file://" + dir},
+		"readOnly": {ConnectionURL: "stub://"},
+	}
+
+	tests := []struct {
+		name      string
+		givenArgs []string
+		wantOut   string
+		wantErr   string
+	}{
+		{name: "version", givenArgs: []string{"version"}, wantOut: "main: no migrations applied\n"},
+		{name: "up", givenArgs: []string{"-db", "main", "up"}},
+		{name: "missing command", givenArgs: []string{}, wantErr: "missing command"},
+		{name: "unknown command", givenArgs: []string{"sideways"}, wantErr: `unknown command "sideways"`},
+		{name: "force without version", givenArgs: []string{"force"}, wantErr: "force takes exactly one argument"},
+		{name: "unknown database", givenArgs: []string{"-db", "reports", "up"}, wantErr: "no database to migrate"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			err := migrations.Command(context.Background(), tc.givenArgs, configs, foundation.NewNopLogger(), &out)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOut, out.String())
+		})
+	}
+}
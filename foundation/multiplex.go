@@ -0,0 +1,57 @@
+package foundation
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/soheilhy/cmux"
+	"go.uber.org/zap"
+)
+
+// multiplexed reports whether HTTPServer and GRPCServer share a single listener.
+func (f *Foundation) multiplexed() bool {
+	return f.startopOpts.Multiplex && f.HTTPServer != nil && f.GRPCServer != nil
+}
+
+// serveMultiplexed listens once on the HTTP address and routes connections by protocol: HTTP/2 requests with an
+// application/grpc content type go to GRPCServer, everything else, HTTP/1.1 and h2c, goes to HTTPServer. The
+// returned mux must be closed after both servers have been shut down.
+func (f *Foundation) serveMultiplexed(stop context.CancelFunc) (cmux.CMux, error) {
+	addr := f.HTTPServer.Addr
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := cmux.New(listener)
+	grpcListener := mux.MatchWithWriters(cmux.HTTP2MatchHeaderFieldPrefixSendSettings("content-type", "application/grpc"))
+	httpListener := mux.Match(cmux.Any())
+
+	go func() {
+		f.Logger.Info("grpc server starting", zap.String("tcpAddress", addr), zap.Bool("multiplexed", true))
+		if err := f.GRPCServer.Serve(grpcListener); err != nil && !isClosedListener(err) {
+			f.Logger.Error("grpc server failed", zap.Error(err), zap.String("tcpAddress", addr))
+			stop()
+		}
+	}()
+	go func() {
+		f.Logger.Info("http server starting", zap.String("tcpAddress", addr), zap.Bool("multiplexed", true))
+		if err := f.HTTPServer.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) && !isClosedListener(err) {
+			f.Logger.Error("http server failed", zap.Error(err), zap.String("tcpAddress", addr))
+			stop()
+		}
+	}()
+	go func() {
+		if err := mux.Serve(); err != nil && !isClosedListener(err) {
+			f.Logger.Error("multiplexed listener failed", zap.Error(err), zap.String("tcpAddress", addr))
+			stop()
+		}
+	}()
+	return mux, nil
+}
+
+func isClosedListener(err error) bool {
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, cmux.ErrListenerClosed) || errors.Is(err, cmux.ErrServerClosed)
+}
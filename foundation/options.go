@@ -4,23 +4,75 @@ import (
 	"strings"
 	"time"
 
+	"github.com/OptechLabs/monorepo/helpers/config"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 )
 
 type Options struct {
-	Environment                 string                      `long:"environment" description:"environment to run in" default:"development"`
-	HTTPPort                    string                      `long:"proxy-port" description:"port which http server listens on" default:"8080"`
-	StartHTTPServer             bool                        `long:"start-http-server" description:"run the http server" default:"false"`
-	GRPCPort                    string                      `long:"proxy-port" description:"port which grpc server listens on" default:"8081"`
-	GRPCUnaryInterceptor        grpc.UnaryServerInterceptor `long:"-" description:"grpc unary interceptors"`
-	StartGRPCServer             bool                        `long:"start-grpc-server" description:"run the grpc server" default:"false"`
-	Logger                      Logger                      `long:"-" description:"logger"`
-	WriteTimeout                time.Duration               `long:"write-timeout" description:"http server write timeout" default:"15s"`
-	ReadTimeout                 time.Duration               `long:"read-timeout" description:"http server read timeout" default:"15s"`
-	IdleTimeout                 time.Duration               `long:"idle-timeout" description:"http server idle timeout" default:"60s"`
-	ShutdownWait                time.Duration               `long:"shutdown-wait" description:"time to wait for server to shutdown" default:"30s"`
-	StopOnProcessorStartFailure bool                        `long:"stop-on-processor-start-failure" description:"stop the server if a processor fails to start"`
+	Environment                 string                         `long:"environment" description:"environment to run in" default:"development"`
+	HTTPPort                    string                         `long:"proxy-port" description:"port which http server listens on" default:"8080"`
+	StartHTTPServer             bool                           `long:"start-http-server" description:"run the http server" default:"false"`
+	AdminPort                   string                         `long:"admin-port" description:"port which the admin server, serving metrics, pprof and runtime state, listens on, off when empty"`
+	AdminHost                   string                         `long:"admin-host" description:"interface the admin server listens on, only loopback without an admin token" default:"127.0.0.1"`
+	AdminToken                  string                         `long:"admin-token" description:"bearer token required by the admin server"`
+	GRPCPort                    string                         `long:"proxy-port" description:"port which grpc server listens on" default:"8081"`
+	GRPCUnaryInterceptor        grpc.UnaryServerInterceptor    `long:"-" description:"grpc unary interceptor, runs before GRPCUnaryInterceptors"`
+	GRPCUnaryInterceptors       []grpc.UnaryServerInterceptor  `long:"-" description:"grpc unary interceptors, run in order"`
+	GRPCStreamInterceptors      []grpc.StreamServerInterceptor `long:"-" description:"grpc stream interceptors, run in order"`
+	GRPCClients                 map[string]GRPCClientOptions   `long:"-" description:"downstream grpc clients by name, see GRPCClientOptionsFromConfig"`
+	StartGRPCServer             bool                           `long:"start-grpc-server" description:"run the grpc server" default:"false"`
+	Multiplex                   bool                           `long:"multiplex" description:"serve http and grpc on HTTPPort, routed by protocol"`
+	GRPCGateway                 bool                           `long:"grpc-gateway" description:"serve grpc methods annotated with google.api.http as json on the http router"`
+	GRPCGatewayHeaders          []string                       `long:"-" description:"http headers forwarded as grpc metadata by the gateway, on top of Authorization and X-Request-ID"`
+	GRPCGatewayMaxBodyBytes     int64                          `long:"grpc-gateway-max-body-bytes" description:"largest request body the gateway reads, larger ones get a 413, DefaultGRPCGatewayMaxBodyBytes when 0"`
+	Logger                      Logger                         `long:"-" description:"logger"`
+	LogLevel                    *zap.AtomicLevel               `long:"-" description:"level of Logger, changed from the admin server"`
+	Tracing                     TracingOptions                 `long:"-" description:"opentelemetry tracing, off without an exporter"`
+	WriteTimeout                time.Duration                  `long:"write-timeout" description:"http server write timeout" default:"15s"`
+	ReadTimeout                 time.Duration                  `long:"read-timeout" description:"http server read timeout" default:"15s"`
+	IdleTimeout                 time.Duration                  `long:"idle-timeout" description:"http server idle timeout" default:"60s"`
+	GRPCIdleTimeout             time.Duration                  `long:"grpc-idle-timeout" description:"grpc connections idle this long are closed, 0 keeps them open"`
+	ShutdownWait                time.Duration                  `long:"shutdown-wait" description:"time to wait for server to shutdown" default:"30s"`
+	ReadinessDrainWait          time.Duration                  `long:"readiness-drain-wait" description:"time between failing readiness and shutting down the servers, negative skips it" default:"5s"`
+	StopOnProcessorStartFailure bool                           `long:"stop-on-processor-start-failure" description:"stop the server if a processor fails to start"`
+	ProcessorRestartBackoff     time.Duration                  `long:"processor-restart-backoff" description:"initial wait before restarting a crashed processor" default:"1s"`
+	ProcessorRestartMaxBackoff  time.Duration                  `long:"processor-restart-max-backoff" description:"maximum wait between processor restarts" default:"30s"`
+	ProcessorMaxRestarts        int                            `long:"processor-max-restarts" description:"restarts attempted before a processor is marked failed, 0 is unlimited"`
+	DisableProcessorRestarts    bool                           `long:"disable-processor-restarts" description:"do not restart crashed processors"`
+}
+
+// OptionsFromConfig maps the service config onto Options: the environment, the servers' ports and whether they
+// start, the http timeouts, the gateway's body limit, the gRPC idle timeout, the downstream gRPC clients and tracing,
+// reported under the AppName. ShutdownWait is the longer of the two servers' waits. The logger and anything not in
+// the config are left for the caller to set.
+func OptionsFromConfig(conf config.Config) Options {
+	seconds := func(s int) time.Duration { return time.Duration(s) * time.Second }
+	return Options{
+		Environment:             conf.Environment,
+		HTTPPort:                conf.HTTPServerConfig.Port,
+		StartHTTPServer:         conf.HTTPServerConfig.Port != "",
+		AdminPort:               conf.AdminServerConfig.Port,
+		AdminHost:               conf.AdminServerConfig.Host,
+		AdminToken:              conf.AdminServerConfig.Token,
+		GRPCPort:                conf.GRPCServerConfig.Port,
+		StartGRPCServer:         conf.GRPCServerConfig.Port != "",
+		GRPCClients:             GRPCClientOptionsFromConfig(conf.GRPCClientConfigs),
+		WriteTimeout:            seconds(conf.HTTPServerConfig.WriteTimeout),
+		ReadTimeout:             seconds(conf.HTTPServerConfig.ReadTimeout),
+		IdleTimeout:             seconds(conf.HTTPServerConfig.IdleTimeout),
+		GRPCIdleTimeout:         seconds(conf.GRPCServerConfig.IdleTimeout),
+		GRPCGatewayMaxBodyBytes: conf.HTTPServerConfig.MaxBodyBytes,
+		ShutdownWait:            seconds(max(conf.HTTPServerConfig.ShutdownWait, conf.GRPCServerConfig.ShutdownWait)),
+		Tracing: TracingOptions{
+			Exporter:    conf.TracingConfig.Exporter,
+			Endpoint:    conf.TracingConfig.Endpoint,
+			Insecure:    conf.TracingConfig.Insecure,
+			SampleRatio: conf.TracingConfig.SampleRatio,
+			ServiceName: conf.AppName,
+		},
+	}
 }
 
 func (o Options) ValuesOrDefaults() Options {
@@ -33,8 +85,17 @@ func (o Options) ValuesOrDefaults() Options {
 	if o.GRPCPort == "" {
 		o.GRPCPort = "8081"
 	}
+	if o.StartHTTPServer && o.StartGRPCServer && o.HTTPPort == o.GRPCPort {
+		// two listeners cannot share a port, so serve both from one
+		o.Multiplex = true
+	}
+	if o.AdminHost == "" {
+		o.AdminHost = DefaultAdminHost
+	}
 	if o.Logger == nil {
-		o.Logger, _ = NewDefaultLogger(o.Environment)
+		level := zap.NewAtomicLevelAt(DefaultLogLevel(o.Environment))
+		o.Logger, _ = NewLogger(o.Environment, level)
+		o.LogLevel = &level
 	}
 	if o.WriteTimeout == 0 {
 		o.WriteTimeout = 15 * time.Second
@@ -48,9 +109,22 @@ func (o Options) ValuesOrDefaults() Options {
 	if o.ShutdownWait == 0 {
 		o.ShutdownWait = 30 * time.Second
 	}
+	if o.ReadinessDrainWait == 0 && o.Environment != Development && o.Environment != Test {
+		// nothing routes traffic to a local or test instance, so only deployed ones wait
+		o.ReadinessDrainWait = DefaultReadinessDrainWait
+	}
+	if o.ProcessorRestartBackoff == 0 {
+		o.ProcessorRestartBackoff = time.Second
+	}
+	if o.ProcessorRestartMaxBackoff == 0 {
+		o.ProcessorRestartMaxBackoff = 30 * time.Second
+	}
 	return o
 }
 
+// DefaultReadinessDrainWait gives load balancers time to notice failing readiness before the servers stop.
+const DefaultReadinessDrainWait = 5 * time.Second
+
 const (
 	Development = "development"
 	Test        = "test"
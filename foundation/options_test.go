@@ -0,0 +1,122 @@
+package foundation_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OptionsFromConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		given config.Config
+		want  foundation.Options
+	}{
+		{
+			name: "http only",
+			given: config.Config{
+				Environment:       foundation.Staging,
+				HTTPServerConfig:  config.ServerConfig{Port: "8080", ShutdownWait: 30, WriteTimeout: 15, ReadTimeout: 10, IdleTimeout: 60, MaxBodyBytes: 1 << 20},
+				AdminServerConfig: config.AdminServerConfig{Port: "9090"},
+			},
+			want: foundation.Options{
+				Environment:     foundation.Staging,
+				HTTPPort:        "8080",
+				StartHTTPServer: true,
+				AdminPort:       "9090",
+				GRPCClients:     map[string]foundation.GRPCClientOptions{},
+				WriteTimeout:    15 * time.Second,
+				ReadTimeout:     10 * time.Second,
+				IdleTimeout:     60 * time.Second,
+				ShutdownWait:    30 * time.Second,
+
+				GRPCGatewayMaxBodyBytes: 1 << 20,
+			},
+		},
+		{
+			name: "tracing",
+			given: config.Config{
+				AppName:       "orders",
+				Environment:   foundation.Production,
+				TracingConfig: config.TracingConfig{Exporter: "otlp", Endpoint: "otel-collector:4317", Insecure: true, SampleRatio: 0.1},
+			},
+			want: foundation.Options{
+				Environment: foundation.Production,
+				GRPCClients: map[string]foundation.GRPCClientOptions{},
+				Tracing: foundation.TracingOptions{
+					Exporter:    foundation.TracingExporterOTLP,
+					Endpoint:    "otel-collector:4317",
+					Insecure:    true,
+					SampleRatio: 0.1,
+					ServiceName: "orders",
+				},
+			},
+		},
+		{
+			name: "http and grpc",
+			given: config.Config{
+				Environment:      foundation.Production,
+				HTTPServerConfig: config.ServerConfig{Port: "8080", ShutdownWait: 10},
+				GRPCServerConfig: config.ServerConfig{Port: "8081", ShutdownWait: 45, IdleTimeout: 300},
+			},
+			want: foundation.Options{
+				Environment:     foundation.Production,
+				HTTPPort:        "8080",
+				StartHTTPServer: true,
+				GRPCPort:        "8081",
+				StartGRPCServer: true,
+				GRPCClients:     map[string]foundation.GRPCClientOptions{},
+				GRPCIdleTimeout: 5 * time.Minute,
+				ShutdownWait:    45 * time.Second,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, foundation.OptionsFromConfig(tc.given))
+		})
+	}
+}
+
+func Test_NewSetsShutdownWait(t *testing.T) {
+	t.Parallel()
+
+	f := foundation.New(foundation.Options{Environment: foundation.Test, Logger: foundation.NewNopLogger(), ShutdownWait: 5 * time.Second})
+	assert.Equal(t, 5*time.Second, f.ShutdownWait)
+
+	f = foundation.New(foundation.Options{Environment: foundation.Test, Logger: foundation.NewNopLogger()})
+	assert.Equal(t, 30*time.Second, f.ShutdownWait)
+}
+
+func Test_OptionsReadinessDrainWait(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		given foundation.Options
+		want  time.Duration
+	}{
+		{name: "deployed", given: foundation.Options{Environment: foundation.Production}, want: foundation.DefaultReadinessDrainWait},
+		{name: "test", given: foundation.Options{Environment: foundation.Test}},
+		{name: "development", given: foundation.Options{Environment: foundation.Development}},
+		{name: "set", given: foundation.Options{Environment: foundation.Production, ReadinessDrainWait: time.Second}, want: time.Second},
+		{name: "skipped", given: foundation.Options{Environment: foundation.Staging, ReadinessDrainWait: -1}, want: -1},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tc.given.Logger = foundation.NewNopLogger()
+			assert.Equal(t, tc.want, tc.given.ValuesOrDefaults().ReadinessDrainWait)
+		})
+	}
+}
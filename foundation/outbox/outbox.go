@@ -0,0 +1,108 @@
+// Package outbox implements the transactional outbox pattern: events are written to an outbox table in the same
+// transaction as the changes they describe, and a Relay publishes them afterwards. An event is therefore published
+// if and only if its transaction committed, at least once.
+//
+// The outbox is Postgres specific. Create the table with Schema, ex. in a migration.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/pubsub"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultTable is the outbox table name used when none is configured.
+const DefaultTable = "outbox"
+
+// Schema creates DefaultTable and the index the relay claims pending events with.
+const Schema = `CREATE TABLE IF NOT EXISTS outbox (
+	id              bigserial PRIMARY KEY,
+	idempotency_key text NOT NULL UNIQUE,
+	topic           text NOT NULL,
+	payload         bytea NOT NULL,
+	attributes      jsonb NOT NULL DEFAULT '{}',
+	ordering_key    text NOT NULL DEFAULT '',
+	created_at      timestamptz NOT NULL DEFAULT now(),
+	sent_at         timestamptz,
+	attempts        integer NOT NULL DEFAULT 0,
+	last_error      text,
+	claimed_until   timestamptz,
+	failed_at       timestamptz
+);
+CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (id) WHERE sent_at IS NULL AND failed_at IS NULL;`
+
+// IdempotencyKeyAttribute carries Event.IdempotencyKey on the published message, so consumers can discard the
+// duplicates at-least-once delivery produces.
+const IdempotencyKeyAttribute = "x-idempotency-key"
+
+// Event is a message to publish once the transaction commits.
+type Event struct {
+	// Topic the event is published to.
+	Topic string
+
+	// Payload is the message data.
+	Payload []byte
+
+	// Attributes are published with the message.
+	// Optional.
+	Attributes map[string]string
+
+	// IdempotencyKey identifies the event. Writing an event whose key is already in the outbox is a no-op, so
+	// retried requests do not publish twice.
+	// Optional. Default value a random UUID.
+	IdempotencyKey string
+
+	// OrderingKey groups events that must be published in the order they were written. Events without one are
+	// ordered among themselves.
+	// Optional.
+	OrderingKey string
+}
+
+// NewJSONEvent returns an event whose payload is the JSON encoding of payload.
+func NewJSONEvent[T any](topic string, payload T) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("[outbox] encoding %T: %w", payload, err)
+	}
+	return Event{Topic: topic, Payload: data}, nil
+}
+
+// Write inserts events into DefaultTable within tx, usually foundation.TxMustFrom(c). The request ID and trace
+// context in ctx are added to the attributes, so the relayed messages join the request's trace.
+func Write(ctx context.Context, tx sqlx.ExtContext, events ...Event) error {
+	return WriteTo(ctx, tx, DefaultTable, events...)
+}
+
+// WriteTo is Write for a custom outbox table.
+func WriteTo(ctx context.Context, tx sqlx.ExtContext, table string, events ...Event) error {
+	query := `INSERT INTO ` + table + ` (idempotency_key, topic, payload, attributes, ordering_key)
+VALUES ($1, $2, $3, $4, $5) ON CONFLICT (idempotency_key) DO NOTHING`
+
+	requestID := foundation.RequestIDFromContext(ctx)
+	for _, event := range events {
+		if event.IdempotencyKey == "" {
+			event.IdempotencyKey = uuid.Must(uuid.NewV4()).String()
+		}
+		attributes := make(map[string]string, len(event.Attributes)+1)
+		for key, value := range event.Attributes {
+			attributes[key] = value
+		}
+		if _, found := attributes[pubsub.RequestIDAttribute]; !found && requestID != "" {
+			attributes[pubsub.RequestIDAttribute] = requestID
+		}
+		pubsub.InjectTrace(ctx, attributes)
+		encoded, err := json.Marshal(attributes)
+		if err != nil {
+			return fmt.Errorf("[outbox] encoding attributes: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, event.IdempotencyKey, event.Topic, event.Payload, encoded, event.OrderingKey); err != nil {
+			return fmt.Errorf("[outbox] writing %s event: %w", event.Topic, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/outbox"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type publishedEvent struct {
+	topic      string
+	data       string
+	attributes map[string]string
+}
+
+type fakePublisher struct {
+	mu        sync.Mutex
+	failTopic string
+	published []publishedEvent
+}
+
+func (p *fakePublisher) Publish(_ context.Context, topic string, data []byte, attributes map[string]string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if topic == p.failTopic {
+		return "", errors.New("topic not found")
+	}
+	p.published = append(p.published, publishedEvent{topic: topic, data: string(data), attributes: attributes})
+	return "message-id", nil
+}
+
+func Test_Write(t *testing.T) {
+	t.Parallel()
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	event, err := outbox.NewJSONEvent("orders", map[string]string{"orderID": "order-1"})
+	require.NoError(t, err)
+	event.IdempotencyKey = "order-1-created"
+	event.OrderingKey = "order-1"
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO outbox \(idempotency_key, topic, payload, attributes, ordering_key\)`).
+		WithArgs("order-1-created", "orders", []byte(`{"orderID":"order-1"}`), []byte(`{"traceparent":"`+traceparent+`","x-request-id":"abc-123"}`), "order-1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO outbox .* ON CONFLICT \(idempotency_key\) DO NOTHING`).
+		WithArgs(sqlmock.AnyArg(), "orders", []byte("raw"), []byte(`{"source":"test","traceparent":"`+traceparent+`","x-request-id":"abc-123"}`), "").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	tx, err := sqlx.NewDb(conn, "sqlmock").Beginx()
+	require.NoError(t, err)
+	ctx := foundation.ContextWithRequestID(context.Background(), "abc-123")
+	ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	require.NoError(t, outbox.Write(ctx, tx, event, outbox.Event{Topic: "orders", Payload: []byte("raw"), Attributes: map[string]string{"source": "test"}}))
+	require.NoError(t, tx.Commit())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func Test_RelayOnce(t *testing.T) {
+	t.Parallel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	columns := []string{"id", "idempotency_key", "topic", "payload", "attributes", "ordering_key", "attempts"}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock\(hashtext\(\$1\)\)`).WithArgs("outbox").
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM outbox WHERE sent_at IS NULL AND failed_at IS NULL AND claimed_until > now\(\)\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`UPDATE outbox SET claimed_until = now\(\) \+ \$2 \* interval '1 second' WHERE id IN \(\s*SELECT id FROM outbox WHERE sent_at IS NULL AND failed_at IS NULL ORDER BY id LIMIT \$1\s*\) RETURNING`).
+		WithArgs(100, float64(60)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(3, "key-3", "orders", []byte("third"), []byte(`{"x-request-id":"abc-123"}`), "order-2", 0).
+			AddRow(1, "key-1", "missing", []byte("first"), []byte(`{}`), "order-1", 0).
+			AddRow(2, "key-2", "orders", []byte("second"), []byte(`{}`), "order-1", 0).
+			AddRow(4, "key-4", "missing", []byte("fourth"), []byte(`{}`), "order-3", 9).
+			AddRow(5, "key-5", "orders", []byte("fifth"), []byte(`{}`), "order-3", 0))
+	mock.ExpectCommit()
+	// the batch is published outside the claim transaction
+	mock.ExpectExec(`UPDATE outbox SET attempts = attempts \+ 1, last_error = \$2, claimed_until = NULL WHERE id = \$1`).
+		WithArgs(1, "[outbox] event 1: topic not found").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE outbox SET claimed_until = NULL WHERE id = \$1`).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE outbox SET sent_at = now\(\), claimed_until = NULL WHERE id = \$1`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE outbox SET attempts = attempts \+ 1, last_error = \$2, claimed_until = NULL, failed_at = now\(\) WHERE id = \$1`).
+		WithArgs(4, "[outbox] event 4: topic not found").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE outbox SET sent_at = now\(\), claimed_until = NULL WHERE id = \$1`).WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	publisher := &fakePublisher{failTopic: "missing"}
+	relay := outbox.NewRelay(outbox.RelayConfig{DB: sqlx.NewDb(conn, "sqlmock"), Publisher: publisher}, foundation.NewNopLogger())
+
+	published, err := relay.RelayOnce(context.Background())
+	assert.ErrorContains(t, err, "topic not found")
+	assert.Equal(t, 2, published)
+	// event 2 shares its ordering key with the failed event 1, so it waits; event 4 ran out of attempts, so event 5
+	// goes ahead
+	assert.Equal(t, []publishedEvent{{
+		topic:      "orders",
+		data:       "third",
+		attributes: map[string]string{"x-request-id": "abc-123", outbox.IdempotencyKeyAttribute: "key-3"},
+	}, {
+		topic:      "orders",
+		data:       "fifth",
+		attributes: map[string]string{outbox.IdempotencyKeyAttribute: "key-5"},
+	}}, publisher.published)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func Test_RelayOnceSkips(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{name: "locked", expect: func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).WithArgs("outbox").
+				WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+		}},
+		{name: "batch in flight", expect: func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).WithArgs("outbox").
+				WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+			mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			conn, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer conn.Close()
+			mock.ExpectBegin()
+			tc.expect(mock)
+			mock.ExpectRollback()
+
+			relay := outbox.NewRelay(outbox.RelayConfig{DB: sqlx.NewDb(conn, "sqlmock"), Publisher: &fakePublisher{}}, foundation.NewNopLogger())
+			published, err := relay.RelayOnce(context.Background())
+			require.NoError(t, err)
+			assert.Zero(t, published)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_RequeueFailed(t *testing.T) {
+	t.Parallel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+	mock.ExpectExec(`UPDATE outbox SET failed_at = NULL, attempts = 0 WHERE failed_at IS NOT NULL`).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	relay := outbox.NewRelay(outbox.RelayConfig{DB: sqlx.NewDb(conn, "sqlmock"), Publisher: &fakePublisher{}}, foundation.NewNopLogger())
+	requeued, err := relay.RequeueFailed(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), requeued)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
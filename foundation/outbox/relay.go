@@ -0,0 +1,317 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Publisher publishes a message, ex. *pubsub.Publisher.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) (messageID string, err error)
+}
+
+// RelayConfig defines the config for a Relay.
+type RelayConfig struct {
+	// DB holds the outbox table.
+	DB *sqlx.DB
+
+	// Publisher sends the events.
+	Publisher Publisher
+
+	// Table is the outbox table.
+	// Optional. Default value DefaultTable.
+	Table string
+
+	// DependsOn names the processors that must be running first, ex. "db:main" and "pubsub:publisher".
+	// Optional.
+	DependsOn []string
+
+	// BatchSize is the number of events read per round.
+	// Optional. Default value 100.
+	BatchSize int
+
+	// PollInterval is the wait between rounds once the outbox is empty.
+	// Optional. Default value 1 second.
+	PollInterval time.Duration
+
+	// MaxBackoff caps the wait between rounds while publishing fails. The wait starts at PollInterval and doubles.
+	// Optional. Default value 1 minute.
+	MaxBackoff time.Duration
+
+	// Retention deletes sent events older than this after each round. Zero keeps them.
+	// Optional.
+	Retention time.Duration
+
+	// MaxAttempts is the number of failed publications after which an event is marked failed and no longer holds
+	// back the events after it. Failed events stay in the table until RequeueFailed.
+	// Optional. Default value 10.
+	MaxAttempts int
+
+	// ClaimTimeout is how long a relay may take to publish the batch it claimed before another instance may claim
+	// the unsent events again, ex. after a crash.
+	// Optional. Default value 1 minute.
+	ClaimTimeout time.Duration
+}
+
+// Relay publishes outbox events in the order they were written and marks them sent. A failed event is retried on
+// the next round and holds back the later events with the same OrderingKey until it succeeds or, after MaxAttempts,
+// is marked failed.
+//
+// Each round claims a batch in a short transaction, publishes it without holding any transaction or lock, and then
+// marks every event. Only one batch is claimed at a time, so running a relay per instance is safe and keeps the
+// order. Events are published before they are marked sent; if marking fails, or the relay dies before, they are
+// published again once their claim times out, which consumers handle with the idempotency key.
+//
+// Relay is a foundation.SupervisedProcessor.
+type Relay struct {
+	conf   RelayConfig
+	logger foundation.Logger
+
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	done     chan error
+	finished chan struct{}
+}
+
+func NewRelay(conf RelayConfig, logger foundation.Logger) *Relay {
+	if conf.Table == "" {
+		conf.Table = DefaultTable
+	}
+	if conf.BatchSize == 0 {
+		conf.BatchSize = 100
+	}
+	if conf.PollInterval == 0 {
+		conf.PollInterval = time.Second
+	}
+	if conf.MaxBackoff == 0 {
+		conf.MaxBackoff = time.Minute
+	}
+	if conf.MaxAttempts == 0 {
+		conf.MaxAttempts = 10
+	}
+	if conf.ClaimTimeout == 0 {
+		conf.ClaimTimeout = time.Minute
+	}
+	return &Relay{conf: conf, logger: logger.With(zap.String("outbox", conf.Table))}
+}
+
+func (r *Relay) Name() string {
+	return "outbox:" + r.conf.Table
+}
+
+func (r *Relay) DependsOn() []string {
+	return r.conf.DependsOn
+}
+
+func (r *Relay) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	finished := make(chan struct{})
+
+	r.mu.Lock()
+	r.cancel, r.done, r.finished = cancel, done, finished
+	r.mu.Unlock()
+
+	go func() {
+		defer close(finished)
+		r.run(ctx)
+	}()
+	return nil
+}
+
+func (r *Relay) Done() <-chan error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done
+}
+
+// Stop waits for the round in progress to finish.
+func (r *Relay) Stop(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	r.mu.Lock()
+	cancel, finished := r.cancel, r.finished
+	r.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-finished
+	}
+	return nil
+}
+
+func (r *Relay) run(ctx context.Context) {
+	wait := time.Duration(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		published, err := r.RelayOnce(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			r.logger.Warn("outbox relay round failed", zap.Error(err), zap.Duration("backoff", wait))
+			wait = min(max(2*wait, r.conf.PollInterval), r.conf.MaxBackoff)
+		case published == r.conf.BatchSize:
+			// there is probably more waiting
+			wait = 0
+		default:
+			wait = r.conf.PollInterval
+		}
+	}
+}
+
+type outboxRow struct {
+	ID             int64  `db:"id"`
+	IdempotencyKey string `db:"idempotency_key"`
+	Topic          string `db:"topic"`
+	Payload        []byte `db:"payload"`
+	Attributes     []byte `db:"attributes"`
+	OrderingKey    string `db:"ordering_key"`
+	Attempts       int    `db:"attempts"`
+}
+
+// RelayOnce publishes a single batch and returns how many events were sent. It returns an error when the database
+// failed or when any event could not be published. Use it from a Cloud Run job instead of running a Relay.
+func (r *Relay) RelayOnce(ctx context.Context) (published int, err error) {
+	rows, err := r.claim(ctx)
+	if err != nil || len(rows) == 0 {
+		return 0, err
+	}
+
+	// the outcome is recorded even when the relay is stopping, so events are not published twice
+	markCtx := context.WithoutCancel(ctx)
+	var failures []error
+	blocked := map[string]bool{}
+	for _, row := range rows {
+		if blocked[row.OrderingKey] {
+			if _, err := r.conf.DB.ExecContext(markCtx, `UPDATE `+r.conf.Table+` SET claimed_until = NULL WHERE id = $1`, row.ID); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if publishErr := r.publish(ctx, row); publishErr != nil {
+			failures = append(failures, publishErr)
+			failed, err := r.markFailed(markCtx, row, publishErr)
+			if err != nil {
+				return published, err
+			}
+			// a failed event no longer holds its ordering key back
+			blocked[row.OrderingKey] = !failed
+			continue
+		}
+		if _, err := r.conf.DB.ExecContext(markCtx, `UPDATE `+r.conf.Table+` SET sent_at = now(), claimed_until = NULL WHERE id = $1`, row.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	if r.conf.Retention > 0 {
+		if _, err := r.conf.DB.ExecContext(markCtx, `DELETE FROM `+r.conf.Table+` WHERE sent_at < $1`, time.Now().Add(-r.conf.Retention)); err != nil {
+			return published, err
+		}
+	}
+	if published > 0 {
+		r.logger.Info("outbox events published", zap.Int("count", published))
+	}
+	return published, errors.Join(failures...)
+}
+
+// claim reserves the next batch for ClaimTimeout. It returns nothing while another relay holds a batch, so a single
+// relay publishes at a time.
+func (r *Relay) claim(ctx context.Context) (rows []outboxRow, err error) {
+	tx, err := r.conf.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil || len(rows) == 0 {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var locked bool
+	if err := tx.GetContext(ctx, &locked, `SELECT pg_try_advisory_xact_lock(hashtext($1))`, r.conf.Table); err != nil {
+		return nil, err
+	}
+	if !locked {
+		// another instance is claiming
+		return nil, nil
+	}
+	var busy bool
+	if err := tx.GetContext(ctx, &busy, `SELECT EXISTS (SELECT 1 FROM `+r.conf.Table+
+		` WHERE sent_at IS NULL AND failed_at IS NULL AND claimed_until > now())`); err != nil {
+		return nil, err
+	}
+	if busy {
+		// another instance is publishing its batch
+		return nil, nil
+	}
+
+	query := `UPDATE ` + r.conf.Table + ` SET claimed_until = now() + $2 * interval '1 second' WHERE id IN (
+	SELECT id FROM ` + r.conf.Table + ` WHERE sent_at IS NULL AND failed_at IS NULL ORDER BY id LIMIT $1
+) RETURNING id, idempotency_key, topic, payload, attributes, ordering_key, attempts`
+	if err := tx.SelectContext(ctx, &rows, query, r.conf.BatchSize, r.conf.ClaimTimeout.Seconds()); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	// RETURNING does not keep the subquery's order
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	return rows, nil
+}
+
+// markFailed records a failed publication and reports whether the event ran out of attempts and was marked failed.
+func (r *Relay) markFailed(ctx context.Context, row outboxRow, publishErr error) (bool, error) {
+	failed := row.Attempts+1 >= r.conf.MaxAttempts
+	query := `UPDATE ` + r.conf.Table + ` SET attempts = attempts + 1, last_error = $2, claimed_until = NULL WHERE id = $1`
+	if failed {
+		query = `UPDATE ` + r.conf.Table + ` SET attempts = attempts + 1, last_error = $2, claimed_until = NULL, failed_at = now() WHERE id = $1`
+		r.logger.Error("outbox event failed, giving up", zap.Int64("id", row.ID), zap.String("topic", row.Topic),
+			zap.Int("attempts", row.Attempts+1), zap.Error(publishErr))
+	}
+	if _, err := r.conf.DB.ExecContext(ctx, query, row.ID, publishErr.Error()); err != nil {
+		return false, err
+	}
+	return failed, nil
+}
+
+// RequeueFailed gives the events marked failed another MaxAttempts, ex. once their topic has been created, and
+// returns how many there were.
+func (r *Relay) RequeueFailed(ctx context.Context) (int64, error) {
+	result, err := r.conf.DB.ExecContext(ctx, `UPDATE `+r.conf.Table+` SET failed_at = NULL, attempts = 0 WHERE failed_at IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *Relay) publish(ctx context.Context, row outboxRow) error {
+	attributes := map[string]string{}
+	if len(row.Attributes) > 0 {
+		if err := json.Unmarshal(row.Attributes, &attributes); err != nil {
+			return fmt.Errorf("[outbox] event %d: decoding attributes: %w", row.ID, err)
+		}
+	}
+	attributes[IdempotencyKeyAttribute] = row.IdempotencyKey
+	if _, err := r.conf.Publisher.Publish(ctx, row.Topic, row.Payload, attributes); err != nil {
+		return fmt.Errorf("[outbox] event %d: %w", row.ID, err)
+	}
+	return nil
+}
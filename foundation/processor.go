@@ -2,39 +2,104 @@ package foundation
 
 import (
 	"context"
-	"log"
 	"sync"
 )
 
+// Processor is a long running component (a consumer, a connection pool, a relay) whose lifecycle is owned by
+// Foundation. Start must not block; it is called with the RunWithContext context once every dependency is running.
+// Stop is called with a WaitGroup that has already been incremented and must call wg.Done() once it has finished.
 type Processor interface {
 	Start(ctx context.Context) (err error)
 	Stop(wg *sync.WaitGroup) (err error)
 }
 
+// NamedProcessor is a Processor that provides its own name. Names are used to declare dependencies and in logs.
+type NamedProcessor interface {
+	Processor
+	Name() string
+}
+
+// DependentProcessor is a Processor that must not start until the named processors are running.
+type DependentProcessor interface {
+	Processor
+	DependsOn() []string
+}
+
+// SupervisedProcessor is a Processor that can fail after Start has returned. Done returns a channel that receives
+// the error that terminated the processor; it is called again after every successful Start, so implementations
+// should hand out a fresh channel each run. Crashed processors are stopped and restarted with backoff.
+type SupervisedProcessor interface {
+	Processor
+	Done() <-chan error
+}
+
+// ProcessorState describes where a processor is in its supervised lifecycle.
+type ProcessorState string
+
+const (
+	ProcessorPending    ProcessorState = "pending"
+	ProcessorStarting   ProcessorState = "starting"
+	ProcessorRunning    ProcessorState = "running"
+	ProcessorRestarting ProcessorState = "restarting"
+	ProcessorFailed     ProcessorState = "failed"
+	ProcessorStopping   ProcessorState = "stopping"
+	ProcessorStopped    ProcessorState = "stopped"
+)
+
+// ProcessorStatus is a point in time snapshot of a registered processor.
+type ProcessorStatus struct {
+	Name      string
+	State     ProcessorState
+	DependsOn []string
+	Restarts  int
+	LastError error
+}
+
+// AddProcessor registers a processor with the supervisor. If p implements NamedProcessor or DependentProcessor its
+// name and dependencies are used, otherwise it is given a generated name and started in registration order.
 func (f *Foundation) AddProcessor(p Processor) {
-	f.processors = append(f.processors, p)
+	var name string
+	var dependsOn []string
+	if named, ok := p.(NamedProcessor); ok {
+		name = named.Name()
+	}
+	if dependent, ok := p.(DependentProcessor); ok {
+		dependsOn = dependent.DependsOn()
+	}
+	f.AddNamedProcessor(name, p, dependsOn...)
 }
 
-func (f *Foundation) StopProcessors(wg *sync.WaitGroup) (errs []error) {
-	for _, p := range f.processors {
-		wg.Add(1)
-		err := p.Stop(wg)
-		if err != nil {
-			log.Printf("[foundation] ERROR: unable to stop processor: %s", err)
-			errs = append(errs, err)
-		}
+// AddNamedProcessor registers a processor under name that will only be started once every processor in dependsOn
+// is running, and stopped before any of them. A readiness check named "processor:<name>" is registered with it.
+func (f *Foundation) AddNamedProcessor(name string, p Processor, dependsOn ...string) {
+	name = f.processorSupervisor().add(name, p, dependsOn)
+	if f.Health != nil {
+		f.Health.AddReadinessCheck("processor:"+name, f.processorHealthCheck(name))
 	}
-	return
 }
 
-func (f *Foundation) StartProcessors() (errs []error) {
-	ctx := context.Background()
-	for _, p := range f.processors {
-		err := p.Start(ctx)
-		if err != nil {
-			log.Printf("[foundation] ERROR: unable to start processor: %s", err)
-			errs = append(errs, err)
-		}
+// ProcessorStatuses returns the status of every registered processor in start order.
+func (f *Foundation) ProcessorStatuses() []ProcessorStatus {
+	return f.processorSupervisor().statuses()
+}
+
+// StopProcessors stops every started processor in reverse dependency order, waiting for each to finish before
+// stopping the processors it depends on.
+func (f *Foundation) StopProcessors(wg *sync.WaitGroup) (errs []error) {
+	wg.Add(1)
+	defer wg.Done()
+	return f.processorSupervisor().stop()
+}
+
+// StartProcessors starts every registered processor in dependency order with ctx and begins supervising them.
+// Processors that fail to start, or whose dependencies are not running, are retried in the background.
+func (f *Foundation) StartProcessors(ctx context.Context) (errs []error) {
+	return f.processorSupervisor().start(ctx)
+}
+
+func (f *Foundation) processorSupervisor() *supervisor {
+	if f.supervisor == nil {
+		f.supervisor = newSupervisor(f.Logger, Options{}.ValuesOrDefaults())
 	}
-	return
+	return f.supervisor
 }
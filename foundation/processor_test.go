@@ -0,0 +1,224 @@
+package foundation_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *eventLog) all() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+type testProcessor struct {
+	name     string
+	log      *eventLog
+	startErr error
+
+	mu   sync.Mutex
+	done chan error
+}
+
+func (p *testProcessor) Start(ctx context.Context) error {
+	p.log.add("start " + p.name)
+	if p.startErr != nil {
+		return p.startErr
+	}
+	p.mu.Lock()
+	p.done = make(chan error, 1)
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *testProcessor) Stop(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	p.log.add("stop " + p.name)
+	return nil
+}
+
+func (p *testProcessor) Done() <-chan error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done
+}
+
+func (p *testProcessor) crash(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done <- err
+}
+
+func newTestFoundation() *foundation.Foundation {
+	return foundation.New(foundation.Options{
+		Environment:                foundation.Test,
+		Logger:                     foundation.NewNopLogger(),
+		ProcessorRestartBackoff:    time.Millisecond,
+		ProcessorRestartMaxBackoff: 5 * time.Millisecond,
+	})
+}
+
+func Test_ProcessorsStartInDependencyOrder(t *testing.T) {
+	t.Parallel()
+
+	log := &eventLog{}
+	f := newTestFoundation()
+	f.AddNamedProcessor("consumer", &testProcessor{name: "consumer", log: log}, "db", "pubsub")
+	f.AddNamedProcessor("pubsub", &testProcessor{name: "pubsub", log: log})
+	f.AddNamedProcessor("db", &testProcessor{name: "db", log: log})
+
+	errs := f.StartProcessors(context.Background())
+	require.Empty(t, errs)
+
+	var wg sync.WaitGroup
+	errs = f.StopProcessors(&wg)
+	wg.Wait()
+	require.Empty(t, errs)
+
+	assert.Equal(t, []string{
+		"start db", "start pubsub", "start consumer",
+		"stop consumer", "stop pubsub", "stop db",
+	}, log.all())
+	for _, status := range f.ProcessorStatuses() {
+		assert.Equal(t, foundation.ProcessorStopped, status.State)
+	}
+}
+
+func Test_ProcessorDependencyErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		givenSetup func(f *foundation.Foundation, log *eventLog)
+		wantErr    string
+	}{
+		{
+			name: "cycle",
+			givenSetup: func(f *foundation.Foundation, log *eventLog) {
+				f.AddNamedProcessor("a", &testProcessor{name: "a", log: log}, "b")
+				f.AddNamedProcessor("b", &testProcessor{name: "b", log: log}, "a")
+			},
+			wantErr: "cycle",
+		},
+		{
+			name: "unknown dependency",
+			givenSetup: func(f *foundation.Foundation, log *eventLog) {
+				f.AddNamedProcessor("a", &testProcessor{name: "a", log: log}, "missing")
+			},
+			wantErr: `unknown processor "missing"`,
+		},
+		{
+			name: "duplicate name",
+			givenSetup: func(f *foundation.Foundation, log *eventLog) {
+				f.AddNamedProcessor("a", &testProcessor{name: "a", log: log})
+				f.AddNamedProcessor("a", &testProcessor{name: "a", log: log})
+			},
+			wantErr: "more than once",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			log := &eventLog{}
+			f := newTestFoundation()
+			tc.givenSetup(f, log)
+
+			errs := f.StartProcessors(context.Background())
+			require.Len(t, errs, 1)
+			assert.Contains(t, errs[0].Error(), tc.wantErr)
+			assert.Empty(t, log.all())
+		})
+	}
+}
+
+func Test_CrashedProcessorIsRestarted(t *testing.T) {
+	t.Parallel()
+
+	log := &eventLog{}
+	p := &testProcessor{name: "consumer", log: log}
+	f := newTestFoundation()
+	f.AddProcessor(p)
+
+	require.Empty(t, f.StartProcessors(context.Background()))
+	p.crash(errors.New("connection reset"))
+
+	assert.Eventually(t, func() bool {
+		status := f.ProcessorStatuses()[0]
+		return status.State == foundation.ProcessorRunning && status.Restarts == 1
+	}, time.Second, time.Millisecond)
+	assert.ErrorContains(t, f.ProcessorStatuses()[0].LastError, "connection reset")
+
+	var wg sync.WaitGroup
+	f.StopProcessors(&wg)
+	wg.Wait()
+	assert.Equal(t, []string{"start consumer", "stop consumer", "start consumer", "stop consumer"}, log.all())
+}
+
+func Test_ProcessorStartFailureIsRetriedAfterDependency(t *testing.T) {
+	t.Parallel()
+
+	log := &eventLog{}
+	db := &testProcessor{name: "db", log: log, startErr: errors.New("connection refused")}
+	f := foundation.New(foundation.Options{
+		Environment:             foundation.Test,
+		Logger:                  foundation.NewNopLogger(),
+		ProcessorRestartBackoff: time.Millisecond,
+		ProcessorMaxRestarts:    2,
+	})
+	f.AddNamedProcessor("db", db)
+	f.AddNamedProcessor("consumer", &testProcessor{name: "consumer", log: log}, "db")
+
+	errs := f.StartProcessors(context.Background())
+	require.Len(t, errs, 2)
+
+	assert.Eventually(t, func() bool {
+		return f.ProcessorStatuses()[0].State == foundation.ProcessorFailed
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, foundation.ProcessorRestarting, f.ProcessorStatuses()[1].State)
+	assert.Equal(t, []string{"start db", "start db", "start db"}, log.all())
+
+	var wg sync.WaitGroup
+	f.StopProcessors(&wg)
+	wg.Wait()
+}
+
+func Test_PermanentProcessorFailureIsNotRetried(t *testing.T) {
+	t.Parallel()
+
+	log := &eventLog{}
+	f := newTestFoundation()
+	f.AddProcessor(&testProcessor{name: "migrations", log: log, startErr: foundation.Permanent(errors.New("dirty database"))})
+
+	require.Len(t, f.StartProcessors(context.Background()), 1)
+
+	assert.Eventually(t, func() bool {
+		return f.ProcessorStatuses()[0].State == foundation.ProcessorFailed
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"start migrations"}, log.all())
+	assert.False(t, f.Health.Ready(context.Background()).OK())
+
+	var wg sync.WaitGroup
+	f.StopProcessors(&wg)
+	wg.Wait()
+}
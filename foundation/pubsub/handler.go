@@ -0,0 +1,28 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	gcpubsub "cloud.google.com/go/pubsub"
+	"github.com/OptechLabs/monorepo/foundation"
+)
+
+// MessageHandler processes a message. Returning nil acks it, an error nacks it for redelivery and an error wrapped
+// with foundation.Permanent sends it to the dead-letter topic.
+type MessageHandler func(ctx context.Context, msg *gcpubsub.Message) error
+
+// Handler processes a message whose data has been decoded into T.
+type Handler[T any] func(ctx context.Context, payload T, msg *gcpubsub.Message) error
+
+// JSON adapts a typed handler. Messages that do not decode into T are dead-lettered, redelivering them would not help.
+func JSON[T any](handler Handler[T]) MessageHandler {
+	return func(ctx context.Context, msg *gcpubsub.Message) error {
+		var payload T
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			return foundation.Permanent(fmt.Errorf("decoding %T: %w", payload, err))
+		}
+		return handler(ctx, payload, msg)
+	}
+}
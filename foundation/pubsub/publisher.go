@@ -0,0 +1,97 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	gcpubsub "cloud.google.com/go/pubsub"
+	"github.com/OptechLabs/monorepo/foundation"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// messagingSystem is the messaging.system span attribute of Pub/Sub.
+const messagingSystem = "gcp_pubsub"
+
+// Publisher publishes to topics by ID, reusing a batching *pubsub.Topic per topic. It is a foundation.Processor
+// whose Stop flushes the messages still being batched.
+type Publisher struct {
+	client *gcpubsub.Client
+	mu     sync.Mutex
+	topics map[string]*gcpubsub.Topic
+}
+
+func NewPublisher(client *gcpubsub.Client) *Publisher {
+	return &Publisher{client: client, topics: map[string]*gcpubsub.Topic{}}
+}
+
+func (p *Publisher) Name() string {
+	return "pubsub:publisher"
+}
+
+func (p *Publisher) Start(context.Context) error {
+	return nil
+}
+
+func (p *Publisher) Stop(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, topic := range p.topics {
+		topic.Stop()
+	}
+	p.topics = map[string]*gcpubsub.Topic{}
+	return nil
+}
+
+// Publish sends data to topic and waits for the server to accept it. The request ID in ctx is added as the
+// x-request-id attribute, and the trace context as traceparent, so the subscriber logs and spans can be joined up
+// with the request that caused them.
+func (p *Publisher) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) (messageID string, err error) {
+	ctx, span := foundation.TracerFromContext(ctx).Start(foundation.ContextWithSpan(ctx), topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingSystemKey.String(messagingSystem), semconv.MessagingDestinationName(topic)),
+	)
+	defer span.End()
+
+	msg := &gcpubsub.Message{Data: data, Attributes: map[string]string{}}
+	for key, value := range attributes {
+		msg.Attributes[key] = value
+	}
+	if requestID := foundation.RequestIDFromContext(ctx); requestID != "" && msg.Attributes[RequestIDAttribute] == "" {
+		msg.Attributes[RequestIDAttribute] = requestID
+	}
+	InjectTrace(ctx, msg.Attributes)
+
+	messageID, err = p.topic(topic).Publish(ctx, msg).Get(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "publish")
+		return "", fmt.Errorf("[pubsub] publish to %s: %w", topic, err)
+	}
+	span.SetAttributes(semconv.MessagingMessageID(messageID))
+	return messageID, nil
+}
+
+// PublishJSON publishes payload encoded as JSON, the counterpart of JSON handlers.
+func PublishJSON[T any](ctx context.Context, p *Publisher, topic string, payload T, attributes map[string]string) (messageID string, err error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("[pubsub] encoding %T: %w", payload, err)
+	}
+	return p.Publish(ctx, topic, data, attributes)
+}
+
+func (p *Publisher) topic(id string) *gcpubsub.Topic {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	topic, found := p.topics[id]
+	if !found {
+		topic = p.client.Topic(id)
+		p.topics[id] = topic
+	}
+	return topic
+}
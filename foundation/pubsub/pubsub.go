@@ -0,0 +1,54 @@
+// Package pubsub consumes and publishes Google Cloud Pub/Sub messages. Subscriber and Publisher are
+// foundation.Processors, so consumers start with the service and drain on shutdown.
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	gcpubsub "cloud.google.com/go/pubsub"
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Attribute names set on published messages and read by subscribers.
+const (
+	RequestIDAttribute   = "x-request-id"
+	TraceparentAttribute = "traceparent"
+	ErrorAttribute       = "x-error"
+
+	// Set on dead-lettered messages.
+	SubscriptionAttribute = "x-subscription"
+	MessageIDAttribute    = "x-message-id"
+)
+
+// NewClient connects to Pub/Sub for projectID. When conf.Host is set the client talks to the emulator at
+// Host:Port without credentials, as started by `gcloud beta emulators pubsub start`.
+func NewClient(ctx context.Context, projectID string, conf config.PubSubConfig, opts ...option.ClientOption) (*gcpubsub.Client, error) {
+	if conf.Host != "" {
+		opts = append([]option.ClientOption{
+			option.WithEndpoint(net.JoinHostPort(conf.Host, conf.Port)),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		}, opts...)
+	}
+	client, err := gcpubsub.NewClient(ctx, projectID, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("[pubsub] %w", err)
+	}
+	return client, nil
+}
+
+// InjectTrace adds the W3C trace context of the span in ctx to attributes, unless they already carry one, ex.
+// events written to the outbox during a request and relayed later.
+func InjectTrace(ctx context.Context, attributes map[string]string) {
+	if _, found := attributes[TraceparentAttribute]; found {
+		return
+	}
+	foundation.Propagator.Inject(foundation.ContextWithSpan(ctx), propagation.MapCarrier(attributes))
+}
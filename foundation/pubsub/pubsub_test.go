@@ -0,0 +1,220 @@
+package pubsub_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	gcpubsub "cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/pubsub"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type orderCreated struct {
+	OrderID string `json:"orderID"`
+}
+
+// newEmulator starts a fake Pub/Sub server with an orders topic and subscription, and a dead-letter topic with a
+// subscription to inspect it, and connects to it the way a service connects to the emulator.
+func newEmulator(t *testing.T) *gcpubsub.Client {
+	srv := pstest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+
+	host, port, err := net.SplitHostPort(srv.Addr)
+	require.NoError(t, err)
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, "monorepo-local", config.PubSubConfig{Host: host, Port: port})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	for topicID, subscriptionID := range map[string]string{"orders": "orders-billing", "orders-dead-letter": "orders-dead-letter-inspect"} {
+		topic, err := client.CreateTopic(ctx, topicID)
+		require.NoError(t, err)
+		_, err = client.CreateSubscription(ctx, subscriptionID, gcpubsub.SubscriptionConfig{Topic: topic})
+		require.NoError(t, err)
+	}
+	return client
+}
+
+func startSubscriber(t *testing.T, subscriber *pubsub.Subscriber) func() error {
+	require.NoError(t, subscriber.Start(context.Background()))
+	return func() error {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		err := subscriber.Stop(&wg)
+		wg.Wait()
+		return err
+	}
+}
+
+func Test_SubscriberDispatchesTypedMessages(t *testing.T) {
+	t.Parallel()
+
+	client := newEmulator(t)
+	publisher := pubsub.NewPublisher(client)
+
+	received := make(chan string, 1)
+	requestIDs := make(chan string, 1)
+	stop := startSubscriber(t, pubsub.NewSubscriber(client, pubsub.SubscriberConfig{
+		Subscription: "orders-billing",
+		Handler: pubsub.JSON(func(ctx context.Context, payload orderCreated, msg *gcpubsub.Message) error {
+			requestIDs <- foundation.RequestIDFromContext(ctx)
+			received <- payload.OrderID
+			return nil
+		}),
+	}, foundation.NewNopLogger()))
+	defer stop()
+
+	ctx := foundation.ContextWithRequestID(context.Background(), "abc-123")
+	_, err := pubsub.PublishJSON(ctx, publisher, "orders", orderCreated{OrderID: "order-1"}, nil)
+	require.NoError(t, err)
+
+	select {
+	case orderID := <-received:
+		assert.Equal(t, "order-1", orderID)
+		assert.Equal(t, "abc-123", <-requestIDs)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not handled")
+	}
+}
+
+func Test_TracePropagatesThroughMessages(t *testing.T) {
+	t.Parallel()
+
+	client := newEmulator(t)
+	publisher := pubsub.NewPublisher(client)
+	exporter := tracetest.NewInMemoryExporter()
+	tracing, err := foundation.NewTracing(context.Background(), foundation.TracingOptions{SpanExporter: exporter, Synchronous: true})
+	require.NoError(t, err)
+
+	handled := make(chan struct{})
+	stop := startSubscriber(t, pubsub.NewSubscriber(client, pubsub.SubscriberConfig{
+		Subscription:   "orders-billing",
+		TracerProvider: tracing.Provider,
+		Handler: func(ctx context.Context, msg *gcpubsub.Message) error {
+			close(handled)
+			return nil
+		},
+	}, foundation.NewNopLogger()))
+	defer stop()
+
+	ctx, parent := tracing.Tracer.Start(context.Background(), "request")
+	_, err = publisher.Publish(ctx, "orders", []byte("{}"), nil)
+	require.NoError(t, err)
+	parent.End()
+
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not handled")
+	}
+	require.Eventually(t, func() bool { return len(exporter.GetSpans()) == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	spans := map[trace.SpanKind]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.SpanKind] = span
+	}
+	producer, consumer := spans[trace.SpanKindProducer], spans[trace.SpanKindConsumer]
+	assert.Equal(t, "orders publish", producer.Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), producer.Parent.SpanID())
+	assert.Equal(t, "orders-billing receive", consumer.Name)
+	assert.Equal(t, parent.SpanContext().TraceID(), consumer.SpanContext.TraceID())
+	assert.Equal(t, producer.SpanContext.SpanID(), consumer.Parent.SpanID())
+}
+
+func Test_SubscriberDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		givenData string
+		givenErr  error
+		wantError string
+	}{
+		{name: "undecodable", givenData: `{"orderID":`, wantError: "decoding pubsub_test.orderCreated"},
+		{name: "permanent error", givenData: `{"orderID":"order-1"}`, givenErr: foundation.Permanent(errors.New("unknown customer")), wantError: "unknown customer"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := newEmulator(t)
+			stop := startSubscriber(t, pubsub.NewSubscriber(client, pubsub.SubscriberConfig{
+				Subscription:    "orders-billing",
+				DeadLetterTopic: "orders-dead-letter",
+				Handler: pubsub.JSON(func(context.Context, orderCreated, *gcpubsub.Message) error {
+					return tc.givenErr
+				}),
+			}, foundation.NewNopLogger()))
+			defer stop()
+
+			ctx := context.Background()
+			messageID, err := pubsub.NewPublisher(client).Publish(ctx, "orders", []byte(tc.givenData), nil)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			var deadLettered *gcpubsub.Message
+			err = client.Subscription("orders-dead-letter-inspect").Receive(ctx, func(_ context.Context, msg *gcpubsub.Message) {
+				msg.Ack()
+				deadLettered = msg
+				cancel()
+			})
+			require.NoError(t, err)
+			require.NotNil(t, deadLettered)
+			assert.Equal(t, tc.givenData, string(deadLettered.Data))
+			assert.Contains(t, deadLettered.Attributes[pubsub.ErrorAttribute], tc.wantError)
+			assert.Equal(t, messageID, deadLettered.Attributes[pubsub.MessageIDAttribute])
+			assert.Equal(t, "orders-billing", deadLettered.Attributes[pubsub.SubscriptionAttribute])
+		})
+	}
+}
+
+func Test_SubscriberDrainsOnStop(t *testing.T) {
+	t.Parallel()
+
+	client := newEmulator(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var handlerErr error
+	stop := startSubscriber(t, pubsub.NewSubscriber(client, pubsub.SubscriberConfig{
+		Subscription: "orders-billing",
+		Handler: func(ctx context.Context, msg *gcpubsub.Message) error {
+			close(started)
+			<-release
+			handlerErr = ctx.Err()
+			return nil
+		},
+	}, foundation.NewNopLogger()))
+
+	_, err := pubsub.NewPublisher(client).Publish(context.Background(), "orders", []byte("{}"), nil)
+	require.NoError(t, err)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not handled")
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- stop() }()
+	select {
+	case <-stopped:
+		t.Fatal("stop returned before the message in flight was handled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-stopped)
+	assert.NoError(t, handlerErr)
+}
@@ -0,0 +1,254 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	gcpubsub "cloud.google.com/go/pubsub"
+	"github.com/OptechLabs/monorepo/foundation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// SubscriberConfig defines the config for a Subscriber.
+type SubscriberConfig struct {
+	// Subscription is the ID of the subscription to receive from.
+	Subscription string
+
+	// Handler processes each message.
+	Handler MessageHandler
+
+	// Name is the processor name.
+	// Optional. Default value "pubsub:<Subscription>".
+	Name string
+
+	// DependsOn names the processors that must be running before messages are received, ex. "db:main".
+	// Optional.
+	DependsOn []string
+
+	// MaxConcurrency is the number of messages handled at the same time.
+	// Optional. Default value 10.
+	MaxConcurrency int
+
+	// HandlerTimeout bounds each call to Handler.
+	// Optional. Default value 1 minute.
+	HandlerTimeout time.Duration
+
+	// DrainTimeout is how long Stop waits for messages being handled to finish.
+	// Optional. Default value 30 seconds.
+	DrainTimeout time.Duration
+
+	// DeadLetterTopic receives the messages that failed permanently, or that failed MaxDeliveryAttempts times,
+	// with the error and original message ID in their attributes. Without it such messages are nacked.
+	// Optional.
+	DeadLetterTopic string
+
+	// MaxDeliveryAttempts dead-letters a message once it has failed this many times. Pub/Sub only counts
+	// deliveries for subscriptions with a dead-letter policy, so it has no effect on other subscriptions.
+	// Optional.
+	MaxDeliveryAttempts int
+
+	// TracerProvider records a consumer span per message, continuing the trace in its traceparent attribute.
+	// Optional. Default value the otel global provider, set by foundation.New when tracing is enabled.
+	TracerProvider trace.TracerProvider
+}
+
+// Subscriber receives messages from a subscription and dispatches them to a handler. It is a
+// foundation.SupervisedProcessor, so it is restarted with backoff when receiving fails.
+type Subscriber struct {
+	client *gcpubsub.Client
+	conf   SubscriberConfig
+	logger foundation.Logger
+	tracer trace.Tracer
+
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	done     chan error
+	finished chan struct{}
+}
+
+func NewSubscriber(client *gcpubsub.Client, conf SubscriberConfig, logger foundation.Logger) *Subscriber {
+	if conf.Name == "" {
+		conf.Name = "pubsub:" + conf.Subscription
+	}
+	if conf.MaxConcurrency == 0 {
+		conf.MaxConcurrency = 10
+	}
+	if conf.HandlerTimeout == 0 {
+		conf.HandlerTimeout = time.Minute
+	}
+	if conf.DrainTimeout == 0 {
+		conf.DrainTimeout = 30 * time.Second
+	}
+	if conf.TracerProvider == nil {
+		conf.TracerProvider = otel.GetTracerProvider()
+	}
+	s := &Subscriber{
+		client: client,
+		conf:   conf,
+		logger: logger.With(zap.String("subscription", conf.Subscription)),
+		tracer: conf.TracerProvider.Tracer(foundation.InstrumentationName),
+	}
+	return s
+}
+
+func (s *Subscriber) Name() string {
+	return s.conf.Name
+}
+
+func (s *Subscriber) DependsOn() []string {
+	return s.conf.DependsOn
+}
+
+// Start begins receiving in the background.
+func (s *Subscriber) Start(ctx context.Context) error {
+	sub := s.client.Subscription(s.conf.Subscription)
+	sub.ReceiveSettings.MaxOutstandingMessages = s.conf.MaxConcurrency
+	sub.ReceiveSettings.NumGoroutines = 1
+
+	// Receive is stopped by Stop rather than by ctx, so shutdown drains in the order processors are stopped
+	receiveCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan error, 1)
+	finished := make(chan struct{})
+
+	s.mu.Lock()
+	s.cancel, s.done, s.finished = cancel, done, finished
+	s.mu.Unlock()
+
+	// each run gets its own dead-letter topic, stopped once Receive has returned and no handler can publish to it
+	var deadLetter *gcpubsub.Topic
+	if s.conf.DeadLetterTopic != "" {
+		deadLetter = s.client.Topic(s.conf.DeadLetterTopic)
+	}
+
+	s.logger.Info("pubsub subscriber starting", zap.Int("maxConcurrency", s.conf.MaxConcurrency))
+	go func() {
+		defer close(finished)
+		err := sub.Receive(receiveCtx, func(ctx context.Context, msg *gcpubsub.Message) {
+			s.receive(ctx, msg, deadLetter)
+		})
+		if deadLetter != nil {
+			// flushes the dead letters still being published
+			deadLetter.Stop()
+		}
+		if err != nil && receiveCtx.Err() == nil {
+			done <- fmt.Errorf("[pubsub] %s: %w", s.conf.Subscription, err)
+		}
+	}()
+	return nil
+}
+
+func (s *Subscriber) Done() <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// Stop stops receiving and waits up to DrainTimeout for the messages being handled. Their contexts are not
+// cancelled, so they finish normally and are acked.
+func (s *Subscriber) Stop(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	s.mu.Lock()
+	cancel, finished := s.cancel, s.finished
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-finished:
+		s.logger.Info("pubsub subscriber drained")
+		return nil
+	case <-time.After(s.conf.DrainTimeout):
+		return fmt.Errorf("[pubsub] %s: messages still in flight after %s", s.conf.Subscription, s.conf.DrainTimeout)
+	}
+}
+
+func (s *Subscriber) receive(ctx context.Context, msg *gcpubsub.Message, deadLetter *gcpubsub.Topic) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.conf.HandlerTimeout)
+	defer cancel()
+
+	requestID := msg.Attributes[RequestIDAttribute]
+	if requestID == "" {
+		requestID = msg.ID
+	}
+	ctx = foundation.Propagator.Extract(ctx, propagation.MapCarrier(msg.Attributes))
+	ctx, span := s.tracer.Start(ctx, s.conf.Subscription+" receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String(messagingSystem),
+			semconv.MessagingDestinationName(s.conf.Subscription),
+			semconv.MessagingMessageID(msg.ID),
+			foundation.RequestIDSpanAttribute.String(requestID),
+		),
+	)
+	defer span.End()
+	logger := s.logger.With(zap.String("message_id", msg.ID), zap.String(foundation.RequestIDKey, requestID))
+	ctx = foundation.ContextWithLogger(foundation.ContextWithRequestID(ctx, requestID), logger)
+
+	start := time.Now()
+	err := s.handle(ctx, msg)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "handler")
+	}
+	args := []any{slog.Duration("latency", time.Since(start))}
+	if msg.DeliveryAttempt != nil {
+		args = append(args, slog.Int("deliveryAttempt", *msg.DeliveryAttempt))
+	}
+	switch {
+	case err == nil:
+		logger.Info("pubsub message handled", args...)
+		msg.Ack()
+	case deadLetter != nil && (errors.As(err, new(*foundation.PermanentError)) || s.exhausted(msg)):
+		logger.Error("pubsub message dead-lettered", append(args, slog.Any("error", err))...)
+		if dlErr := s.publishDeadLetter(ctx, deadLetter, msg, err); dlErr != nil {
+			logger.Error("pubsub dead-letter publish failed", zap.Error(dlErr))
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	default:
+		logger.Warn("pubsub message failed", append(args, slog.Any("error", err))...)
+		msg.Nack()
+	}
+}
+
+// handle calls the handler, turning a panic into a permanent error so a poison message cannot crash the service.
+func (s *Subscriber) handle(ctx context.Context, msg *gcpubsub.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = foundation.Permanent(fmt.Errorf("panic: %v", r))
+		}
+	}()
+	return s.conf.Handler(ctx, msg)
+}
+
+func (s *Subscriber) exhausted(msg *gcpubsub.Message) bool {
+	return s.conf.MaxDeliveryAttempts > 0 && msg.DeliveryAttempt != nil && *msg.DeliveryAttempt >= s.conf.MaxDeliveryAttempts
+}
+
+func (s *Subscriber) publishDeadLetter(ctx context.Context, deadLetter *gcpubsub.Topic, msg *gcpubsub.Message, cause error) error {
+	attributes := make(map[string]string, len(msg.Attributes)+3)
+	for key, value := range msg.Attributes {
+		attributes[key] = value
+	}
+	attributes[ErrorAttribute] = cause.Error()
+	attributes[SubscriptionAttribute] = s.conf.Subscription
+	attributes[MessageIDAttribute] = msg.ID
+
+	_, err := deadLetter.Publish(ctx, &gcpubsub.Message{Data: msg.Data, Attributes: attributes}).Get(ctx)
+	if err != nil {
+		return errors.Join(cause, err)
+	}
+	return nil
+}
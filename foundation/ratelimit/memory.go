@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the states in process. Each instance of a service counts on its own, so the effective limit is
+// multiplied by the number of instances. Keys untouched for ExpireAfter are dropped.
+type MemoryStore struct {
+	// ExpireAfter must be longer than the longest Limit.Period counted in the store.
+	// Optional. Default value 1 hour.
+	ExpireAfter time.Duration
+
+	mu        sync.Mutex
+	states    map[string]memoryState
+	lastSweep time.Time
+}
+
+type memoryState struct {
+	State
+	touched time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: map[string]memoryState{}}
+}
+
+func (s *MemoryStore) Apply(_ context.Context, key string, update func(state State, found bool) State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	state, found := s.states[key]
+	s.states[key] = memoryState{State: update(state.State, found), touched: now}
+	return nil
+}
+
+// sweep drops the expired keys, at most once per expiry period so it stays cheap.
+func (s *MemoryStore) sweep(now time.Time) {
+	expireAfter := s.ExpireAfter
+	if expireAfter == 0 {
+		expireAfter = time.Hour
+	}
+	if now.Sub(s.lastSweep) < expireAfter {
+		return
+	}
+	s.lastSweep = now
+	for key, state := range s.states {
+		if now.Sub(state.touched) > expireAfter {
+			delete(s.states, key)
+		}
+	}
+}
+
+// Len returns the number of keys held.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.states)
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultTable is the table PostgresStore uses when none is configured.
+const DefaultTable = "rate_limits"
+
+// PostgresSchema creates DefaultTable.
+const PostgresSchema = `CREATE TABLE IF NOT EXISTS rate_limits (
+	key      text PRIMARY KEY,
+	value    double precision NOT NULL,
+	previous double precision NOT NULL DEFAULT 0,
+	at       timestamptz NOT NULL
+);`
+
+// PostgresStore keeps the states in a table shared by every instance of a service. Each request locks its key's
+// row for the duration of a short transaction.
+type PostgresStore struct {
+	db    *sqlx.DB
+	table string
+}
+
+// NewPostgresStore stores the states in DefaultTable of db.
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return NewPostgresStoreWithTable(db, DefaultTable)
+}
+
+// NewPostgresStoreWithTable stores the states in a custom table with the PostgresSchema columns.
+func NewPostgresStoreWithTable(db *sqlx.DB, table string) *PostgresStore {
+	return &PostgresStore{db: db, table: table}
+}
+
+func (s *PostgresStore) Apply(ctx context.Context, key string, update func(state State, found bool) State) (err error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var state State
+	found := true
+	err = tx.QueryRowxContext(ctx, `SELECT value, previous, at FROM `+s.table+` WHERE key = $1 FOR UPDATE`, key).
+		Scan(&state.Value, &state.Previous, &state.At)
+	if errors.Is(err, sql.ErrNoRows) {
+		found = false
+	} else if err != nil {
+		return fmt.Errorf("reading state: %w", err)
+	}
+
+	// the first requests for a new key can race to insert it, the last one wins and a few requests go uncounted
+	state = update(state, found)
+	_, err = tx.ExecContext(ctx, `INSERT INTO `+s.table+` (key, value, previous, at) VALUES ($1, $2, $3, $4)
+ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, previous = EXCLUDED.previous, at = EXCLUDED.at`,
+		key, state.Value, state.Previous, state.At)
+	if err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteExpired removes the keys last counted before olderThan ago, ex. from a periodic job. olderThan must be
+// longer than the longest Limit.Period counted in the store.
+func (s *PostgresStore) DeleteExpired(ctx context.Context, olderThan time.Duration) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM `+s.table+` WHERE at < $1`, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, fmt.Errorf("[ratelimit] deleting expired keys: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,213 @@
+// Package ratelimit counts requests per key, ex. a client IP or an authenticated subject, and decides whether they
+// are within a Limit. The counts live in a Store: MemoryStore for a single instance, PostgresStore to share them
+// between instances. middleware.RateLimit and the grpcmw rate limit interceptors are built on it.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation/db"
+	"github.com/OptechLabs/monorepo/helpers/config"
+)
+
+// Algorithm decides how requests are counted against a Limit.
+type Algorithm string
+
+const (
+	// TokenBucket allows bursts of up to Limit.Requests, refilled evenly over Limit.Period.
+	TokenBucket Algorithm = "token_bucket"
+
+	// SlidingWindow allows Limit.Requests in any Limit.Period, estimated from the counts of the current and
+	// previous fixed windows.
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// Limit is the number of requests allowed per period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+
+	// Algorithm counts the requests.
+	// Optional. Default value TokenBucket.
+	Algorithm Algorithm
+}
+
+// PerSecond, PerMinute and PerHour return a token bucket Limit of requests per period.
+func PerSecond(requests int) Limit { return Limit{Requests: requests, Period: time.Second} }
+func PerMinute(requests int) Limit { return Limit{Requests: requests, Period: time.Minute} }
+func PerHour(requests int) Limit   { return Limit{Requests: requests, Period: time.Hour} }
+
+// Result is the decision for one request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the limit is fully available again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed, zero when this one was.
+	RetryAfter time.Duration
+}
+
+// State is what a Store keeps per key for the algorithms: the tokens left and the time they were counted for
+// TokenBucket; the counts of the current and previous windows and the current window's start for SlidingWindow.
+type State struct {
+	Value    float64
+	Previous float64
+	At       time.Time
+}
+
+// Store keeps the State of every key. Apply must run update atomically per key.
+type Store interface {
+	Apply(ctx context.Context, key string, update func(state State, found bool) State) error
+}
+
+// ErrInvalidLimit is returned for a Limit without requests or period.
+var ErrInvalidLimit = errors.New("[ratelimit] limit needs requests and a period")
+
+// Limiter applies a Limit to keys, counting them in a Store.
+type Limiter struct {
+	store Store
+	limit Limit
+	now   func() time.Time
+}
+
+// New returns a Limiter for limit counting in store.
+func New(store Store, limit Limit) (*Limiter, error) {
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		return nil, ErrInvalidLimit
+	}
+	if limit.Algorithm == "" {
+		limit.Algorithm = TokenBucket
+	}
+	switch limit.Algorithm {
+	case TokenBucket, SlidingWindow:
+	default:
+		return nil, fmt.Errorf("[ratelimit] unknown algorithm %q", limit.Algorithm)
+	}
+	return &Limiter{store: store, limit: limit, now: time.Now}, nil
+}
+
+// Limit returns the limit applied.
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+// Allow counts a request for key and reports whether it is within the limit.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	now := l.now()
+	var result Result
+	err := l.store.Apply(ctx, key, func(state State, found bool) State {
+		state, result = l.limit.apply(state, found, now)
+		return state
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("[ratelimit] %s: %w", key, err)
+	}
+	return result, nil
+}
+
+func (l Limit) apply(state State, found bool, now time.Time) (State, Result) {
+	if l.Algorithm == SlidingWindow {
+		return l.slidingWindow(state, found, now)
+	}
+	return l.tokenBucket(state, found, now)
+}
+
+func (l Limit) tokenBucket(state State, found bool, now time.Time) (State, Result) {
+	capacity := float64(l.Requests)
+	perSecond := capacity / l.Period.Seconds()
+	tokens := capacity
+	if found {
+		elapsed := max(now.Sub(state.At).Seconds(), 0)
+		tokens = min(capacity, state.Value+elapsed*perSecond)
+	}
+
+	result := Result{Limit: l.Requests}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / perSecond)
+	}
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = seconds((capacity - tokens) / perSecond)
+	return State{Value: tokens, At: now}, result
+}
+
+func (l Limit) slidingWindow(state State, found bool, now time.Time) (State, Result) {
+	start := now.Truncate(l.Period)
+	var previous, current float64
+	switch {
+	case !found:
+	case state.At.Equal(start):
+		previous, current = state.Previous, state.Value
+	case state.At.Equal(start.Add(-l.Period)):
+		previous = state.Value
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - elapsed.Seconds()/l.Period.Seconds()
+	limit := float64(l.Requests)
+	result := Result{Limit: l.Requests, Reset: start.Add(l.Period).Sub(now)}
+	if previous*weight+current+1 <= limit {
+		current++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.slidingWindowRetry(previous, current, elapsed)
+	}
+	result.Remaining = max(int(math.Floor(limit-previous*weight-current)), 0)
+	return State{Value: current, Previous: previous, At: start}, result
+}
+
+// slidingWindowRetry is the time until the estimate leaves room for one more request: while the previous window's
+// weight decreases if the current window has room, or some way into the next window otherwise.
+func (l Limit) slidingWindowRetry(previous, current float64, elapsed time.Duration) time.Duration {
+	room := float64(l.Requests) - 1
+	period := l.Period.Seconds()
+	if current <= room && previous > 0 {
+		return seconds(period*(1-(room-current)/previous) - elapsed.Seconds())
+	}
+	untilNext := period - elapsed.Seconds()
+	return seconds(untilNext + period*(1-room/current))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(max(s, 0) * float64(time.Second))
+}
+
+// Store names accepted by config.RateLimitConfig.Store.
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+// FromConfig returns the Limiter described by conf, or nil when conf has no requests. The postgres store uses the
+// pool named conf.DB in dbs, whose database needs the PostgresSchema table.
+func FromConfig(conf config.RateLimitConfig, dbs db.Getter) (*Limiter, error) {
+	if conf.Requests == 0 {
+		return nil, nil
+	}
+	limit := Limit{
+		Requests:  conf.Requests,
+		Period:    time.Duration(conf.Period) * time.Second,
+		Algorithm: Algorithm(conf.Algorithm),
+	}
+	var store Store
+	switch conf.Store {
+	case "", StoreMemory:
+		store = NewMemoryStore()
+	case StorePostgres:
+		pool, err := db.Lookup(dbs, conf.DB)
+		if err != nil {
+			return nil, fmt.Errorf("[ratelimit] postgres store: %w", err)
+		}
+		store = NewPostgresStore(pool)
+	default:
+		return nil, fmt.Errorf("[ratelimit] unknown store %q", conf.Store)
+	}
+	return New(store, limit)
+}
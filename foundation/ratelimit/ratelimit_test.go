@@ -0,0 +1,191 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// step is a request made at offset from the start of a period.
+type step struct {
+	at            time.Duration
+	wantAllowed   bool
+	wantRemaining int
+	wantRetry     time.Duration
+}
+
+func Test_Limiter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		limit Limit
+		steps []step
+	}{
+		{
+			name:  "token bucket bursts then refills",
+			limit: Limit{Requests: 3, Period: 3 * time.Second},
+			steps: []step{
+				{at: 0, wantAllowed: true, wantRemaining: 2},
+				{at: 0, wantAllowed: true, wantRemaining: 1},
+				{at: 0, wantAllowed: true, wantRemaining: 0},
+				{at: 0, wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+				{at: 500 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantRetry: 500 * time.Millisecond},
+				{at: time.Second, wantAllowed: true, wantRemaining: 0},
+				{at: 10 * time.Second, wantAllowed: true, wantRemaining: 2},
+			},
+		},
+		{
+			name:  "sliding window weighs the previous window",
+			limit: Limit{Requests: 2, Period: 10 * time.Second, Algorithm: SlidingWindow},
+			steps: []step{
+				{at: 0, wantAllowed: true, wantRemaining: 1},
+				{at: time.Second, wantAllowed: true, wantRemaining: 0},
+				{at: 2 * time.Second, wantAllowed: false, wantRemaining: 0, wantRetry: 13 * time.Second},
+				// the previous window's 2 requests weigh 1.5 a quarter into the next one
+				{at: 12500 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantRetry: 2500 * time.Millisecond},
+				{at: 15 * time.Second, wantAllowed: true, wantRemaining: 0},
+				{at: 30 * time.Second, wantAllowed: true, wantRemaining: 1},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			limiter, err := New(NewMemoryStore(), tc.limit)
+			require.NoError(t, err)
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			for i, s := range tc.steps {
+				limiter.now = func() time.Time { return start.Add(s.at) }
+				result, err := limiter.Allow(context.Background(), "ip:10.0.0.1")
+				require.NoError(t, err)
+				assert.Equal(t, s.wantAllowed, result.Allowed, "step %d", i)
+				assert.Equal(t, s.wantRemaining, result.Remaining, "step %d", i)
+				assert.Equal(t, tc.limit.Requests, result.Limit, "step %d", i)
+				assert.InDelta(t, s.wantRetry, result.RetryAfter, float64(time.Millisecond), "step %d", i)
+			}
+		})
+	}
+}
+
+func Test_LimiterKeysAreIndependent(t *testing.T) {
+	t.Parallel()
+
+	limiter, err := New(NewMemoryStore(), PerMinute(1))
+	require.NoError(t, err)
+	for _, key := range []string{"ip:10.0.0.1", "ip:10.0.0.2"} {
+		result, err := limiter.Allow(context.Background(), key)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed, key)
+	}
+	result, err := limiter.Allow(context.Background(), "ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+}
+
+func Test_New(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(NewMemoryStore(), Limit{Requests: 1})
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+	_, err = New(NewMemoryStore(), Limit{Requests: 1, Period: time.Second, Algorithm: "leaky_bucket"})
+	assert.EqualError(t, err, `[ratelimit] unknown algorithm "leaky_bucket"`)
+}
+
+func Test_MemoryStoreExpires(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryStore()
+	store.ExpireAfter = time.Millisecond
+	limiter, err := New(store, PerSecond(1))
+	require.NoError(t, err)
+	_, err = limiter.Allow(context.Background(), "ip:10.0.0.1")
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = limiter.Allow(context.Background(), "ip:10.0.0.2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+}
+
+func Test_PostgresStore(t *testing.T) {
+	t.Parallel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	selectState := regexp.QuoteMeta(`SELECT value, previous, at FROM rate_limits WHERE key = $1 FOR UPDATE`)
+	upsertState := regexp.QuoteMeta(`INSERT INTO rate_limits (key, value, previous, at) VALUES ($1, $2, $3, $4)`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectState).WithArgs("sub:user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "previous", "at"}))
+	mock.ExpectExec(upsertState).WithArgs("sub:user-1", 1.0, 0.0, now).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectState).WithArgs("sub:user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"value", "previous", "at"}).AddRow(0.5, 0.0, now.Add(-time.Second)))
+	mock.ExpectExec(upsertState).WithArgs("sub:user-1", 0.0, 0.0, now).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectState).WithArgs("sub:user-1").WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	limiter, err := New(NewPostgresStore(sqlx.NewDb(conn, "sqlmock")), Limit{Requests: 2, Period: 4 * time.Second})
+	require.NoError(t, err)
+	limiter.now = func() time.Time { return now }
+
+	result, err := limiter.Allow(context.Background(), "sub:user-1")
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// half a token left a second ago refills to one, used by this request
+	result, err = limiter.Allow(context.Background(), "sub:user-1")
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	_, err = limiter.Allow(context.Background(), "sub:user-1")
+	assert.EqualError(t, err, "[ratelimit] sub:user-1: reading state: connection reset")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type pools map[string]*sqlx.DB
+
+func (p pools) Get(name string) (*sqlx.DB, bool) {
+	db, ok := p[name]
+	return db, ok
+}
+
+func Test_FromConfig(t *testing.T) {
+	t.Parallel()
+
+	limiter, err := FromConfig(config.RateLimitConfig{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, limiter, "no requests disables rate limiting")
+
+	limiter, err = FromConfig(config.RateLimitConfig{Requests: 100, Period: 60, Algorithm: "sliding_window"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 100, Period: time.Minute, Algorithm: SlidingWindow}, limiter.Limit())
+	assert.IsType(t, &MemoryStore{}, limiter.store)
+
+	conf := config.RateLimitConfig{Requests: 100, Period: 60, Store: StorePostgres, DB: "main"}
+	_, err = FromConfig(conf, pools{})
+	assert.EqualError(t, err, `[ratelimit] postgres store: [db] pool "main" is not configured`)
+	limiter, err = FromConfig(conf, pools{"main": &sqlx.DB{}})
+	require.NoError(t, err)
+	assert.IsType(t, &PostgresStore{}, limiter.store)
+}
@@ -0,0 +1,374 @@
+package foundation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// supervisor owns the processors attached to a Foundation. It starts them in dependency order, restarts them with
+// exponential backoff when they crash or fail to start, and stops them in reverse order.
+type supervisor struct {
+	logger         Logger
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	maxRestarts    int
+	disableRestart bool
+
+	mu       sync.Mutex
+	entries  []*processorEntry
+	order    []*processorEntry
+	changed  chan struct{}
+	cancel   context.CancelFunc
+	stopping bool
+	wg       sync.WaitGroup
+}
+
+type processorEntry struct {
+	name      string
+	dependsOn []string
+	processor Processor
+	state     ProcessorState
+	started   bool
+	restarts  int
+	lastErr   error
+	done      <-chan error
+}
+
+func (e *processorEntry) status() ProcessorStatus {
+	return ProcessorStatus{
+		Name:      e.name,
+		State:     e.state,
+		DependsOn: append([]string(nil), e.dependsOn...),
+		Restarts:  e.restarts,
+		LastError: e.lastErr,
+	}
+}
+
+func newSupervisor(logger Logger, opts Options) *supervisor {
+	return &supervisor{
+		logger:         logger,
+		backoff:        opts.ProcessorRestartBackoff,
+		maxBackoff:     opts.ProcessorRestartMaxBackoff,
+		maxRestarts:    opts.ProcessorMaxRestarts,
+		disableRestart: opts.DisableProcessorRestarts,
+		changed:        make(chan struct{}),
+	}
+}
+
+func (s *supervisor) add(name string, p Processor, dependsOn []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		name = fmt.Sprintf("processor-%d", len(s.entries)+1)
+	}
+	s.entries = append(s.entries, &processorEntry{
+		name:      name,
+		dependsOn: dependsOn,
+		processor: p,
+		state:     ProcessorPending,
+	})
+	return name
+}
+
+func (s *supervisor) statuses() []ProcessorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.order
+	if entries == nil {
+		entries = s.entries
+	}
+	statuses := make([]ProcessorStatus, 0, len(entries))
+	for _, e := range entries {
+		statuses = append(statuses, e.status())
+	}
+	return statuses
+}
+
+// sortEntries orders the processors so that every processor comes after its dependencies. Processors without a
+// dependency relationship keep their registration order.
+func sortEntries(entries []*processorEntry) ([]*processorEntry, error) {
+	byName := make(map[string]*processorEntry, len(entries))
+	for _, e := range entries {
+		if _, exists := byName[e.name]; exists {
+			return nil, fmt.Errorf("[foundation] processor %q registered more than once", e.name)
+		}
+		byName[e.name] = e
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[string]int, len(entries))
+	order := make([]*processorEntry, 0, len(entries))
+
+	var visit func(e *processorEntry, path []string) error
+	visit = func(e *processorEntry, path []string) error {
+		switch marks[e.name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("[foundation] processor dependency cycle: %v", append(path, e.name))
+		}
+		marks[e.name] = visiting
+		for _, depName := range e.dependsOn {
+			dep, ok := byName[depName]
+			if !ok {
+				return fmt.Errorf("[foundation] processor %q depends on unknown processor %q", e.name, depName)
+			}
+			if err := visit(dep, append(path, e.name)); err != nil {
+				return err
+			}
+		}
+		marks[e.name] = visited
+		order = append(order, e)
+		return nil
+	}
+
+	for _, e := range entries {
+		if err := visit(e, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func (s *supervisor) start(ctx context.Context) (errs []error) {
+	s.mu.Lock()
+	order, err := sortEntries(s.entries)
+	if err != nil {
+		s.mu.Unlock()
+		s.logger.Error("unable to order processors", zap.Error(err))
+		return []error{err}
+	}
+	s.order = order
+	superviseCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	for _, e := range order {
+		if dep := s.unavailableDependency(e); dep != "" {
+			err := fmt.Errorf("[foundation] processor %q not started: dependency %q is not running", e.name, dep)
+			s.logger.Error("unable to start processor", zap.String("processor", e.name), zap.Error(err))
+			s.setState(e, ProcessorRestarting, err)
+			errs = append(errs, err)
+		} else if err := s.startEntry(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+		s.wg.Add(1)
+		go s.supervise(ctx, superviseCtx, e)
+	}
+	return errs
+}
+
+// supervise watches a single processor, restarting it when it crashes or failed to start, until superviseCtx is
+// cancelled, the restart budget is exhausted or it fails with a PermanentError.
+func (s *supervisor) supervise(ctx, superviseCtx context.Context, e *processorEntry) {
+	defer s.wg.Done()
+	delay := s.backoff
+	for {
+		s.mu.Lock()
+		state, done := e.state, e.done
+		s.mu.Unlock()
+
+		if state == ProcessorRunning {
+			startedAt := time.Now()
+			select {
+			case <-superviseCtx.Done():
+				return
+			case err := <-done:
+				if err == nil {
+					err = errors.New("processor exited")
+				}
+				s.crashed(e, err)
+			}
+			if time.Since(startedAt) > s.maxBackoff {
+				delay = s.backoff
+			}
+		}
+
+		s.mu.Lock()
+		restarts := e.restarts
+		var permanent *PermanentError
+		exhausted := s.disableRestart || (s.maxRestarts > 0 && restarts >= s.maxRestarts) || errors.As(e.lastErr, &permanent)
+		if exhausted {
+			e.state = ProcessorFailed
+			s.notifyLocked()
+		}
+		s.mu.Unlock()
+		if exhausted {
+			s.logger.Error("processor will not be restarted", zap.String("processor", e.name), zap.Int("restarts", restarts))
+			return
+		}
+
+		select {
+		case <-superviseCtx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > s.maxBackoff {
+			delay = s.maxBackoff
+		}
+
+		if !s.waitForDependencies(superviseCtx, e) {
+			return
+		}
+		s.mu.Lock()
+		if s.stopping {
+			s.mu.Unlock()
+			return
+		}
+		e.restarts++
+		restarts = e.restarts
+		s.mu.Unlock()
+		s.logger.Info("restarting processor", zap.String("processor", e.name), zap.Int("restarts", restarts))
+		_ = s.startEntry(ctx, e)
+	}
+}
+
+func (s *supervisor) startEntry(ctx context.Context, e *processorEntry) error {
+	s.setState(e, ProcessorStarting, nil)
+	if err := safeStart(ctx, e.processor); err != nil {
+		err = fmt.Errorf("[foundation] processor %q failed to start: %w", e.name, err)
+		s.logger.Error("unable to start processor", zap.String("processor", e.name), zap.Error(err))
+		s.setState(e, ProcessorRestarting, err)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.started = true
+	e.done = nil
+	if supervised, ok := e.processor.(SupervisedProcessor); ok {
+		e.done = supervised.Done()
+	}
+	e.state = ProcessorRunning
+	s.notifyLocked()
+	return nil
+}
+
+func (s *supervisor) crashed(e *processorEntry, err error) {
+	err = fmt.Errorf("[foundation] processor %q crashed: %w", e.name, err)
+	s.logger.Error("processor crashed", zap.String("processor", e.name), zap.Error(err))
+	if stopErr := stopAndWait(e.processor); stopErr != nil {
+		s.logger.Warn("unable to stop crashed processor", zap.String("processor", e.name), zap.Error(stopErr))
+	}
+	s.mu.Lock()
+	e.started = false
+	s.mu.Unlock()
+	s.setState(e, ProcessorRestarting, err)
+}
+
+func (s *supervisor) stop() (errs []error) {
+	s.mu.Lock()
+	s.stopping = true
+	cancel := s.cancel
+	order := s.order
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+
+	for i := len(order) - 1; i >= 0; i-- {
+		e := order[i]
+		s.mu.Lock()
+		started := e.started
+		s.mu.Unlock()
+		if !started {
+			s.setState(e, ProcessorStopped, nil)
+			continue
+		}
+
+		s.setState(e, ProcessorStopping, nil)
+		if err := stopAndWait(e.processor); err != nil {
+			err = fmt.Errorf("[foundation] processor %q failed to stop: %w", e.name, err)
+			s.logger.Error("unable to stop processor", zap.String("processor", e.name), zap.Error(err))
+			errs = append(errs, err)
+		}
+		s.mu.Lock()
+		e.started = false
+		s.mu.Unlock()
+		s.setState(e, ProcessorStopped, nil)
+	}
+	return errs
+}
+
+// unavailableDependency returns the name of the first dependency of e that is not running.
+func (s *supervisor) unavailableDependency(e *processorEntry) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unavailableDependencyLocked(e)
+}
+
+func (s *supervisor) unavailableDependencyLocked(e *processorEntry) string {
+	for _, depName := range e.dependsOn {
+		for _, dep := range s.order {
+			if dep.name == depName && dep.state != ProcessorRunning {
+				return depName
+			}
+		}
+	}
+	return ""
+}
+
+func (s *supervisor) waitForDependencies(ctx context.Context, e *processorEntry) bool {
+	for {
+		s.mu.Lock()
+		missing := s.unavailableDependencyLocked(e)
+		changed := s.changed
+		s.mu.Unlock()
+		if missing == "" {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// setState records a state transition. A nil err keeps the last error so it stays visible while restarting.
+func (s *supervisor) setState(e *processorEntry, state ProcessorState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.state = state
+	if err != nil {
+		e.lastErr = err
+	}
+	s.notifyLocked()
+}
+
+// notifyLocked wakes every goroutine waiting on a state change. s.mu must be held.
+func (s *supervisor) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func safeStart(ctx context.Context, p Processor) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return p.Start(ctx)
+}
+
+// stopAndWait stops p and waits for it to call wg.Done(). A Stop that returns an error is not waited on.
+func stopAndWait(p Processor) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	if err := p.Stop(&wg); err != nil {
+		return err
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,52 @@
+package tenancy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresSchema creates the tenants table PostgresRegistry reads. Schema and db route the tenant's queries, see
+// db.TenantTransaction.
+const PostgresSchema = `CREATE TABLE IF NOT EXISTS tenants (
+	id        text PRIMARY KEY,
+	subdomain text NOT NULL UNIQUE,
+	name      text NOT NULL DEFAULT '',
+	schema    text NOT NULL DEFAULT '',
+	db        text NOT NULL DEFAULT ''
+);`
+
+// PostgresRegistry looks the tenants up in the tenants table of db, one query per lookup, so wrap it in a
+// CachedRegistry.
+type PostgresRegistry struct {
+	db *sqlx.DB
+}
+
+func NewPostgresRegistry(db *sqlx.DB) *PostgresRegistry {
+	return &PostgresRegistry{db: db}
+}
+
+func (r *PostgresRegistry) BySubdomain(ctx context.Context, subdomain string) (*foundation.Tenant, error) {
+	return r.get(ctx, "subdomain", strings.ToLower(subdomain))
+}
+
+func (r *PostgresRegistry) ByID(ctx context.Context, id string) (*foundation.Tenant, error) {
+	return r.get(ctx, "id", id)
+}
+
+func (r *PostgresRegistry) get(ctx context.Context, column, value string) (*foundation.Tenant, error) {
+	var tenant foundation.Tenant
+	err := r.db.GetContext(ctx, &tenant, `SELECT id, subdomain, name, schema, db FROM tenants WHERE `+column+` = $1`, value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownTenant
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[tenancy] reading tenant: %w", err)
+	}
+	return &tenant, nil
+}
@@ -0,0 +1,182 @@
+// Package tenancy resolves the tenant a request is served for: Subdomain extracts its subdomain from the host and a
+// Registry looks the tenant up, from the config with StaticRegistry or from a table with PostgresRegistry.
+// middleware.Tenant and the grpcmw tenant interceptors are built on it.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/db"
+	"github.com/OptechLabs/monorepo/helpers/config"
+)
+
+// ErrUnknownTenant is returned by registries for subdomains and IDs without a tenant.
+var ErrUnknownTenant = errors.New("[tenancy] unknown tenant")
+
+// Registry looks tenants up.
+type Registry interface {
+	BySubdomain(ctx context.Context, subdomain string) (*foundation.Tenant, error)
+	ByID(ctx context.Context, id string) (*foundation.Tenant, error)
+}
+
+// Subdomain returns the part of host before rootDomain, ex. "acme" for "acme.optech.co.uk:8080" and "optech.co.uk".
+// It reports false for hosts outside rootDomain or without a subdomain.
+func Subdomain(host, rootDomain string) (string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	rootDomain = strings.ToLower(strings.TrimSuffix(rootDomain, "."))
+	subdomain, found := strings.CutSuffix(host, "."+rootDomain)
+	if !found || subdomain == "" {
+		return "", false
+	}
+	return subdomain, true
+}
+
+// StaticRegistry holds a fixed set of tenants, ex. from the config.
+type StaticRegistry struct {
+	bySubdomain map[string]*foundation.Tenant
+	byID        map[string]*foundation.Tenant
+}
+
+func NewStaticRegistry(tenants ...foundation.Tenant) *StaticRegistry {
+	r := &StaticRegistry{
+		bySubdomain: make(map[string]*foundation.Tenant, len(tenants)),
+		byID:        make(map[string]*foundation.Tenant, len(tenants)),
+	}
+	for i := range tenants {
+		tenant := &tenants[i]
+		r.bySubdomain[strings.ToLower(tenant.Subdomain)] = tenant
+		r.byID[tenant.ID] = tenant
+	}
+	return r
+}
+
+func (r *StaticRegistry) BySubdomain(_ context.Context, subdomain string) (*foundation.Tenant, error) {
+	if tenant, ok := r.bySubdomain[strings.ToLower(subdomain)]; ok {
+		return tenant, nil
+	}
+	return nil, ErrUnknownTenant
+}
+
+func (r *StaticRegistry) ByID(_ context.Context, id string) (*foundation.Tenant, error) {
+	if tenant, ok := r.byID[id]; ok {
+		return tenant, nil
+	}
+	return nil, ErrUnknownTenant
+}
+
+// CachedRegistry caches the lookups of a slower Registry, including unknown tenants, for ttl.
+type CachedRegistry struct {
+	registry Registry
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	lastSweep time.Time
+}
+
+type cacheEntry struct {
+	tenant    *foundation.Tenant
+	err       error
+	expiresAt time.Time
+}
+
+func NewCachedRegistry(registry Registry, ttl time.Duration) *CachedRegistry {
+	return &CachedRegistry{registry: registry, ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+func (r *CachedRegistry) BySubdomain(ctx context.Context, subdomain string) (*foundation.Tenant, error) {
+	return r.lookup("subdomain:"+strings.ToLower(subdomain), func() (*foundation.Tenant, error) {
+		return r.registry.BySubdomain(ctx, subdomain)
+	})
+}
+
+func (r *CachedRegistry) ByID(ctx context.Context, id string) (*foundation.Tenant, error) {
+	return r.lookup("id:"+id, func() (*foundation.Tenant, error) {
+		return r.registry.ByID(ctx, id)
+	})
+}
+
+func (r *CachedRegistry) lookup(key string, load func() (*foundation.Tenant, error)) (*foundation.Tenant, error) {
+	now := time.Now()
+	r.mu.Lock()
+	entry, found := r.entries[key]
+	r.mu.Unlock()
+	if found && now.Before(entry.expiresAt) {
+		return entry.tenant, entry.err
+	}
+
+	tenant, err := load()
+	if err != nil && !errors.Is(err, ErrUnknownTenant) {
+		// failures are retried on the next request
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweep(now)
+	r.entries[key] = cacheEntry{tenant: tenant, err: err, expiresAt: now.Add(r.ttl)}
+	return tenant, err
+}
+
+// sweep drops the expired entries, at most once per ttl, so lookups of random subdomains do not pile up.
+func (r *CachedRegistry) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.ttl {
+		return
+	}
+	r.lastSweep = now
+	for key, entry := range r.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(r.entries, key)
+		}
+	}
+}
+
+// Registry names accepted by config.TenancyConfig.Registry.
+const (
+	RegistryStatic   = "static"
+	RegistryPostgres = "postgres"
+)
+
+// DefaultCacheTTL is how long tenants looked up in the database are cached when the config does not say.
+const DefaultCacheTTL = time.Minute
+
+// FromConfig returns the Registry named by conf.Registry, nil when it is empty. Tenants read from the conf.DB pool
+// are cached for conf.CacheTTL seconds.
+func FromConfig(conf config.TenancyConfig, dbs db.Getter) (Registry, error) {
+	switch conf.Registry {
+	case "":
+		return nil, nil
+	case RegistryStatic:
+		tenants := make([]foundation.Tenant, 0, len(conf.Tenants))
+		for id, tenant := range conf.Tenants {
+			tenants = append(tenants, foundation.Tenant{
+				ID:        id,
+				Subdomain: tenant.Subdomain,
+				Name:      tenant.Name,
+				Schema:    tenant.Schema,
+				DB:        tenant.DB,
+			})
+		}
+		return NewStaticRegistry(tenants...), nil
+	case RegistryPostgres:
+		pool, err := db.Lookup(dbs, conf.DB)
+		if err != nil {
+			return nil, fmt.Errorf("[tenancy] postgres registry: %w", err)
+		}
+		ttl := time.Duration(conf.CacheTTL) * time.Second
+		if ttl == 0 {
+			ttl = DefaultCacheTTL
+		}
+		return NewCachedRegistry(NewPostgresRegistry(pool), ttl), nil
+	}
+	return nil, fmt.Errorf("[tenancy] unknown registry %q", conf.Registry)
+}
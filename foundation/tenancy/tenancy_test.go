@@ -0,0 +1,152 @@
+package tenancy_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/tenancy"
+	"github.com/OptechLabs/monorepo/helpers/config"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Subdomain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		givenHost     string
+		givenRoot     string
+		wantSubdomain string
+		wantOK        bool
+	}{
+		{name: "subdomain", givenHost: "wu.otosapp.com", givenRoot: "otosapp.com", wantSubdomain: "wu", wantOK: true},
+		{name: "port", givenHost: "wu.otosapp.com:8080", givenRoot: "otosapp.com", wantSubdomain: "wu", wantOK: true},
+		{name: "multi-level root domain", givenHost: "wu.otosapp.co.uk", givenRoot: "otosapp.co.uk", wantSubdomain: "wu", wantOK: true},
+		{name: "nested subdomain", givenHost: "eu.wu.otosapp.com", givenRoot: "otosapp.com", wantSubdomain: "eu.wu", wantOK: true},
+		{name: "case and trailing dot", givenHost: "WU.OtosApp.com.", givenRoot: "otosapp.com", wantSubdomain: "wu", wantOK: true},
+		{name: "root domain", givenHost: "otosapp.com", givenRoot: "otosapp.com"},
+		{name: "other domain", givenHost: "wu.evil.com", givenRoot: "otosapp.com"},
+		{name: "suffix of another domain", givenHost: "wu.notosapp.com", givenRoot: "otosapp.com"},
+		{name: "localhost", givenHost: "localhost:8080", givenRoot: "otosapp.com"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			subdomain, ok := tenancy.Subdomain(tc.givenHost, tc.givenRoot)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.wantSubdomain, subdomain)
+		})
+	}
+}
+
+func Test_StaticRegistry(t *testing.T) {
+	t.Parallel()
+
+	registry := tenancy.NewStaticRegistry(foundation.Tenant{ID: "t-1", Subdomain: "Wu", Name: "Wu-Tang"})
+	tenant, err := registry.BySubdomain(context.Background(), "wu")
+	require.NoError(t, err)
+	assert.Equal(t, "t-1", tenant.ID)
+	tenant, err = registry.ByID(context.Background(), "t-1")
+	require.NoError(t, err)
+	assert.Equal(t, "Wu-Tang", tenant.Name)
+	_, err = registry.BySubdomain(context.Background(), "gza")
+	assert.ErrorIs(t, err, tenancy.ErrUnknownTenant)
+}
+
+// countingRegistry counts the lookups that reach it.
+type countingRegistry struct {
+	tenancy.Registry
+	calls int
+	err   error
+}
+
+func (r *countingRegistry) BySubdomain(ctx context.Context, subdomain string) (*foundation.Tenant, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.Registry.BySubdomain(ctx, subdomain)
+}
+
+func Test_CachedRegistry(t *testing.T) {
+	t.Parallel()
+
+	counting := &countingRegistry{Registry: tenancy.NewStaticRegistry(foundation.Tenant{ID: "t-1", Subdomain: "wu"})}
+	registry := tenancy.NewCachedRegistry(counting, time.Minute)
+	for i := 0; i < 3; i++ {
+		tenant, err := registry.BySubdomain(context.Background(), "wu")
+		require.NoError(t, err)
+		assert.Equal(t, "t-1", tenant.ID)
+		_, err = registry.BySubdomain(context.Background(), "gza")
+		assert.ErrorIs(t, err, tenancy.ErrUnknownTenant)
+	}
+	assert.Equal(t, 2, counting.calls, "hits and unknown tenants are cached")
+
+	counting.err = errors.New("connection reset")
+	for i := 0; i < 2; i++ {
+		_, err := registry.BySubdomain(context.Background(), "rza")
+		assert.EqualError(t, err, "connection reset")
+	}
+	assert.Equal(t, 4, counting.calls, "failures are not cached")
+}
+
+func Test_PostgresRegistry(t *testing.T) {
+	t.Parallel()
+
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	columns := []string{"id", "subdomain", "name", "schema", "db"}
+	query := regexp.QuoteMeta(`SELECT id, subdomain, name, schema, db FROM tenants WHERE subdomain = $1`)
+	mock.ExpectQuery(query).WithArgs("wu").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("t-1", "wu", "Wu-Tang", "tenant_wu", ""))
+	mock.ExpectQuery(query).WithArgs("gza").WillReturnRows(sqlmock.NewRows(columns))
+
+	registry := tenancy.NewPostgresRegistry(sqlx.NewDb(conn, "sqlmock"))
+	tenant, err := registry.BySubdomain(context.Background(), "WU")
+	require.NoError(t, err)
+	assert.Equal(t, &foundation.Tenant{ID: "t-1", Subdomain: "wu", Name: "Wu-Tang", Schema: "tenant_wu"}, tenant)
+	_, err = registry.BySubdomain(context.Background(), "gza")
+	assert.ErrorIs(t, err, tenancy.ErrUnknownTenant)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type pools map[string]*sqlx.DB
+
+func (p pools) Get(name string) (*sqlx.DB, bool) {
+	db, ok := p[name]
+	return db, ok
+}
+
+func Test_FromConfig(t *testing.T) {
+	t.Parallel()
+
+	registry, err := tenancy.FromConfig(config.TenancyConfig{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, registry)
+
+	registry, err = tenancy.FromConfig(config.TenancyConfig{
+		Registry: tenancy.RegistryStatic,
+		Tenants:  map[string]config.TenantConfig{"t-1": {Subdomain: "wu", Name: "Wu-Tang", DB: "wu"}},
+	}, nil)
+	require.NoError(t, err)
+	tenant, err := registry.BySubdomain(context.Background(), "wu")
+	require.NoError(t, err)
+	assert.Equal(t, &foundation.Tenant{ID: "t-1", Subdomain: "wu", Name: "Wu-Tang", DB: "wu"}, tenant)
+
+	_, err = tenancy.FromConfig(config.TenancyConfig{Registry: tenancy.RegistryPostgres, DB: "main"}, pools{})
+	assert.EqualError(t, err, `[tenancy] postgres registry: [db] pool "main" is not configured`)
+	registry, err = tenancy.FromConfig(config.TenancyConfig{Registry: tenancy.RegistryPostgres, DB: "main"}, pools{"main": &sqlx.DB{}})
+	require.NoError(t, err)
+	assert.IsType(t, &tenancy.CachedRegistry{}, registry)
+}
@@ -0,0 +1,49 @@
+package foundation
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TenantMetadataKey carries the tenant ID of a request to the services it calls.
+const TenantMetadataKey = "x-tenant-id"
+
+// Tenant is the customer a request is served for, resolved from its subdomain by the Tenant middleware.
+type Tenant struct {
+	ID        string `json:"id" db:"id"`
+	Subdomain string `json:"subdomain" db:"subdomain"`
+	Name      string `json:"name" db:"name"`
+	// Schema is the Postgres schema holding the tenant's tables, empty for tables shared by every tenant.
+	Schema string `json:"schema,omitempty" db:"schema"`
+	// DB is the config.Config.DBConfigs use of the tenant's database, empty for the default one.
+	DB string `json:"db,omitempty" db:"db"`
+}
+
+func unaryClientTenant() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingTenant(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+func streamClientTenant() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingTenant(ctx), desc, cc, method, opts...)
+	}
+}
+
+// outgoingTenant forwards the tenant of the current request, like outgoingRequestID.
+func outgoingTenant(ctx context.Context) context.Context {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		tenant, ok = ctx.Value(TenantKey).(*Tenant)
+	}
+	if !ok || tenant.ID == "" {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(TenantMetadataKey)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, TenantMetadataKey, tenant.ID)
+}
@@ -40,6 +40,11 @@ func bufDialer(ctx context.Context, address string) (net.Conn, error) {
 	return lis.Dial()
 }
 
+// BufDialOption connects a client to the test server, ex. in foundation.GRPCClientOptions.DialOptions.
+func BufDialOption() grpc.DialOption {
+	return grpc.WithContextDialer(bufDialer)
+}
+
 func GetTestConnection() (*grpc.ClientConn, error) {
 	ctx := context.Background()
 	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(bufDialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
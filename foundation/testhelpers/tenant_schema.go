@@ -0,0 +1,56 @@
+package testhelpers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateTenantSchema creates a throwaway Postgres schema, named "tenant_test_<random>", runs ddl in it, ex. the
+// tenant tables, and drops it with everything in it when the test ends. The schema goes in foundation.Tenant.Schema
+// for db.TenantTransaction to run the test's requests in it; parallel tests each get their own.
+func CreateTenantSchema(t testing.TB, conn *sqlx.DB, ddl ...string) string {
+	t.Helper()
+
+	random := make([]byte, 6)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatalf("generating tenant schema name: %v", err)
+	}
+	schema := "tenant_test_" + hex.EncodeToString(random)
+	quoted := db.QuoteIdentifier(schema)
+
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, "CREATE SCHEMA "+quoted); err != nil {
+		t.Fatalf("creating tenant schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		if _, err := conn.ExecContext(context.Background(), "DROP SCHEMA IF EXISTS "+quoted+" CASCADE"); err != nil {
+			t.Errorf("dropping tenant schema %s: %v", schema, err)
+		}
+	})
+
+	if len(ddl) == 0 {
+		return schema
+	}
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatalf("creating tenant tables in %s: %v", schema, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, "SET LOCAL search_path TO "+quoted+", public"); err != nil {
+		t.Fatalf("creating tenant tables in %s: %v", schema, err)
+	}
+	for _, statement := range ddl {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			t.Fatalf("creating tenant tables in %s: %v", schema, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("creating tenant tables in %s: %v", schema, err)
+	}
+	return schema
+}
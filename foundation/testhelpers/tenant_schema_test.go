@@ -0,0 +1,43 @@
+package testhelpers_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/OptechLabs/monorepo/foundation/testhelpers"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabaseURLEnv names the Postgres database the schema tests run against, they are skipped without it.
+const testDatabaseURLEnv = "TEST_DATABASE_URL"
+
+func Test_CreateTenantSchema(t *testing.T) {
+	t.Parallel()
+
+	url := os.Getenv(testDatabaseURLEnv)
+	if url == "" {
+		t.Skip(testDatabaseURLEnv + " is not set")
+	}
+	conn, err := sqlx.Connect("postgres", url)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var schema string
+	t.Run("create", func(t *testing.T) {
+		schema = testhelpers.CreateTenantSchema(t, conn, "CREATE TABLE orders (id bigint PRIMARY KEY)")
+		assert.Regexp(t, `^tenant_test_[0-9a-f]{12}$`, schema)
+
+		var tables []string
+		require.NoError(t, conn.Select(&tables,
+			"SELECT table_name FROM information_schema.tables WHERE table_schema = $1", schema))
+		assert.Equal(t, []string{"orders"}, tables, "the ddl runs in the schema")
+	})
+
+	var exists bool
+	require.NoError(t, conn.Get(&exists,
+		"SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = $1)", schema))
+	assert.False(t, exists, "the schema is dropped when the test ends")
+}
@@ -0,0 +1,335 @@
+package foundation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Span exporters selectable with TracingOptions.Exporter.
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+// InstrumentationName names the tracer of foundation's instrumentation.
+const InstrumentationName = "github.com/OptechLabs/monorepo/foundation"
+
+// RequestIDSpanAttribute holds the request ID on server and consumer spans.
+const RequestIDSpanAttribute = attribute.Key("request.id")
+
+// Propagator carries trace context as W3C traceparent and baggage headers, in HTTP, gRPC metadata and Pub/Sub
+// attributes alike.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// TracingOptions configures OpenTelemetry tracing. Tracing is off when no exporter is set.
+type TracingOptions struct {
+	// Exporter is one of TracingExporterOTLP or TracingExporterStdout.
+	// Optional.
+	Exporter string
+
+	// Endpoint is the OTLP collector address, ex. "otel-collector:4317".
+	// Optional. Default value from OTEL_EXPORTER_OTLP_ENDPOINT, or "localhost:4317".
+	Endpoint string
+
+	// Insecure sends spans to the OTLP collector without TLS.
+	Insecure bool
+
+	// SampleRatio is the share of new traces recorded, traces started upstream follow the caller's decision.
+	// Optional. Default value 1.
+	SampleRatio float64
+
+	// ServiceName is reported as the service.name resource attribute.
+	// Optional.
+	ServiceName string
+
+	// SpanExporter replaces the exporter selected by Exporter, ex. a tracetest.InMemoryExporter in tests.
+	// Optional.
+	SpanExporter sdktrace.SpanExporter
+
+	// Synchronous exports each span as it ends instead of in batches, so tests can read them right away.
+	Synchronous bool
+}
+
+// Tracing holds the tracer provider built from TracingOptions. Without an exporter it holds a no-op provider, so
+// instrumentation can run unconditionally.
+type Tracing struct {
+	Provider trace.TracerProvider
+	Tracer   trace.Tracer
+
+	sdk *sdktrace.TracerProvider
+}
+
+// NewTracing builds the tracer provider for opts.
+func NewTracing(ctx context.Context, opts TracingOptions) (*Tracing, error) {
+	t := &Tracing{}
+	exporter := opts.SpanExporter
+	if exporter == nil {
+		switch opts.Exporter {
+		case "":
+			t.Provider = noop.NewTracerProvider()
+			t.Tracer = t.Provider.Tracer(InstrumentationName)
+			return t, nil
+		case TracingExporterOTLP:
+			clientOpts := []otlptracegrpc.Option{}
+			if opts.Endpoint != "" {
+				clientOpts = append(clientOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+			}
+			if opts.Insecure {
+				clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+			}
+			var err error
+			if exporter, err = otlptracegrpc.New(ctx, clientOpts...); err != nil {
+				return nil, fmt.Errorf("[foundation] otlp exporter: %w", err)
+			}
+		case TracingExporterStdout:
+			var err error
+			if exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout)); err != nil {
+				return nil, fmt.Errorf("[foundation] stdout exporter: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("[foundation] unknown tracing exporter %q", opts.Exporter)
+		}
+	}
+
+	ratio := opts.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	res := resource.Default()
+	if opts.ServiceName != "" {
+		var err error
+		if res, err = resource.Merge(res, resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(opts.ServiceName))); err != nil {
+			return nil, fmt.Errorf("[foundation] tracing resource: %w", err)
+		}
+	}
+	processor := sdktrace.NewBatchSpanProcessor(exporter)
+	if opts.Synchronous {
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	}
+	t.sdk = sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	t.Provider = t.sdk
+	t.Tracer = t.sdk.Tracer(InstrumentationName)
+	return t, nil
+}
+
+// Enabled reports whether spans are exported.
+func (t *Tracing) Enabled() bool {
+	return t.sdk != nil
+}
+
+// SetGlobal makes the provider and Propagator the otel globals, for libraries that use them.
+func (t *Tracing) SetGlobal() {
+	otel.SetTracerProvider(t.Provider)
+	otel.SetTextMapPropagator(Propagator)
+}
+
+// Shutdown flushes the spans still buffered and stops the exporter.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t.sdk == nil {
+		return nil
+	}
+	return t.sdk.Shutdown(ctx)
+}
+
+// SpanFromContext returns the active span in ctx. Unlike trace.SpanFromContext it also finds the span started by
+// HTTPTracing when ctx is the *gin.Context, which does not expose the request context's values.
+func SpanFromContext(ctx context.Context) trace.Span {
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		return trace.SpanFromContext(c.Request.Context())
+	}
+	return trace.SpanFromContext(ctx)
+}
+
+// ContextWithSpan returns ctx with the span found by SpanFromContext made the parent of spans started from it.
+func ContextWithSpan(ctx context.Context) context.Context {
+	if _, ok := ctx.(*gin.Context); !ok {
+		return ctx
+	}
+	return trace.ContextWithSpan(ctx, SpanFromContext(ctx))
+}
+
+// TraceContextFromContext returns the trace and span of the active span in ctx.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	sc := SpanFromContext(ctx).SpanContext()
+	if !sc.IsValid() {
+		return TraceContext{}, false
+	}
+	return TraceContext{TraceID: sc.TraceID().String(), SpanID: sc.SpanID().String(), Sampled: sc.IsSampled()}, true
+}
+
+// TracerFromContext returns a tracer from the provider of the active span in ctx, so libraries create child spans
+// without a reference to the Tracing, or a no-op tracer when there is no span.
+func TracerFromContext(ctx context.Context) trace.Tracer {
+	return SpanFromContext(ctx).TracerProvider().Tracer(InstrumentationName)
+}
+
+// HTTPTracing returns a gin middleware that continues the caller's trace and wraps the request in a server span
+// named after the matched route. New installs it first on the router when tracing is enabled.
+func HTTPTracing(t *Tracing) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := Propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := t.Tracer.Start(ctx, c.Request.Method+" "+c.Request.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(c.Request.Method),
+				semconv.URLPath(c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if route := c.FullPath(); route != "" {
+			span.SetName(c.Request.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		code := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(code))
+		requestID := RequestIDFrom(c)
+		if requestID == "" {
+			requestID = c.Request.Header.Get("X-Request-ID")
+		}
+		if requestID != "" {
+			span.SetAttributes(RequestIDSpanAttribute.String(requestID))
+		}
+		if code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(code))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+	}
+}
+
+// UnaryServerTracing returns an interceptor that continues the trace in the incoming traceparent metadata and wraps
+// the call in a server span. New runs it before the configured interceptors when tracing is enabled.
+func UnaryServerTracing(t *Tracing) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startServerSpan(ctx, t, info.FullMethod)
+		defer span.End()
+		resp, err := handler(ctx, req)
+		endRPCSpan(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerTracing is the streaming counterpart of UnaryServerTracing.
+func StreamServerTracing(t *Tracing) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startServerSpan(stream.Context(), t, info.FullMethod)
+		defer span.End()
+		err := handler(srv, &tracedServerStream{ServerStream: stream, ctx: ctx})
+		endRPCSpan(span, err)
+		return err
+	}
+}
+
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func startServerSpan(ctx context.Context, t *Tracing, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = Propagator.Extract(ctx, metadataCarrier(md))
+	attrs := rpcAttributes(fullMethod)
+	if values := md.Get("x-request-id"); len(values) > 0 {
+		attrs = append(attrs, RequestIDSpanAttribute.String(values[0]))
+	}
+	return t.Tracer.Start(ctx, strings.TrimPrefix(fullMethod, "/"), trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+// UnaryClientTracing returns an interceptor that wraps calls in a client span and sends its context as traceparent
+// metadata. GRPCClients installs it on every connection.
+func UnaryClientTracing(t *Tracing) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := startClientSpan(ctx, t, method)
+		defer span.End()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		endRPCSpan(span, err)
+		return err
+	}
+}
+
+// StreamClientTracing is the streaming counterpart of UnaryClientTracing. The span ends once the stream is set up.
+func StreamClientTracing(t *Tracing) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startClientSpan(ctx, t, method)
+		defer span.End()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		endRPCSpan(span, err)
+		return stream, err
+	}
+}
+
+func startClientSpan(ctx context.Context, t *Tracing, fullMethod string) (context.Context, trace.Span) {
+	ctx, span := t.Tracer.Start(ContextWithSpan(ctx), strings.TrimPrefix(fullMethod, "/"), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(rpcAttributes(fullMethod)...))
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	Propagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+func rpcAttributes(fullMethod string) []attribute.KeyValue {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return []attribute.KeyValue{semconv.RPCSystemGRPC, semconv.RPCService(service), semconv.RPCMethod(method)}
+}
+
+func endRPCSpan(span trace.Span, err error) {
+	code := status.Code(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, code.String())
+	}
+}
+
+// metadataCarrier adapts gRPC metadata to the propagation.TextMapCarrier interface.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
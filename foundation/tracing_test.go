@@ -0,0 +1,200 @@
+package foundation_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/grpcmw"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	givenTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	givenTraceparent = "00-" + givenTraceID + "-00f067aa0ba902b7-01"
+)
+
+func Test_NewTracing(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		given       foundation.TracingOptions
+		wantEnabled bool
+		wantErr     string
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:        "stdout",
+			given:       foundation.TracingOptions{Exporter: foundation.TracingExporterStdout, ServiceName: "orders"},
+			wantEnabled: true,
+		},
+		{
+			name:        "custom exporter",
+			given:       foundation.TracingOptions{SpanExporter: tracetest.NewNoopExporter()},
+			wantEnabled: true,
+		},
+		{
+			name:    "unknown exporter",
+			given:   foundation.TracingOptions{Exporter: "jaeger"},
+			wantErr: `[foundation] unknown tracing exporter "jaeger"`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tracing, err := foundation.NewTracing(context.Background(), tc.given)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantEnabled, tracing.Enabled())
+			assert.NoError(t, tracing.Shutdown(context.Background()))
+		})
+	}
+}
+
+func Test_NewDisablesBrokenTracing(t *testing.T) {
+	t.Parallel()
+
+	f := foundation.New(foundation.Options{
+		Environment: foundation.Test,
+		Logger:      foundation.NewNopLogger(),
+		Tracing:     foundation.TracingOptions{Exporter: "jaeger"},
+	})
+	assert.False(t, f.Tracing.Enabled())
+}
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, attr := range span.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
+
+func Test_HTTPTracing(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	f := foundation.New(foundation.Options{
+		Environment: foundation.Test,
+		Logger:      foundation.NewNopLogger(),
+		Tracing:     foundation.TracingOptions{SpanExporter: exporter, Synchronous: true},
+	})
+	f.HTTPRouter.Use(middleware.Logger(foundation.NewNopLogger()))
+	var handlerTrace foundation.TraceContext
+	f.HTTPRouter.GET("/orders/:id", func(c *gin.Context) {
+		handlerTrace, _ = foundation.TraceContextFromContext(c)
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	req.Header.Set("traceparent", givenTraceparent)
+	req.Header.Set(middleware.RequestIDField, "abc-123")
+	f.HTTPRouter.ServeHTTP(httptest.NewRecorder(), req)
+	f.HTTPRouter.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, foundation.LivenessPath, nil))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1, "health probes are not traced")
+	span := spans[0]
+	assert.Equal(t, "GET /orders/:id", span.Name)
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+	assert.Equal(t, givenTraceID, span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	assert.Equal(t, span.SpanContext.SpanID().String(), handlerTrace.SpanID, "handlers see the server span")
+
+	attrs := spanAttributes(span)
+	assert.Equal(t, "abc-123", attrs[foundation.RequestIDSpanAttribute].AsString())
+	assert.Equal(t, "/orders/:id", attrs["http.route"].AsString())
+	assert.Equal(t, int64(http.StatusNoContent), attrs["http.status_code"].AsInt64())
+}
+
+func Test_GRPCTracing(t *testing.T) {
+	t.Parallel()
+
+	port := freePort(t)
+	exporter := tracetest.NewInMemoryExporter()
+	f := foundation.New(foundation.Options{
+		Environment:           foundation.Test,
+		Logger:                foundation.NewNopLogger(),
+		Tracing:               foundation.TracingOptions{SpanExporter: exporter, Synchronous: true},
+		GRPCPort:              port,
+		StartGRPCServer:       true,
+		GRPCUnaryInterceptors: []grpc.UnaryServerInterceptor{grpcmw.UnaryRequestID()},
+		GRPCClients:           map[string]foundation.GRPCClientOptions{"self": {Target: "127.0.0.1:" + port, MaxAttempts: 1}},
+	})
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- f.RunWithContext(ctx, stop) }()
+	defer func() {
+		stop()
+		<-done
+	}()
+
+	client, err := foundation.GRPCClient(f.GRPCClients, "self", healthpb.NewHealthClient)
+	require.NoError(t, err)
+	parentCtx, parent := f.Tracing.Tracer.Start(foundation.ContextWithRequestID(context.Background(), "abc-123"), "parent")
+	require.Eventually(t, func() bool {
+		_, err := client.Check(parentCtx, &healthpb.HealthCheckRequest{})
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	parent.End()
+
+	var clientSpan, serverSpan tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		switch span.SpanKind {
+		case trace.SpanKindClient:
+			clientSpan = span
+		case trace.SpanKindServer:
+			serverSpan = span
+		}
+	}
+	assert.Equal(t, "grpc.health.v1.Health/Check", clientSpan.Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), clientSpan.Parent.SpanID())
+	assert.Equal(t, "grpc.health.v1.Health/Check", serverSpan.Name)
+	assert.Equal(t, parent.SpanContext().TraceID(), serverSpan.SpanContext.TraceID(), "traceparent is sent as metadata")
+	assert.Equal(t, clientSpan.SpanContext.SpanID(), serverSpan.Parent.SpanID())
+	assert.True(t, serverSpan.Parent.IsRemote())
+
+	attrs := spanAttributes(serverSpan)
+	assert.Equal(t, "abc-123", attrs[foundation.RequestIDSpanAttribute].AsString())
+	assert.Equal(t, "grpc.health.v1.Health", attrs["rpc.service"].AsString())
+	assert.Equal(t, "Check", attrs["rpc.method"].AsString())
+	assert.Equal(t, int64(0), attrs["rpc.grpc.status_code"].AsInt64())
+}
+
+func Test_TraceContextFromContext(t *testing.T) {
+	t.Parallel()
+
+	_, ok := foundation.TraceContextFromContext(context.Background())
+	assert.False(t, ok)
+
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "op")
+	defer span.End()
+	got, ok := foundation.TraceContextFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, foundation.TraceContext{
+		TraceID: span.SpanContext().TraceID().String(),
+		SpanID:  span.SpanContext().SpanID().String(),
+		Sampled: true,
+	}, got)
+}
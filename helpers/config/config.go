@@ -7,44 +7,103 @@ import (
 )
 
 type Config struct {
-	AppName           string                  `json:"appName" validate:"required"`
-	RootDomain        string                  `json:"rootDomain" validate:"required"`
-	SessionKey        string                  `json:"sessionKey"`
-	Environment       string                  `json:"environment" validate:"required,oneof=development staging production"`
-	GoogleProjectID   string                  `json:"googleProjectID"`
-	HTTPServerConfig  ServerConfig            `json:"httpServerConfig"`
-	GRPCServerConfig  ServerConfig            `json:"grpcServerConfig"`
-	GRPCClientConfigs map[string]ClientConfig `json:"grpcClientConfigs"` //map[name]ClientConfig
-	DBConfigs         map[string]DBConfig     `json:"dbConfigs"`         //map[use]DBConfig: ex. map["main"]DBConfig, map["readOnly"]DBConfig
-	PubSubConfig      PubSubConfig            `json:"pubSubConfig"`
-	AUTH0Config       Auth0Config             `json:"auth0Config"`
+	AppName           string                   `json:"appName" validate:"required"`
+	RootDomain        string                   `json:"rootDomain" validate:"required"`
+	SessionKey        string                   `json:"sessionKey"`
+	Environment       string                   `json:"environment" validate:"required,oneof=development test staging sandbox integration production"`
+	GoogleProjectID   string                   `json:"googleProjectID"`
+	HTTPServerConfig  ServerConfig             `json:"httpServerConfig"`
+	GRPCServerConfig  ServerConfig             `json:"grpcServerConfig"`
+	AdminServerConfig AdminServerConfig        `json:"adminServerConfig"`                 // metrics, pprof and runtime state, off without a port
+	GRPCClientConfigs map[string]ClientConfig  `json:"grpcClientConfigs" validate:"dive"` //map[name]ClientConfig
+	DBConfigs         map[string]DBConfig      `json:"dbConfigs" validate:"dive"`         //map[use]DBConfig: ex. map["main"]DBConfig, map["readOnly"]DBConfig
+	PubSubConfig      PubSubConfig             `json:"pubSubConfig"`
+	AUTH0Config       Auth0Config              `json:"auth0Config"`
+	BasicAuthUsers    map[string]BasicAuthUser `json:"basicAuthUsers"` //map[username]BasicAuthUser
+	LogConfig         LogConfig                `json:"logConfig"`
+	TracingConfig     TracingConfig            `json:"tracingConfig"`
+	RateLimitConfig   RateLimitConfig          `json:"rateLimitConfig"`
+	TenancyConfig     TenancyConfig            `json:"tenancyConfig"`
+}
+
+type TenancyConfig struct {
+	Registry         string                  `json:"registry" validate:"omitempty,oneof=static postgres"` // empty disables tenant resolution
+	DB               string                  `json:"db" validate:"required_if=Registry postgres"`         // dbConfigs use holding the tenants table, ex. "main"
+	CacheTTL         int                     `json:"cacheTTL" validate:"gte=0"`                           // seconds tenants looked up in the db are cached, 0 for a minute
+	DefaultSubdomain string                  `json:"defaultSubdomain"`                                    // tenant of hosts without a subdomain, ex. localhost in development
+	Tenants          map[string]TenantConfig `json:"tenants" validate:"dive"`                             //map[id]TenantConfig, for the static registry
+}
+
+type TenantConfig struct {
+	Subdomain string `json:"subdomain" validate:"required"`
+	Name      string `json:"name"`
+	Schema    string `json:"schema"` // postgres schema of the tenant's tables, ex. "tenant_wu"
+	DB        string `json:"db"`     // dbConfigs use of the tenant's own database, empty for the default one
+}
+
+type RateLimitConfig struct {
+	Algorithm string `json:"algorithm" validate:"omitempty,oneof=token_bucket sliding_window"` // empty uses token_bucket
+	Requests  int    `json:"requests" validate:"gte=0"`                                        // requests allowed per period and key, 0 disables rate limiting
+	Period    int    `json:"period" validate:"required_with=Requests,gte=0"`                   // seconds
+	Store     string `json:"store" validate:"omitempty,oneof=memory postgres"`                 // empty uses memory
+	DB        string `json:"db" validate:"required_if=Store postgres"`                         // dbConfigs use holding the rate_limits table, ex. "main"
+}
+
+type TracingConfig struct {
+	Exporter    string  `json:"exporter" validate:"omitempty,oneof=otlp stdout"` // empty disables tracing
+	Endpoint    string  `json:"endpoint"`                                        // otlp collector host:port, ex. "otel-collector:4317"
+	Insecure    bool    `json:"insecure"`                                        // send to the collector without TLS
+	SampleRatio float64 `json:"sampleRatio" validate:"gte=0,lte=1"`              // share of new traces recorded, 0 records all
+}
+
+type LogConfig struct {
+	Level     string   `json:"level" validate:"omitempty,oneof=debug info warn error"` // empty keeps the environment's default level
+	SkipPaths []string `json:"skipPaths"`                                              // http paths that are not logged, ex. "/health"
 }
 
 type Auth0Config struct {
 	Domain       string `json:"domain"`
 	ClientID     string `json:"clientID"`
 	ClientSecret string `json:"clientSecret"`
+	Audience     string `json:"audience"`
+	RolesClaim   string `json:"rolesClaim"` // namespaced custom claim holding the user's roles, ex. "https://optech.com/roles"
+}
+
+type BasicAuthUser struct {
+	PasswordHash string `json:"passwordHash"` // bcrypt ($2a$, $2b$, $2y$) or argon2id ($argon2id$) encoded hash
+	Realm        string `json:"realm"`        // realm the user may authenticate against, empty for every realm
 }
 
 type ClientConfig struct {
 	Name              string `json:"name"`
-	Host              string `json:"host"`
-	Port              string `json:"port"`
-	GoogleIAMAudience string `json:"googleIAMAudience"`
+	Host              string `json:"host" validate:"required"`
+	Port              string `json:"port" validate:"required,numeric"`
+	GoogleIAMAudience string `json:"googleIAMAudience"` // sends an ID token for this audience, implies TLS
+	TLS               bool   `json:"tls"`
+	Token             string `json:"token"` // static bearer token, used when there is no GoogleIAMAudience
 }
 
 type ServerConfig struct {
-	Port         string `json:"port"`
-	ShutdownWait int    `json:"shutdownWait"`
-	WriteTimeout int    `json:"writeTimeout"`
-	ReadTimeout  int    `json:"readTimeout"`
-	IdleTimeout  int    `json:"idleTimeout"`
+	Port         string `json:"port" validate:"omitempty,numeric"`
+	ShutdownWait int    `json:"shutdownWait" validate:"gte=0"`
+	WriteTimeout int    `json:"writeTimeout" validate:"gte=0"`
+	ReadTimeout  int    `json:"readTimeout" validate:"gte=0"`
+	IdleTimeout  int    `json:"idleTimeout" validate:"gte=0"`
+	MaxBodyBytes int64  `json:"maxBodyBytes" validate:"gte=0"` // largest request body the grpc gateway reads, 4MiB when 0
+}
+
+type AdminServerConfig struct {
+	Port  string `json:"port" validate:"omitempty,numeric"`
+	Host  string `json:"host"`  // interface listened on, ex. "0.0.0.0", only loopback without a token
+	Token string `json:"token"` // bearer token required on every request, ex. "secret://admin-token"
 }
 
 type DBConfig struct {
-	ConnectionURL string `json:"connectionURL"`
-	MaxIdleConns  int    `json:"maxIdleConns"`
-	MaxOpenConns  int    `json:"maxOpenConns"`
+	ConnectionURL  string `json:"connectionURL" validate:"required"`
+	MaxIdleConns   int    `json:"maxIdleConns" validate:"gte=0"`
+	MaxOpenConns   int    `json:"maxOpenConns" validate:"gte=0"`
+	MigrationsURL  string `json:"migrationsURL" validate:"required_if=MigrateOnStart true"` // golang-migrate source, ex. "gcs://bucket/migrations" or "file://migrations"
+	MigrateOnStart bool   `json:"migrateOnStart"`                                           // migrate up before the service starts serving
 }
 
 type PubSubConfig struct {
@@ -81,7 +140,10 @@ func LoadConfig(configValues []byte) (Config, error) {
 		HTTPServerConfig: ServerConfig{},
 		GRPCServerConfig: ServerConfig{},
 	}, configValues)
-	return *cfg, err
+	if err != nil {
+		return *cfg, err
+	}
+	return *cfg, cfg.Validate()
 }
 
 func LoadConfigWithDefaults(configValues []byte) (Config, error) {
@@ -94,6 +156,9 @@ func LoadConfigWithDefaults(configValues []byte) (Config, error) {
 			IdleTimeout:  60,
 		},
 	}, configValues)
+	if err != nil {
+		return *cfg, err
+	}
 
 	if cfg.DBConfigs != nil {
 		for connectionName, dbConfig := range cfg.DBConfigs {
@@ -111,11 +176,13 @@ func LoadConfigWithDefaults(configValues []byte) (Config, error) {
 					}
 					return in
 				}(dbConfig.MaxOpenConns),
+				MigrationsURL:  dbConfig.MigrationsURL,
+				MigrateOnStart: dbConfig.MigrateOnStart,
 			}
 		}
 	}
 
-	return *cfg, err
+	return *cfg, cfg.Validate()
 }
 
 func load(cfg *Config, configValues []byte) (*Config, error) {
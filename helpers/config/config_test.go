@@ -39,6 +39,7 @@ func Test_LoadFromStringWithoutDefaults(t *testing.T) {
 	t.Parallel()
 	cfg, err := LoadFromString(`{
 		"appName": "test", 
+		"rootDomain": "otoslocal.com",
 		"environment": "development", 
 		"httpServerConfig": {"port": "8080"}, 
 		"grpcClientConfigs": {
@@ -61,6 +62,8 @@ func Test_LoadFromStringWithoutDefaults(t *testing.T) {
 func Test_LoadFromStringWDefaults(t *testing.T) {
 	t.Parallel()
 	cfg, err := LoadFromString(`{
+		"appName": "test",
+		"rootDomain": "otoslocal.com",
 		"httpServerConfig": {"port": "8080"}, 
 		"grpcClientConfigs": {"orders": {"host": "orders", "port": "8081"}}
 	  }
@@ -0,0 +1,512 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source descriptions reported by Sources. Files, environment variables and flags are reported as
+// "file:<path>", "env:<NAME>" and "flag:-set <path>".
+const (
+	SourceDefault = "default"
+	SourceJSON    = "json"
+)
+
+// DefaultEnvPrefix prefixes the environment variables that override config values.
+const DefaultEnvPrefix = "APP"
+
+// Loader builds a Config from layers. Later layers override earlier ones, value by value:
+//
+//  1. defaults, when UseDefaults is set
+//  2. File
+//  3. the environment file next to File, ex. config.production.json for config.json, when it exists. The
+//     environment is the highest precedence "environment" value from the other layers.
+//  4. JSON, a whole config in a string, as Cloud Run provides it through the config environment variable
+//  5. environment variables named after the JSON path, ex. APP_HTTPSERVERCONFIG_PORT=3000 or
+//     APP_DBCONFIGS_READ_ONLY_CONNECTIONURL=postgres://... The segments are matched against the Config fields, so map
+//     keys can hold underscores, and case-insensitively against the keys already loaded. Struct and map values can be
+//     given as JSON. Variables that name no config value are passed to OnWarning and ignored.
+//  6. flags parsed from Args: -config <file> replaces File and -set path=value, repeatable, sets a value by its
+//     dotted JSON path, ex. -set httpServerConfig.port=3000
+//
+// Finally, string values of the form secret://<name> are replaced by Secrets.
+type Loader struct {
+	// File is the base JSON config file.
+	// Optional.
+	File string
+
+	// JSON is a JSON config.
+	// Optional.
+	JSON string
+
+	// EnvPrefix prefixes the environment variable overrides.
+	// Optional. Default value DefaultEnvPrefix.
+	EnvPrefix string
+
+	// Environ lists the environment as KEY=value pairs.
+	// Optional. Default value os.Environ().
+	Environ []string
+
+	// Args are the command line flags, ex. os.Args[1:].
+	// Optional.
+	Args []string
+
+	// UseDefaults applies the same defaults as LoadConfigWithDefaults.
+	UseDefaults bool
+
+	// Secrets resolves secret:// references. Loading fails when a reference is found without it.
+	// Optional.
+	Secrets SecretProvider
+
+	// OnWarning is called with the problems that do not stop loading, ex. an ignored environment variable.
+	// Optional. Default value log.Print.
+	OnWarning func(err error)
+}
+
+// Sources maps the dotted JSON path of every loaded value to the layer that provided it.
+type Sources map[string]string
+
+// Of returns the source of the value at path, or "" if no layer set it.
+func (s Sources) Of(path string) string {
+	return s[path]
+}
+
+// String lists the sources one per line, sorted by path. Secrets values are never included.
+func (s Sources) String() string {
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s: %s\n", path, s[path])
+	}
+	return b.String()
+}
+
+var configType = reflect.TypeOf(Config{})
+
+// defaultValues mirrors LoadConfigWithDefaults so the defaults show up in Sources.
+var defaultValues = map[string]interface{}{
+	"environment": "development",
+	"httpServerConfig": map[string]interface{}{
+		"shutdownWait": 30,
+		"writeTimeout": 15,
+		"readTimeout":  15,
+		"idleTimeout":  60,
+	},
+}
+
+type layer struct {
+	source string
+	values map[string]interface{}
+}
+
+// Load merges the layers and returns the config together with where each value came from.
+func (l Loader) Load(ctx context.Context) (Config, Sources, error) {
+	if l.EnvPrefix == "" {
+		l.EnvPrefix = DefaultEnvPrefix
+	}
+	if l.Environ == nil {
+		l.Environ = os.Environ()
+	}
+	if l.OnWarning == nil {
+		l.OnWarning = func(err error) { log.Print(err) }
+	}
+
+	flags, err := l.parseFlags()
+	if err != nil {
+		return Config{}, nil, err
+	}
+	if flags.file != "" {
+		l.File = flags.file
+	}
+
+	var layers []layer
+	if l.UseDefaults {
+		layers = append(layers, layer{source: SourceDefault, values: defaultValues})
+	}
+	if l.File != "" {
+		values, err := readJSONFile(l.File)
+		if err != nil {
+			return Config{}, nil, err
+		}
+		layers = append(layers, layer{source: "file:" + l.File, values: values})
+	}
+	var overrides []layer
+	if l.JSON != "" {
+		values, err := decodeJSON(strings.NewReader(l.JSON), SourceJSON)
+		if err != nil {
+			return Config{}, nil, err
+		}
+		overrides = append(overrides, layer{source: SourceJSON, values: values})
+	}
+
+	// env and flag overrides are resolved against what the files hold, to match map keys
+	base := map[string]interface{}{}
+	for _, layer := range append(layers, overrides...) {
+		merge(base, layer.values, "", "", nil)
+	}
+	envLayers, err := l.envLayers(base)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	overrides = append(overrides, envLayers...)
+	flagLayers, err := flags.layers(base)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	overrides = append(overrides, flagLayers...)
+
+	if l.File != "" {
+		environment := "development"
+		for _, layer := range append(layers, overrides...) {
+			if value, ok := layer.values["environment"].(string); ok && value != "" {
+				environment = value
+			}
+		}
+		envFile := environmentFile(l.File, environment)
+		values, err := readJSONFile(envFile)
+		switch {
+		case err == nil:
+			layers = append(layers, layer{source: "file:" + envFile, values: values})
+		case !errors.Is(err, os.ErrNotExist):
+			return Config{}, nil, err
+		}
+	}
+
+	merged := map[string]interface{}{}
+	sources := Sources{}
+	for _, layer := range append(layers, overrides...) {
+		merge(merged, canonicalize(layer.values, configType), "", layer.source, sources)
+	}
+	if err := resolveSecrets(ctx, merged, "", l.Secrets, sources); err != nil {
+		return Config{}, nil, err
+	}
+
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	var cfg Config
+	if l.UseDefaults {
+		cfg, err = LoadConfigWithDefaults(encoded)
+	} else {
+		cfg, err = LoadConfig(encoded)
+	}
+	if err != nil {
+		return cfg, nil, err
+	}
+	return cfg, sources, nil
+}
+
+// Files returns the config files Load reads for environment, the base file and its environment file.
+func (l Loader) Files(environment string) ([]string, error) {
+	flags, err := l.parseFlags()
+	if err != nil {
+		return nil, err
+	}
+	if flags.file != "" {
+		l.File = flags.file
+	}
+	if l.File == "" {
+		return nil, nil
+	}
+	return []string{l.File, environmentFile(l.File, environment)}, nil
+}
+
+func environmentFile(file, environment string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + environment + ext
+}
+
+func readJSONFile(path string) (map[string]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeJSON(f, path)
+}
+
+func decodeJSON(r io.Reader, source string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("config %s: %w", source, err)
+	}
+	return values, nil
+}
+
+// merge copies src into dst, recursing into objects, and records the source of every leaf written.
+func merge(dst, src map[string]interface{}, prefix, source string, sources Sources) {
+	for key, value := range src {
+		path := joinPath(prefix, key)
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			dstMap, ok := dst[key].(map[string]interface{})
+			if !ok {
+				dstMap = map[string]interface{}{}
+				dst[key] = dstMap
+			}
+			merge(dstMap, srcMap, path, source, sources)
+			if len(srcMap) == 0 && sources != nil {
+				sources[path] = source
+			}
+			continue
+		}
+		dst[key] = value
+		if sources != nil {
+			for existing := range sources {
+				if strings.HasPrefix(existing, path+".") {
+					delete(sources, existing)
+				}
+			}
+			sources[path] = source
+		}
+	}
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// canonicalize rewrites the struct field names in values to their JSON tag spelling, as encoding/json matches
+// them case-insensitively and merging must not keep both spellings.
+func canonicalize(values map[string]interface{}, t reflect.Type) map[string]interface{} {
+	out := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		childType := t
+		name := key
+		switch t.Kind() {
+		case reflect.Struct:
+			if field, found := jsonField(t, key); found {
+				name, childType = field.name, field.typ
+			} else {
+				childType = nil
+			}
+		case reflect.Map:
+			childType = t.Elem()
+		default:
+			childType = nil
+		}
+		if child, ok := value.(map[string]interface{}); ok && childType != nil {
+			value = canonicalize(child, childType)
+		}
+		out[name] = value
+	}
+	return out
+}
+
+type jsonFieldInfo struct {
+	name string
+	typ  reflect.Type
+}
+
+func jsonField(t reflect.Type, name string) (jsonFieldInfo, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if strings.EqualFold(tag, name) {
+			return jsonFieldInfo{name: tag, typ: field.Type}, true
+		}
+	}
+	return jsonFieldInfo{}, false
+}
+
+// unknownPathError is returned by override when the segments name no config value.
+type unknownPathError struct {
+	msg string
+}
+
+func (e *unknownPathError) Error() string {
+	return e.msg
+}
+
+// override is a single env var or flag value to set at a path of segments, map keys can span several segments
+// joined by separator.
+func override(existing map[string]interface{}, segments []string, separator, raw, source string) (layer, error) {
+	path, t, err := resolvePath(configType, existing, segments, separator, nil)
+	if err != nil {
+		return layer{}, &unknownPathError{msg: fmt.Sprintf("config %s: %s", source, err)}
+	}
+
+	value, err := parseValue(t, raw)
+	if err != nil {
+		return layer{}, fmt.Errorf("config %s: %w", source, err)
+	}
+	values := map[string]interface{}{}
+	node := values
+	for _, key := range path[:len(path)-1] {
+		child := map[string]interface{}{}
+		node[key] = child
+		node = child
+	}
+	node[path[len(path)-1]] = value
+	return layer{source: source, values: values}, nil
+}
+
+// resolvePath matches segments against the fields of t and returns the JSON path they name below prefix, and its type.
+// A map key is the segments up to the ones the rest of the path resolves against the map's values: a key already
+// loaded when one matches case-insensitively, else the shortest one, lowercased.
+func resolvePath(t reflect.Type, existing map[string]interface{}, segments []string, separator string, prefix []string) ([]string, reflect.Type, error) {
+	if len(segments) == 0 {
+		return nil, t, nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		field, found := jsonField(t, segments[0])
+		if !found {
+			return nil, nil, fmt.Errorf("unknown field %q", strings.Join(append(prefix, segments[0]), "."))
+		}
+		next, _ := existing[field.name].(map[string]interface{})
+		path, leaf, err := resolvePath(field.typ, next, segments[1:], separator, append(prefix, field.name))
+		if err != nil {
+			return nil, nil, err
+		}
+		return append([]string{field.name}, path...), leaf, nil
+	case reflect.Map:
+		type candidate struct {
+			key  string
+			size int
+		}
+		var candidates []candidate
+		for size := 1; size <= len(segments); size++ {
+			joined := strings.Join(segments[:size], separator)
+			for key := range existing {
+				if strings.EqualFold(key, joined) {
+					candidates = append(candidates, candidate{key: key, size: size})
+				}
+			}
+		}
+		if len(candidates) == 0 {
+			for size := 1; size <= len(segments); size++ {
+				candidates = append(candidates, candidate{key: strings.ToLower(strings.Join(segments[:size], separator)), size: size})
+			}
+		}
+		var firstErr error
+		for _, c := range candidates {
+			next, _ := existing[c.key].(map[string]interface{})
+			path, leaf, err := resolvePath(t.Elem(), next, segments[c.size:], separator, append(prefix, c.key))
+			if err == nil {
+				return append([]string{c.key}, path...), leaf, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return nil, nil, firstErr
+	default:
+		return nil, nil, fmt.Errorf("%q is not an object", strings.Join(prefix, "."))
+	}
+}
+
+func parseValue(t reflect.Type, raw string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		return strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(raw, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(raw, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(raw, 64)
+	}
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("expected JSON for %s: %w", t, err)
+	}
+	return value, nil
+}
+
+// envLayers turns the prefixed environment variables into one layer each, sorted so the result is stable. The ones
+// naming no config value, ex. another program's APP_ variable, are reported to OnWarning and skipped.
+func (l Loader) envLayers(existing map[string]interface{}) ([]layer, error) {
+	prefix := l.EnvPrefix + "_"
+	var names []string
+	values := map[string]string{}
+	for _, entry := range l.Environ {
+		name, value, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			names = append(names, name)
+			values[name] = value
+		}
+	}
+	sort.Strings(names)
+
+	layers := make([]layer, 0, len(names))
+	for _, name := range names {
+		layer, err := override(existing, strings.Split(strings.TrimPrefix(name, prefix), "_"), "_", values[name], "env:"+name)
+		var unknown *unknownPathError
+		if errors.As(err, &unknown) {
+			l.OnWarning(fmt.Errorf("%w, ignored", err))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+type loaderFlags struct {
+	file string
+	sets []string
+}
+
+func (l Loader) parseFlags() (loaderFlags, error) {
+	var flags loaderFlags
+	if len(l.Args) == 0 {
+		return flags, nil
+	}
+	set := flag.NewFlagSet("config", flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+	set.StringVar(&flags.file, "config", "", "base JSON config file")
+	set.Func("set", "override a value, ex. -set httpServerConfig.port=3000", func(value string) error {
+		flags.sets = append(flags.sets, value)
+		return nil
+	})
+	if err := set.Parse(l.Args); err != nil {
+		return flags, fmt.Errorf("config flags: %w", err)
+	}
+	return flags, nil
+}
+
+func (f loaderFlags) layers(existing map[string]interface{}) ([]layer, error) {
+	layers := make([]layer, 0, len(f.sets))
+	for _, set := range f.sets {
+		path, value, found := strings.Cut(set, "=")
+		if !found || path == "" {
+			return nil, fmt.Errorf("config flag -set %q: expected path=value", set)
+		}
+		layer, err := override(existing, strings.Split(path, "."), ".", value, "flag:-set "+path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func Test_LoaderPrecedence(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.json", `{
+		"appName": "base",
+		"rootDomain": "otoslocal.com",
+		"environment": "staging",
+		"httpServerConfig": {"port": "8080", "readTimeout": 5},
+		"dbConfigs": {"readOnly": {"connectionURL": "postgres://base"}}
+	}`)
+	writeFile(t, dir, "config.staging.json", `{"appName": "staging", "httpServerConfig": {"port": "8081"}}`)
+
+	cfg, sources, err := Loader{
+		File: file,
+		JSON: `{"rootDomain": "optech.com", "httpServerConfig": {"port": "8082"}}`,
+		Environ: []string{
+			"APP_HTTPSERVERCONFIG_PORT=8083",
+			"APP_HTTPSERVERCONFIG_WRITETIMEOUT=20",
+			"APP_DBCONFIGS_READONLY_MAXOPENCONNS=3",
+			"OTHER_APPNAME=ignored",
+		},
+		Args:        []string{"-set", "httpServerConfig.port=8084"},
+		UseDefaults: true,
+	}.Load(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "staging", cfg.AppName)
+	assert.Equal(t, "optech.com", cfg.RootDomain)
+	assert.Equal(t, "8084", cfg.HTTPServerConfig.Port)
+	assert.Equal(t, 20, cfg.HTTPServerConfig.WriteTimeout)
+	assert.Equal(t, 5, cfg.HTTPServerConfig.ReadTimeout)
+	assert.Equal(t, 60, cfg.HTTPServerConfig.IdleTimeout)
+	assert.Equal(t, "postgres://base", cfg.DBConfigs["readOnly"].ConnectionURL)
+	assert.Equal(t, 3, cfg.DBConfigs["readOnly"].MaxOpenConns)
+	assert.Equal(t, 5, cfg.DBConfigs["readOnly"].MaxIdleConns)
+
+	assert.Equal(t, "file:"+filepath.Join(dir, "config.staging.json"), sources.Of("appName"))
+	assert.Equal(t, SourceJSON, sources.Of("rootDomain"))
+	assert.Equal(t, "flag:-set httpServerConfig.port", sources.Of("httpServerConfig.port"))
+	assert.Equal(t, "env:APP_HTTPSERVERCONFIG_WRITETIMEOUT", sources.Of("httpServerConfig.writeTimeout"))
+	assert.Equal(t, "file:"+file, sources.Of("httpServerConfig.readTimeout"))
+	assert.Equal(t, SourceDefault, sources.Of("httpServerConfig.idleTimeout"))
+	assert.Equal(t, "env:APP_DBCONFIGS_READONLY_MAXOPENCONNS", sources.Of("dbConfigs.readOnly.maxOpenConns"))
+}
+
+func Test_LoaderEnvironmentFileFollowsOverrides(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.json", `{"appName": "base", "rootDomain": "otoslocal.com", "environment": "staging"}`)
+	writeFile(t, dir, "config.staging.json", `{"appName": "staging"}`)
+	writeFile(t, dir, "config.production.json", `{"appName": "production"}`)
+
+	cfg, _, err := Loader{
+		File:    file,
+		Environ: []string{"APP_ENVIRONMENT=production"},
+	}.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "production", cfg.Environment)
+	assert.Equal(t, "production", cfg.AppName)
+}
+
+func Test_LoaderConfigFlag(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	file := writeFile(t, dir, "other.json", `{"appName": "other", "rootDomain": "other.com", "environment": "test"}`)
+
+	cfg, sources, err := Loader{
+		File:    "config_test.json",
+		Environ: []string{},
+		Args:    []string{"-config", file},
+	}.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "other", cfg.AppName)
+	assert.Equal(t, "other.com", cfg.RootDomain)
+	assert.Equal(t, "file:"+file, sources.Of("appName"))
+}
+
+func Test_LoaderSecrets(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writeFile(t, dir, "db-password", "s3cr3t\n")
+
+	cfg, sources, err := Loader{
+		JSON:        `{"appName": "test", "rootDomain": "otoslocal.com", "sessionKey": "secret://session-key"}`,
+		UseDefaults: true,
+		Environ:     []string{"APP_DBCONFIGS_MAIN_CONNECTIONURL=secret://db-password"},
+		Secrets: SecretProviderFunc(func(ctx context.Context, name string) (string, error) {
+			if name == "session-key" {
+				return "session", nil
+			}
+			return FileSecretProvider{Dir: dir}.Secret(ctx, name)
+		}),
+	}.Load(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "session", cfg.SessionKey)
+	assert.Equal(t, "s3cr3t", cfg.DBConfigs["main"].ConnectionURL)
+	assert.Equal(t, "secret://db-password from env:APP_DBCONFIGS_MAIN_CONNECTIONURL", sources.Of("dbConfigs.main.connectionURL"))
+	assert.NotContains(t, sources.String(), "s3cr3t")
+}
+
+func Test_LoaderEnvOverrides(t *testing.T) {
+	t.Parallel()
+
+	var warnings []string
+	cfg, sources, err := Loader{
+		JSON: `{"appName": "test", "rootDomain": "otoslocal.com", "environment": "test", "dbConfigs": {"read_only": {"connectionURL": "postgres://base"}}}`,
+		Environ: []string{
+			"APP_DBCONFIGS_READ_ONLY_MAXOPENCONNS=3",
+			"APP_DBCONFIGS_AUDIT_LOG_CONNECTIONURL=postgres://audit",
+			"APP_DBCONFIGS_READ_ONLY_PROT=8080",
+			"APP_HTTPSERVERCONFIG_PROT=8080",
+		},
+		OnWarning: func(err error) { warnings = append(warnings, err.Error()) },
+	}.Load(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, cfg.DBConfigs["read_only"].MaxOpenConns, "map keys can hold underscores")
+	assert.Equal(t, "env:APP_DBCONFIGS_READ_ONLY_MAXOPENCONNS", sources.Of("dbConfigs.read_only.maxOpenConns"))
+	assert.Equal(t, "postgres://audit", cfg.DBConfigs["audit_log"].ConnectionURL, "new map keys can hold underscores")
+	assert.Empty(t, cfg.HTTPServerConfig.Port)
+	assert.Equal(t, []string{
+		`config env:APP_DBCONFIGS_READ_ONLY_PROT: unknown field "dbConfigs.read_only.PROT", ignored`,
+		`config env:APP_HTTPSERVERCONFIG_PROT: unknown field "httpServerConfig.PROT", ignored`,
+	}, warnings)
+}
+
+func Test_LoaderErrors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		loader Loader
+	}{
+		{name: "missing file", loader: Loader{File: "missing.json"}},
+		{name: "invalid json", loader: Loader{JSON: `{"appName":`}},
+		{name: "invalid env value", loader: Loader{Environ: []string{"APP_HTTPSERVERCONFIG_READTIMEOUT=soon"}}},
+		{name: "invalid set flag", loader: Loader{Environ: []string{}, Args: []string{"-set", "appName"}}},
+		{name: "secret without provider", loader: Loader{Environ: []string{}, JSON: `{"sessionKey": "secret://key"}`}},
+		{name: "secret outside dir", loader: Loader{
+			Environ: []string{},
+			JSON:    `{"sessionKey": "secret://../key"}`,
+			Secrets: FileSecretProvider{Dir: "."},
+		}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, _, err := tc.loader.Load(context.Background())
+			require.Error(t, err)
+			var validationErr *ValidationError
+			assert.False(t, errors.As(err, &validationErr), "failed before validation")
+		})
+	}
+}
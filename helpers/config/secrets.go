@@ -0,0 +1,73 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SecretScheme prefixes string values that Loader replaces with a secret, ex. "secret://db-password".
+const SecretScheme = "secret://"
+
+// ErrNoSecretProvider is returned when a config holds a secret reference and the Loader has no SecretProvider.
+var ErrNoSecretProvider = errors.New("config: secret reference without a secret provider")
+
+// SecretProvider resolves the name of a secret:// reference to its value, ex. from Secret Manager.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to a SecretProvider.
+type SecretProviderFunc func(ctx context.Context, name string) (string, error)
+
+func (f SecretProviderFunc) Secret(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+// FileSecretProvider reads secrets from files named after them in Dir, for local development or secrets mounted
+// as volumes. A single trailing newline is trimmed.
+type FileSecretProvider struct {
+	Dir string
+}
+
+func (p FileSecretProvider) Secret(_ context.Context, name string) (string, error) {
+	if name == "" || !filepath.IsLocal(name) {
+		return "", fmt.Errorf("config: invalid secret name %q", name)
+	}
+	value, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if err != nil {
+		return "", fmt.Errorf("config: secret %q: %w", name, err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(value), "\n"), "\r"), nil
+}
+
+// resolveSecrets replaces secret references in values and notes them in sources, keeping the layer that set them.
+func resolveSecrets(ctx context.Context, values map[string]interface{}, prefix string, provider SecretProvider, sources Sources) error {
+	for key, value := range values {
+		path := joinPath(prefix, key)
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if err := resolveSecrets(ctx, value, path, provider, sources); err != nil {
+				return err
+			}
+		case string:
+			name, found := strings.CutPrefix(value, SecretScheme)
+			if !found {
+				continue
+			}
+			if provider == nil {
+				return fmt.Errorf("%w: %s", ErrNoSecretProvider, path)
+			}
+			secret, err := provider.Secret(ctx, name)
+			if err != nil {
+				return err
+			}
+			values[key] = secret
+			sources[path] = value + " from " + sources[path]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	validateOnce sync.Once
+	validate     *validator.Validate
+)
+
+// FieldError is a single field failing its validate tag.
+type FieldError struct {
+	Path  string // JSON path, ex. "dbConfigs[main].connectionURL"
+	Rule  string // failed validate tag, ex. "required"
+	Param string // tag parameter, ex. the allowed values for oneof
+	Value interface{}
+}
+
+func (e FieldError) Error() string {
+	switch e.Rule {
+	case "required":
+		return e.Path + " is required"
+	case "required_if":
+		return e.Path + " is required when " + e.Param
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s], got %q", e.Path, e.Param, e.Value)
+	}
+	if e.Param != "" {
+		return fmt.Sprintf("%s failed %s=%s, got %v", e.Path, e.Rule, e.Param, e.Value)
+	}
+	return fmt.Sprintf("%s failed %s, got %v", e.Path, e.Rule, e.Value)
+}
+
+// ValidationError lists every field of a Config failing validation.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Error()
+	}
+	return "config: invalid " + strings.Join(messages, "; ")
+}
+
+// Validate checks c against its validate tags, returning a *ValidationError listing every failing field.
+func (c Config) Validate() error {
+	validateOnce.Do(func() {
+		validate = validator.New()
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	})
+
+	err := validate.Struct(c)
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	fields := make([]FieldError, len(errs))
+	for i, fieldErr := range errs {
+		fields[i] = FieldError{
+			Path:  strings.TrimPrefix(fieldErr.Namespace(), "Config."),
+			Rule:  fieldErr.Tag(),
+			Param: fieldErr.Param(),
+			Value: fieldErr.Value(),
+		}
+	}
+	return &ValidationError{Fields: fields}
+}
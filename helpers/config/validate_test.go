@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Validate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		givenJSON  string
+		wantErrors []string
+	}{
+		{
+			name:      "valid",
+			givenJSON: `{"appName": "test", "rootDomain": "otoslocal.com", "environment": "sandbox"}`,
+		},
+		{
+			name:       "missing required",
+			givenJSON:  `{"environment": "integration"}`,
+			wantErrors: []string{"appName is required", "rootDomain is required"},
+		},
+		{
+			name:       "unknown environment",
+			givenJSON:  `{"appName": "test", "rootDomain": "otoslocal.com", "environment": "prod"}`,
+			wantErrors: []string{`environment must be one of [development test staging sandbox integration production], got "prod"`},
+		},
+		{
+			name: "nested configs",
+			givenJSON: `{
+				"appName": "test",
+				"rootDomain": "otoslocal.com",
+				"httpServerConfig": {"port": "http", "readTimeout": -1},
+				"grpcClientConfigs": {"orders": {"port": "8081"}},
+				"dbConfigs": {"main": {"migrateOnStart": true}}
+			}`,
+			wantErrors: []string{
+				"httpServerConfig.port failed numeric, got http",
+				"httpServerConfig.readTimeout failed gte=0, got -1",
+				"grpcClientConfigs[orders].host is required",
+				"dbConfigs[main].connectionURL is required",
+				"dbConfigs[main].migrationsURL is required when MigrateOnStart true",
+			},
+		},
+		{
+			name:      "tracing",
+			givenJSON: `{"appName": "test", "rootDomain": "otoslocal.com", "tracingConfig": {"exporter": "jaeger", "sampleRatio": 2}}`,
+			wantErrors: []string{
+				`tracingConfig.exporter must be one of [otlp stdout], got "jaeger"`,
+				"tracingConfig.sampleRatio failed lte=1, got 2",
+			},
+		},
+		{
+			name:      "rate limit",
+			givenJSON: `{"appName": "test", "rootDomain": "otoslocal.com", "rateLimitConfig": {"algorithm": "leaky_bucket", "requests": 10, "store": "postgres"}}`,
+			wantErrors: []string{
+				`rateLimitConfig.algorithm must be one of [token_bucket sliding_window], got "leaky_bucket"`,
+				"rateLimitConfig.period failed required_with=Requests, got 0",
+				"rateLimitConfig.db is required when Store postgres",
+			},
+		},
+		{
+			name:      "tenancy",
+			givenJSON: `{"appName": "test", "rootDomain": "otoslocal.com", "tenancyConfig": {"registry": "postgres", "tenants": {"wu": {}}}}`,
+			wantErrors: []string{
+				"tenancyConfig.db is required when Registry postgres",
+				"tenancyConfig.tenants[wu].subdomain is required",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := LoadFromString(tc.givenJSON, true)
+			if tc.wantErrors == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			got := make([]string, len(validationErr.Fields))
+			for i, field := range validationErr.Fields {
+				got[i] = field.Error()
+			}
+			assert.ElementsMatch(t, tc.wantErrors, got)
+		})
+	}
+}
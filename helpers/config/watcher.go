@@ -0,0 +1,224 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultPollInterval is how often a Watcher checks its config files for changes.
+const DefaultPollInterval = 10 * time.Second
+
+// WatcherConfig defines the config for a Watcher.
+type WatcherConfig struct {
+	// Loader loads every version of the config.
+	Loader Loader
+
+	// PollInterval is how often the config files are checked for changes, a negative value disables polling.
+	// Optional. Default value DefaultPollInterval.
+	PollInterval time.Duration
+
+	// Signals trigger a reload.
+	// Optional. Default value SIGHUP.
+	Signals []os.Signal
+
+	// OnError is called when a reload is rejected. The running config is kept.
+	// Optional.
+	OnError func(err error)
+}
+
+// Subscriber is notified with the previous and the new config after a reload changed it. Subscribers are called
+// one at a time, in subscription order, and must not modify either config.
+type Subscriber func(previous, current Config)
+
+// Watcher holds the running config and reloads it when its files change or on SIGHUP. A reload that fails to load
+// or validate is rejected and the running config is kept.
+//
+// Watcher is a foundation processor: Start begins watching and Stop ends it.
+type Watcher struct {
+	conf WatcherConfig
+
+	reloadMu    sync.Mutex // serializes reloads, so subscribers see changes in order
+	mu          sync.RWMutex
+	current     Config
+	sources     Sources
+	fingerprint string
+	subscribers []*Subscriber
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWatcher loads the initial config, failing if it is invalid.
+func NewWatcher(ctx context.Context, conf WatcherConfig) (*Watcher, error) {
+	if conf.PollInterval == 0 {
+		conf.PollInterval = DefaultPollInterval
+	}
+	if conf.Signals == nil {
+		conf.Signals = []os.Signal{syscall.SIGHUP}
+	}
+	if conf.OnError == nil {
+		conf.OnError = func(error) {}
+	}
+
+	w := &Watcher{conf: conf}
+	cfg, sources, err := conf.Loader.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w.current, w.sources = cfg, sources
+	w.fingerprint = w.stat(cfg.Environment)
+	return w, nil
+}
+
+// Config returns the running config. It must not be modified.
+func (w *Watcher) Config() Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// Sources returns where each value of the running config came from.
+func (w *Watcher) Sources() Sources {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.sources
+}
+
+// Subscribe registers fn for config changes and returns a function that unregisters it.
+func (w *Watcher) Subscribe(fn Subscriber) (unsubscribe func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	subscriber := &fn
+	w.subscribers = append(w.subscribers, subscriber)
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for i, s := range w.subscribers {
+			if s == subscriber {
+				w.subscribers = append(w.subscribers[:i:i], w.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Reload loads the config again and, if it is valid and differs from the running config, replaces it and notifies
+// the subscribers. It reports whether the config changed. Rejected reloads are also passed to OnError.
+func (w *Watcher) Reload(ctx context.Context) (bool, error) {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	// fingerprint before loading, so a change made while loading is picked up by the next poll
+	fingerprint := w.stat(w.Config().Environment)
+	cfg, sources, err := w.conf.Loader.Load(ctx)
+	w.mu.Lock()
+	// remember the files even when they are invalid, so polling does not reject the same version again
+	w.fingerprint = fingerprint
+	if err != nil {
+		w.mu.Unlock()
+		err = fmt.Errorf("config: reload rejected: %w", err)
+		w.conf.OnError(err)
+		return false, err
+	}
+	previous := w.current
+	if reflect.DeepEqual(previous, cfg) {
+		w.sources = sources
+		w.mu.Unlock()
+		return false, nil
+	}
+	w.current, w.sources = cfg, sources
+	if cfg.Environment != previous.Environment {
+		w.fingerprint = w.stat(cfg.Environment)
+	}
+	subscribers := make([]*Subscriber, len(w.subscribers))
+	copy(subscribers, w.subscribers)
+	w.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		(*subscriber)(previous, cfg)
+	}
+	return true, nil
+}
+
+// Name implements foundation.NamedProcessor.
+func (w *Watcher) Name() string {
+	return "config:watcher"
+}
+
+// Start watches for signals and file changes until Stop. It does not block.
+func (w *Watcher) Start(ctx context.Context) error {
+	if w.done != nil {
+		return errors.New("config: watcher already started")
+	}
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+
+	signals := make(chan os.Signal, 1)
+	if len(w.conf.Signals) > 0 {
+		signal.Notify(signals, w.conf.Signals...)
+	}
+
+	go func() {
+		defer close(w.done)
+		defer signal.Stop(signals)
+		var tick <-chan time.Time
+		if w.conf.PollInterval > 0 {
+			ticker := time.NewTicker(w.conf.PollInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				_, _ = w.Reload(ctx)
+			case <-tick:
+				w.mu.RLock()
+				changed := w.stat(w.current.Environment) != w.fingerprint
+				w.mu.RUnlock()
+				if changed {
+					_, _ = w.Reload(ctx)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends watching.
+func (w *Watcher) Stop(wg *sync.WaitGroup) error {
+	defer wg.Done()
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+	<-w.done
+	w.cancel, w.done = nil, nil
+	return nil
+}
+
+// stat fingerprints the config files by size and modification time, missing files included.
+func (w *Watcher) stat(environment string) string {
+	files, err := w.conf.Loader.Files(environment)
+	if err != nil {
+		return ""
+	}
+	fingerprint := ""
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			fingerprint += file + ":missing;"
+			continue
+		}
+		fingerprint += fmt.Sprintf("%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+	}
+	return fingerprint
+}
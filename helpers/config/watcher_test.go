@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WatcherReload(t *testing.T) {
+	t.Parallel()
+	file := writeFile(t, t.TempDir(), "config.json", `{"appName": "test", "rootDomain": "otoslocal.com", "logConfig": {"level": "info"}}`)
+	var rejected []error
+	w, err := NewWatcher(context.Background(), WatcherConfig{
+		Loader:       Loader{File: file, Environ: []string{}, UseDefaults: true},
+		PollInterval: -1,
+		OnError:      func(err error) { rejected = append(rejected, err) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "info", w.Config().LogConfig.Level)
+
+	var levels []string
+	w.Subscribe(func(previous, current Config) {
+		levels = append(levels, previous.LogConfig.Level+"->"+current.LogConfig.Level)
+	})
+	unsubscribe := w.Subscribe(func(previous, current Config) {
+		t.Error("unsubscribed subscriber called")
+	})
+	unsubscribe()
+
+	changed, err := w.Reload(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed, "nothing changed")
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"appName": "test", "rootDomain": "otoslocal.com", "logConfig": {"level": "debug"}}`), 0o600))
+	changed, err = w.Reload(context.Background())
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "debug", w.Config().LogConfig.Level)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"appName": "test", "rootDomain": "otoslocal.com", "logConfig": {"level": "loud"}}`), 0o600))
+	changed, err = w.Reload(context.Background())
+	var validationErr *ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+	assert.False(t, changed)
+	assert.Equal(t, "debug", w.Config().LogConfig.Level, "rejected reload keeps the running config")
+
+	assert.Equal(t, []string{"info->debug"}, levels)
+	assert.Len(t, rejected, 1)
+}
+
+func Test_WatcherPollsFiles(t *testing.T) {
+	t.Parallel()
+	file := writeFile(t, t.TempDir(), "config.json", `{"appName": "test", "rootDomain": "otoslocal.com"}`)
+	w, err := NewWatcher(context.Background(), WatcherConfig{
+		Loader:       Loader{File: file, Environ: []string{}, UseDefaults: true},
+		PollInterval: 10 * time.Millisecond,
+		Signals:      []os.Signal{},
+	})
+	require.NoError(t, err)
+
+	reloaded := make(chan Config, 1)
+	w.Subscribe(func(previous, current Config) { reloaded <- current })
+	require.NoError(t, w.Start(context.Background()))
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"appName": "renamed", "rootDomain": "otoslocal.com"}`), 0o600))
+	select {
+	case cfg := <-reloaded:
+		assert.Equal(t, "renamed", cfg.AppName)
+	case <-time.After(5 * time.Second):
+		t.Fatal("config file change was not picked up")
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	require.NoError(t, w.Stop(wg))
+	wg.Wait()
+}
+
+func Test_NewWatcherRejectsInvalidConfig(t *testing.T) {
+	t.Parallel()
+	_, err := NewWatcher(context.Background(), WatcherConfig{Loader: Loader{JSON: `{"appName": "test"}`, Environ: []string{}}})
+	assert.Error(t, err)
+}
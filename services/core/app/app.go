@@ -2,32 +2,57 @@ package app
 
 import (
 	"context"
-	"net/http"
 
 	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/db"
+	"github.com/OptechLabs/monorepo/foundation/grpcmw"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/OptechLabs/monorepo/foundation/migrations"
+	"github.com/OptechLabs/monorepo/foundation/ratelimit"
+	"github.com/OptechLabs/monorepo/foundation/tenancy"
 	config "github.com/OptechLabs/monorepo/helpers/config"
-	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 func New(
 	ctx context.Context,
 	logger foundation.Logger,
+	level *zap.AtomicLevel,
+	skipPaths *middleware.PathSet,
 	config config.Config,
 ) (app *foundation.Foundation, shutdown func() error, err error) {
 
-	app = foundation.New(foundation.Options{
-		Environment:     config.Environment,
-		HTTPPort:        config.HTTPServerConfig.Port,
-		StartHTTPServer: config.HTTPServerConfig.Port != "",
-		Logger:          logger,
-	})
+	opts := foundation.OptionsFromConfig(config)
+	opts.Logger = logger
+	opts.LogLevel = level
 
-	noAuthRoutes := app.HTTPRouter.Group("/")
-	{
-		noAuthRoutes.GET("/status", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"status": "ok"})
-		})
+	pools, err := db.Open(config.DBConfigs)
+	if err != nil {
+		return nil, nil, err
 	}
+	limiter, err := ratelimit.FromConfig(config.RateLimitConfig, pools)
+	if err != nil {
+		return nil, nil, err
+	}
+	tenants, err := tenancy.FromConfig(config.TenancyConfig, pools)
+	if err != nil {
+		return nil, nil, err
+	}
+	// no JWT interceptor authenticates gRPC callers yet, so calls are rate limited by peer IP and the tenant metadata
+	// is only taken from the gateway in this process
+	opts.GRPCUnaryInterceptors = append(opts.GRPCUnaryInterceptors, grpcmw.UnaryRateLimit(limiter), grpcmw.UnaryTenant(tenants))
+	opts.GRPCStreamInterceptors = append(opts.GRPCStreamInterceptors, grpcmw.StreamRateLimit(limiter), grpcmw.StreamTenant(tenants))
+
+	app = foundation.New(opts)
+	logConf := middleware.LoggerConfigFromConfig(config)
+	// replaced by main when the config is reloaded
+	logConf.SkipPathSet = skipPaths
+	app.HTTPRouter.Use(
+		middleware.LoggerWithConfig(logger, logConf),
+		middleware.RateLimit(limiter),
+	)
+	pools.Register(app)
+	migrations.Register(app, config.DBConfigs)
 
 	return app, func() error {
 		// waiting for shutdown signal
@@ -1,31 +1,68 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"reflect"
 
 	"github.com/OptechLabs/monorepo/foundation"
+	"github.com/OptechLabs/monorepo/foundation/middleware"
+	"github.com/OptechLabs/monorepo/foundation/migrations"
 	config "github.com/OptechLabs/monorepo/helpers/config"
 	"github.com/OptechLabs/monorepo/services/gateway/app"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"golang.org/x/sync/errgroup"
 )
 
 func main() {
-	appConfig := loadConfigurations()
+	isMigrate := len(os.Args) > 1 && os.Args[1] == "migrate"
+	var args []string
+	if !isMigrate {
+		args = os.Args[1:]
+	}
+	var logger foundation.Logger
+	watcher := loadConfigurations(args, func(err error) {
+		logger.Error("config reload rejected, keeping the running config", zap.Error(err))
+	})
+	appConfig := watcher.Config()
 	if appConfig.Environment != "development" {
+		// Cloud Run only gives us one PORT, so http and grpc share it and foundation multiplexes them.
+		appConfig.HTTPServerConfig.Port = os.Getenv("PORT")
 		appConfig.GRPCServerConfig.Port = os.Getenv("PORT")
 	}
 
-	logger, _ := foundation.NewDefaultLogger(appConfig.Environment)
+	level := zap.NewAtomicLevelAt(logLevel(appConfig))
+	logger, _ = foundation.NewLogger(appConfig.Environment, level)
+	logger.Debug("config loaded", zap.Stringer("sources", watcher.Sources()))
 	ctx, stop := foundation.ContextWithCancel()
 
-	app, shutdown, err := app.New(ctx, logger, appConfig)
+	if isMigrate {
+		if err := migrations.Command(ctx, os.Args[2:], appConfig.DBConfigs, logger, os.Stdout); err != nil {
+			logger.Fatal("migrate failed", zap.Error(err))
+		}
+		return
+	}
+
+	skipPaths := middleware.NewPathSet(appConfig.LogConfig.SkipPaths...)
+	app, shutdown, err := app.New(ctx, logger, &level, skipPaths, appConfig)
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
+	watcher.Subscribe(func(previous, current config.Config) {
+		level.SetLevel(logLevel(current))
+		skipPaths.Set(current.LogConfig.SkipPaths...)
+		if !reflect.DeepEqual(previous.GRPCClientConfigs, current.GRPCClientConfigs) {
+			if err := app.GRPCClients.Update(foundation.GRPCClientOptionsFromConfig(current.GRPCClientConfigs)); err != nil {
+				logger.Warn("failed closing replaced grpc clients", zap.Error(err))
+			}
+		}
+		logger.Info("config reloaded", zap.Stringer("sources", watcher.Sources()))
+	})
+	app.AddProcessor(watcher)
 	g := new(errgroup.Group)
 	g.Go(func() error {
 		return app.RunWithContext(ctx, stop)
@@ -39,28 +76,32 @@ func main() {
 	}
 }
 
-func loadConfigurations() (appConfig config.Config) {
-	var err error
-	cfgFile := os.Getenv("LOCAL_CONFIG_FILE")
-	configStr := os.Getenv("config")
-
-	if cfgFile == "" && configStr == "" {
-		log.Fatal("Either the LOCAL_CONFIG_FILE or config environment variable must be set.")
+// loadConfigurations layers the LOCAL_CONFIG_FILE, its environment specific file, the config environment variable,
+// APP_ prefixed environment variables and flags, in that order of precedence. secret:// references are read from
+// SECRETS_DIR. The config is reloaded when the file changes or on SIGHUP, rejected reloads are passed to onError.
+func loadConfigurations(args []string, onError func(error)) *config.Watcher {
+	loader := config.Loader{
+		File:        os.Getenv("LOCAL_CONFIG_FILE"),
+		JSON:        os.Getenv("config"),
+		Args:        args,
+		UseDefaults: true,
 	}
-
-	if configStr != "" {
-		appConfig, err = config.LoadFromString(configStr, true)
-		if err != nil {
-			log.Fatal("failed to load config", err)
-		}
+	if dir := os.Getenv("SECRETS_DIR"); dir != "" {
+		loader.Secrets = config.FileSecretProvider{Dir: dir}
 	}
 
-	if os.Getenv("LOCAL_CONFIG_FILE") != "" {
-		appConfig, err = config.LoadFromFile(cfgFile, true)
-		if err != nil {
-			log.Fatal("failed to load config", err)
-		}
+	watcher, err := config.NewWatcher(context.Background(), config.WatcherConfig{Loader: loader, OnError: onError})
+	if err != nil {
+		log.Fatal("failed to load config: ", err)
 	}
+	return watcher
+}
 
-	return appConfig
+// logLevel is the configured log level, or the environment's default one.
+func logLevel(appConfig config.Config) zapcore.Level {
+	level, err := zapcore.ParseLevel(appConfig.LogConfig.Level)
+	if err != nil || appConfig.LogConfig.Level == "" {
+		return foundation.DefaultLogLevel(appConfig.Environment)
+	}
+	return level
 }